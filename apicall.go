@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/go-authgate/oauth-cli/tui"
+)
+
+// defaultAPIRetries is how many times callAPI refreshes the token and retries
+// after a 401 unless told otherwise.
+const defaultAPIRetries = 1
+
+// statusHook handles an API response with a particular status. It returns
+// whether callAPI should send the request again; an error ends the call. The
+// hook must not close the response body.
+type statusHook func(resp *http.Response) (retry bool, err error)
+
+// apiCallOptions tunes callAPI. The zero value retries once after a 401.
+type apiCallOptions struct {
+	// maxRetries bounds the number of retries, whether triggered by a 401
+	// or by a hook; 0 means defaultAPIRetries and a negative value none.
+	maxRetries int
+
+	// onStatus hooks replace the default handling for their status code,
+	// including the 401 refresh.
+	onStatus map[int]statusHook
+
+	// header is added to every request.
+	header http.Header
+}
+
+// callAPI sends an authenticated request with the access token in storage.
+// A 401 response refreshes the token (persisting the rotated tokens and
+// updating storage) and sends the request again, up to opts.maxRetries times.
+// The final response is returned whatever its status; the caller closes it.
+func callAPI(
+	ctx context.Context,
+	storage *tui.TokenStorage,
+	method, url string,
+	body []byte,
+	opts apiCallOptions,
+) (*http.Response, error) {
+	maxRetries := opts.maxRetries
+	if maxRetries == 0 {
+		maxRetries = defaultAPIRetries
+	}
+	for attempt := 0; ; attempt++ {
+		resp, err := doAPIRequest(ctx, method, url, body, opts.header, storage.AccessToken)
+		if err != nil {
+			if attempt > 0 {
+				return nil, fmt.Errorf("retry failed: %w", err)
+			}
+			return nil, fmt.Errorf("API request failed: %w", err)
+		}
+		if attempt >= maxRetries {
+			return resp, nil
+		}
+
+		retry := false
+		if hook, ok := opts.onStatus[resp.StatusCode]; ok {
+			retry, err = hook(resp)
+		} else if resp.StatusCode == http.StatusUnauthorized {
+			retry, err = true, refreshForRetry(ctx, storage)
+		}
+		if err == nil && !retry {
+			return resp, nil
+		}
+		// Drain and close body so the HTTP transport can reuse the connection.
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// refreshForRetry refreshes the token in storage after a 401. The refresh is
+// not cancelled with ctx (an interrupt must not drop a rotated refresh token
+// the server has already issued); refreshTokenTimeout still bounds it.
+func refreshForRetry(ctx context.Context, storage *tui.TokenStorage) error {
+	newStorage, err := memTokens.Refresh(context.WithoutCancel(ctx), tokenKey(), storage.RefreshToken)
+	if newStorage != nil {
+		// Keep the caller's copy in step with the store even if saving failed.
+		*storage = *newStorage
+	}
+	if err == nil || err == tui.ErrRefreshTokenExpired || errors.Is(err, errRefreshNotSaved) {
+		return err
+	}
+	return fmt.Errorf("refresh failed: %w", err)
+}
+
+// doAPIRequest issues one API request bounded by apiCallTimeout. Only
+// idempotent methods are retried on network errors and 5xx responses; a
+// POST or PATCH the server may already have acted on is sent once. The
+// timeout is released when the caller closes the response body, so the body
+// can still be read after doAPIRequest returns.
+func doAPIRequest(
+	ctx context.Context,
+	method, url string,
+	body []byte,
+	header http.Header,
+	accessToken string,
+) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, apiCallTimeout)
+
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	client := cfg.RetryClient
+	if !idempotentMethod(method) {
+		client = cfg.NoRetryClient
+	}
+	resp, err := client.DoWithContext(ctx, req)
+	if err != nil {
+		cancel()
+		return nil, serverUnreachable(err)
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// idempotentMethod reports whether repeating a request with method has the
+// same effect as sending it once (RFC 9110 §9.2.2).
+func idempotentMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// cancelOnClose releases a request's timeout context once its body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	retry "github.com/appleboy/go-httpretry"
+	"github.com/go-authgate/sdk-go/credstore"
+)
+
+func TestCallAPI_RetryPolicy(t *testing.T) {
+	var calls, refreshes int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("Authorization") != "Bearer refreshed-access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusConflict)
+	})
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, _ *http.Request) {
+		refreshes++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"refreshed-access-token",` +
+			`"token_type":"Bearer","expires_in":3600}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	setTestServer(t, srv)
+
+	newStorage := func() *credstore.Token {
+		return &credstore.Token{
+			AccessToken:  "stale-access-token",
+			RefreshToken: "refresh",
+			ExpiresAt:    time.Now().Add(time.Hour),
+		}
+	}
+	unavailable := errors.New("unavailable")
+
+	tests := []struct {
+		name          string
+		opts          apiCallOptions
+		wantStatus    int
+		wantErr       error
+		wantCalls     int
+		wantRefreshes int
+	}{
+		{"default retries once after 401", apiCallOptions{}, http.StatusConflict, nil, 2, 1},
+		{"no retries", apiCallOptions{maxRetries: -1}, http.StatusUnauthorized, nil, 1, 0},
+		{
+			"hook retries 409",
+			apiCallOptions{maxRetries: 3, onStatus: map[int]statusHook{
+				http.StatusConflict: func(*http.Response) (bool, error) { return true, nil },
+			}},
+			http.StatusConflict, nil, 4, 1,
+		},
+		{
+			"hook error ends the call",
+			apiCallOptions{onStatus: map[int]statusHook{
+				http.StatusUnauthorized: func(*http.Response) (bool, error) { return false, unavailable },
+			}},
+			0, unavailable, 1, 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTokenTestConfig(t, "")
+			calls, refreshes = 0, 0
+			resp, err := callAPI(context.Background(), newStorage(), http.MethodGet,
+				srv.URL+"/api", nil, tt.opts)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("callAPI() error = %v, want %v", err, tt.wantErr)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("callAPI() error: %v", err)
+				}
+				resp.Body.Close()
+				if resp.StatusCode != tt.wantStatus {
+					t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+				}
+			}
+			if calls != tt.wantCalls || refreshes != tt.wantRefreshes {
+				t.Errorf("calls = %d, refreshes = %d; want %d, %d",
+					calls, refreshes, tt.wantCalls, tt.wantRefreshes)
+			}
+		})
+	}
+}
+
+func TestDoAPIRequest_RetriesOnlyIdempotentMethods(t *testing.T) {
+	calls := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls[r.Method]++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	setTestServer(t, srv)
+	client, err := retry.NewBackgroundClient(
+		retry.WithHTTPClient(srv.Client()),
+		retry.WithMaxRetries(2),
+		retry.WithInitialRetryDelay(time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.RetryClient = client
+
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPatch} {
+		resp, err := doAPIRequest(context.Background(), method, srv.URL, nil, nil, "token")
+		if err == nil {
+			resp.Body.Close()
+		}
+	}
+	if calls[http.MethodGet] != 3 {
+		t.Errorf("GET sent %d times, want 3", calls[http.MethodGet])
+	}
+	if calls[http.MethodPost] != 1 || calls[http.MethodPatch] != 1 {
+		t.Errorf("POST sent %d times, PATCH %d times; want 1 each",
+			calls[http.MethodPost], calls[http.MethodPatch])
+	}
+}
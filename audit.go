@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// auditLogBackups is how many rotated audit logs (<file>.1 ... <file>.N) are
+// kept; the oldest is dropped on rotation.
+const auditLogBackups = 5
+
+// auditLogger appends one JSON line per credential operation (login,
+// refresh, revoke, export) to an audit log, so shared hosts can trace who
+// minted which token. Entries carry client IDs and outcomes, never token
+// values. The file is opened in append mode for every entry, so several
+// processes can share it; it is rotated once it exceeds maxSize.
+type auditLogger struct {
+	path    string
+	maxSize int64
+
+	user string
+	host string
+
+	mu       sync.Mutex
+	warnOnce sync.Once
+}
+
+// auditEntry is one line of the audit log.
+type auditEntry struct {
+	Time     time.Time `json:"time"`
+	Event    string    `json:"event"`
+	Outcome  string    `json:"outcome"`
+	Error    string    `json:"error,omitempty"`
+	Detail   string    `json:"detail,omitempty"`
+	ClientID string    `json:"client_id,omitempty"`
+	Server   string    `json:"server"`
+	Audience string    `json:"audience,omitempty"`
+	Resource string    `json:"resource,omitempty"`
+	User     string    `json:"user,omitempty"`
+	Host     string    `json:"host,omitempty"`
+	PID      int       `json:"pid"`
+}
+
+// auditLog is the configured audit logger; nil unless -audit-log is set.
+var auditLog *auditLogger
+
+func newAuditLogger(path string, maxSize int64) *auditLogger {
+	l := &auditLogger{path: path, maxSize: maxSize}
+	if u, err := user.Current(); err == nil {
+		l.user = u.Username
+	}
+	l.host, _ = os.Hostname()
+	return l
+}
+
+// record appends an entry for event. err is the operation's outcome; detail
+// adds context such as the revoked token type. Safe to call on a nil logger.
+func (l *auditLogger) record(event, detail string, err error) {
+	if l == nil {
+		return
+	}
+	entry := auditEntry{
+		Time:     time.Now().UTC(),
+		Event:    event,
+		Outcome:  "success",
+		Detail:   detail,
+		ClientID: cfg.ClientID,
+		Server:   cfg.ServerURL,
+		Audience: cfg.Audience,
+		Resource: cfg.Resource,
+		User:     l.user,
+		Host:     l.host,
+		PID:      os.Getpid(),
+	}
+	if err != nil {
+		entry.Outcome = "failure"
+		entry.Error = err.Error()
+	}
+	if err := l.write(entry); err != nil {
+		l.warnOnce.Do(func() {
+			fmt.Fprintf(os.Stderr, "Warning: failed to write audit log %s: %v\n", l.path, err)
+		})
+	}
+}
+
+func (l *auditLogger) write(entry auditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if info, err := os.Stat(l.path); err == nil && info.Size()+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return fmt.Errorf("rotate: %w", err)
+		}
+	}
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// rotate shifts <file>.N-1 to <file>.N, ..., and <file> to <file>.1.
+func (l *auditLogger) rotate() error {
+	for i := auditLogBackups - 1; i >= 1; i-- {
+		src := l.path + "." + strconv.Itoa(i)
+		if _, err := os.Stat(src); err == nil {
+			if err := os.Rename(src, l.path+"."+strconv.Itoa(i+1)); err != nil {
+				return err
+			}
+		}
+	}
+	return os.Rename(l.path, l.path+".1")
+}
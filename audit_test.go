@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAuditLog_RefreshEntries(t *testing.T) {
+	fail := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if fail {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token":"new-access-token","refresh_token":"new-refresh-token",` +
+			`"token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer srv.Close()
+	setTestServer(t, srv)
+	setTokenTestConfig(t, "")
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	origLog := auditLog
+	t.Cleanup(func() { auditLog = origLog })
+	auditLog = newAuditLogger(path, 1<<20)
+
+	if _, err := refreshAccessToken(context.Background(), "old-refresh-token"); err != nil {
+		t.Fatalf("refreshAccessToken() error: %v", err)
+	}
+	fail = true
+	if _, err := refreshAccessToken(context.Background(), "old-refresh-token"); err == nil {
+		t.Fatal("expected refresh failure")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"new-access-token", "new-refresh-token", "old-refresh-token"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("audit log contains token value %q", secret)
+		}
+	}
+
+	var entries []auditEntry
+	sc := bufio.NewScanner(strings.NewReader(string(data)))
+	for sc.Scan() {
+		var e auditEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("invalid audit line %q: %v", sc.Text(), err)
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d audit entries, want 2", len(entries))
+	}
+	if e := entries[0]; e.Event != "refresh" || e.Outcome != "success" || e.ClientID != "test-client" {
+		t.Errorf("first entry = %+v", e)
+	}
+	if e := entries[1]; e.Outcome != "failure" || e.Error == "" {
+		t.Errorf("second entry = %+v, want a failure with its error", e)
+	}
+}
+
+func TestAuditLog_Rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l := newAuditLogger(path, 300)
+	for range 20 {
+		l.record("export", "token command", nil)
+	}
+
+	for i := 1; i <= auditLogBackups; i++ {
+		if _, err := os.Stat(path + "." + strconv.Itoa(i)); err != nil {
+			t.Errorf("missing rotated log %d: %v", i, err)
+		}
+	}
+	if _, err := os.Stat(path + ".6"); !os.IsNotExist(err) {
+		t.Errorf("more than %d rotated logs kept", auditLogBackups)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() > 300 {
+		t.Errorf("current log = %v, %v; want at most 300 bytes", info, err)
+	}
+}
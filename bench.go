@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-authgate/oauth-cli/tui"
+)
+
+// runBench implements `oauth-cli bench refresh`: -concurrency workers refresh
+// the stored token in a loop for -duration, then the request count,
+// throughput and latency percentiles are printed. It is a capacity check for
+// test servers; every request is a real refresh grant.
+func runBench(ctx context.Context) int {
+	if len(os.Args) < 2 || os.Args[1] != "refresh" {
+		fmt.Fprintln(os.Stderr, "Usage: oauth-cli bench refresh [-concurrency N] [-duration D] [flags]")
+		return 2
+	}
+	// Drop the action so the remaining flags parse as usual.
+	os.Args = append(os.Args[:1:1], os.Args[2:]...)
+	initConfig()
+
+	key := tokenKey()
+	tok, err := cfg.TokenStore.Load(key)
+	if err != nil || tok.RefreshToken == "" {
+		fmt.Fprintln(os.Stderr, "Error: no refresh token available; run oauth-cli to log in first")
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "Refreshing against %s with %d workers for %s\n",
+		cfg.ServerURL, cfg.BenchConcurrency, cfg.BenchDuration)
+	res, latest := benchRefresh(ctx, cfg.BenchConcurrency, cfg.BenchDuration, tok.RefreshToken,
+		refreshAccessToken)
+	res.Degraded = tokenBreaker.degraded(clock.Now())
+	writeBenchResult(os.Stdout, res)
+
+	// Keep the stored token usable when the server rotated the refresh token.
+	if latest != nil && latest.RefreshToken != tok.RefreshToken {
+		if err := cfg.TokenStore.Save(key, *latest); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to save rotated refresh token: %v\n", err)
+			return 1
+		}
+	}
+	if res.Requests == 0 || res.Errors == res.Requests {
+		return 1
+	}
+	return 0
+}
+
+// benchResult summarizes a bench run.
+type benchResult struct {
+	Requests  int
+	Errors    int
+	Elapsed   time.Duration
+	Latencies []time.Duration // of successful requests, sorted
+	FirstErr  error
+	Degraded  bool // the token endpoint circuit breaker is open at the end
+}
+
+// benchRefresh runs workers that call refresh until duration has passed or
+// ctx is cancelled, and returns the result and the most recent token
+// obtained. Workers share one refresh token: when the server rotates it, the
+// next requests use the new one. Requests cut short by the end of the run
+// are not counted.
+func benchRefresh(
+	ctx context.Context,
+	workers int,
+	duration time.Duration,
+	refreshToken string,
+	refresh func(context.Context, string) (*tui.TokenStorage, error),
+) (benchResult, *tui.TokenStorage) {
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	var (
+		mu     sync.Mutex
+		res    benchResult
+		latest *tui.TokenStorage
+		wg     sync.WaitGroup
+	)
+	start := time.Now()
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				mu.Lock()
+				rt := refreshToken
+				mu.Unlock()
+
+				t0 := time.Now()
+				storage, err := refresh(ctx, rt)
+				latency := time.Since(t0)
+				if ctx.Err() != nil {
+					return
+				}
+
+				mu.Lock()
+				res.Requests++
+				if err != nil {
+					res.Errors++
+					if res.FirstErr == nil {
+						res.FirstErr = err
+					}
+				} else {
+					res.Latencies = append(res.Latencies, latency)
+					latest = storage
+					if rt == refreshToken {
+						refreshToken = storage.RefreshToken
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	res.Elapsed = time.Since(start)
+	sort.Slice(res.Latencies, func(i, j int) bool { return res.Latencies[i] < res.Latencies[j] })
+	return res, latest
+}
+
+// percentile returns the p-th percentile (0–100) of sorted by the
+// nearest-rank method, or 0 for no samples.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	return sorted[min(max(rank, 0), len(sorted)-1)]
+}
+
+// writeBenchResult prints the summary of a bench run.
+func writeBenchResult(w io.Writer, res benchResult) {
+	var rate float64
+	if res.Elapsed > 0 {
+		rate = float64(res.Requests) / res.Elapsed.Seconds()
+	}
+	fmt.Fprintf(w, "Requests:   %d in %s (%.1f/s)\n",
+		res.Requests, res.Elapsed.Round(time.Millisecond), rate)
+	fmt.Fprintf(w, "Errors:     %d\n", res.Errors)
+	if len(res.Latencies) > 0 {
+		fmt.Fprintf(w, "Latency:    p50 %s  p90 %s  p99 %s  max %s\n",
+			percentile(res.Latencies, 50).Round(time.Millisecond),
+			percentile(res.Latencies, 90).Round(time.Millisecond),
+			percentile(res.Latencies, 99).Round(time.Millisecond),
+			res.Latencies[len(res.Latencies)-1].Round(time.Millisecond))
+	}
+	if res.FirstErr != nil {
+		msg := res.FirstErr.Error()
+		if errors.Is(res.FirstErr, tui.ErrRefreshTokenExpired) {
+			msg += " (rotating refresh tokens cannot be shared by concurrent workers)"
+		}
+		fmt.Fprintf(w, "First error: %s\n", msg)
+	}
+	if res.Degraded {
+		fmt.Fprintln(w, "Status:     degraded (token requests paused by -breaker-failures)")
+	}
+}
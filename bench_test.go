@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-authgate/oauth-cli/tui"
+)
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{50, 50 * time.Millisecond},
+		{90, 90 * time.Millisecond},
+		{99, 99 * time.Millisecond},
+		{100, 100 * time.Millisecond},
+		{0, time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := percentile(sorted, tt.p); got != tt.want {
+			t.Errorf("percentile(%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("percentile(nil) = %v, want 0", got)
+	}
+}
+
+func TestBenchRefresh_FollowsRotation(t *testing.T) {
+	var n atomic.Int64
+	refresh := func(_ context.Context, rt string) (*tui.TokenStorage, error) {
+		i := n.Add(1)
+		if i%5 == 0 {
+			return nil, errors.New("server_error")
+		}
+		time.Sleep(time.Millisecond)
+		return &tui.TokenStorage{AccessToken: "a", RefreshToken: "rt-" + strconv.FormatInt(i, 10)}, nil
+	}
+
+	res, latest := benchRefresh(context.Background(), 4, 50*time.Millisecond, "rt-0", refresh)
+	if res.Requests == 0 {
+		t.Fatal("no requests counted")
+	}
+	if res.Errors == 0 || res.FirstErr == nil {
+		t.Errorf("Errors = %d, FirstErr = %v; want the failures counted", res.Errors, res.FirstErr)
+	}
+	if len(res.Latencies) != res.Requests-res.Errors {
+		t.Errorf("latencies = %d, want %d", len(res.Latencies), res.Requests-res.Errors)
+	}
+	for i := 1; i < len(res.Latencies); i++ {
+		if res.Latencies[i] < res.Latencies[i-1] {
+			t.Fatal("latencies not sorted")
+		}
+	}
+	if latest == nil || latest.RefreshToken == "rt-0" {
+		t.Errorf("latest = %+v, want a rotated token", latest)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// errTokenEndpointDegraded is returned without contacting the server while
+// the token endpoint circuit breaker is open.
+var errTokenEndpointDegraded = errors.New("token endpoint degraded")
+
+// circuitBreaker stops token requests after threshold consecutive failures
+// (every endpoint unreachable or answering 5xx once retries are exhausted),
+// so a process refreshing many tokens during an outage fails fast instead of
+// multiplying retries. After cooldown a single request probes the server; an
+// answer closes the breaker and a failure opens it for another cooldown. Any
+// HTTP answer below 500, OAuth errors included, counts as an answer.
+type circuitBreaker struct {
+	threshold int // 0 disables the breaker
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// tokenBreaker guards postTokenRequest.
+var tokenBreaker = &circuitBreaker{}
+
+// allow reports whether a request may be sent at now. While the breaker is
+// open it returns an error wrapping errTokenEndpointDegraded. Every allowed
+// request must be followed by done.
+func (b *circuitBreaker) allow(now time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.threshold <= 0 || b.failures < b.threshold {
+		return nil
+	}
+	if now.Before(b.openUntil) || b.probing {
+		return fmt.Errorf("%w after %d consecutive failures; next attempt in %s",
+			errTokenEndpointDegraded, b.failures, max(b.openUntil.Sub(now), 0).Round(time.Second))
+	}
+	b.probing = true
+	return nil
+}
+
+// done ends a request allowed by allow. answered means the server sent an
+// HTTP response below 500, unreachable that it did not; neither (a local
+// error or a cancelled request) tells nothing about the server.
+func (b *circuitBreaker) done(now time.Time, answered, unreachable bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if b.threshold <= 0 {
+		return
+	}
+	switch {
+	case answered:
+		b.failures = 0
+	case unreachable:
+		b.failures++
+		if b.failures == b.threshold {
+			fmt.Fprintf(os.Stderr, "Warning: %v after %d consecutive failures; "+
+				"pausing token requests for %s\n", errTokenEndpointDegraded, b.failures, b.cooldown)
+		}
+		if b.failures >= b.threshold {
+			b.openUntil = now.Add(b.cooldown)
+		}
+	}
+}
+
+// degraded reports whether the breaker is open at now.
+func (b *circuitBreaker) degraded(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.threshold > 0 && b.failures >= b.threshold && now.Before(b.openUntil)
+}
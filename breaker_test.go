@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-authgate/oauth-cli/tui"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b := &circuitBreaker{threshold: 2, cooldown: 30 * time.Second}
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for range 2 {
+		if err := b.allow(at); err != nil {
+			t.Fatalf("allow() before threshold: %v", err)
+		}
+		b.done(at, false, true)
+	}
+	if err := b.allow(at.Add(29 * time.Second)); !errors.Is(err, errTokenEndpointDegraded) {
+		t.Fatalf("allow() during cooldown = %v, want errTokenEndpointDegraded", err)
+	}
+	if !b.degraded(at) {
+		t.Error("degraded() = false while open")
+	}
+
+	// One probe after the cooldown; others wait for its outcome.
+	probe := at.Add(30 * time.Second)
+	if err := b.allow(probe); err != nil {
+		t.Fatalf("probe allow(): %v", err)
+	}
+	if err := b.allow(probe); !errors.Is(err, errTokenEndpointDegraded) {
+		t.Errorf("second allow() during probe = %v, want errTokenEndpointDegraded", err)
+	}
+	b.done(probe, false, true)
+	if err := b.allow(probe.Add(time.Second)); !errors.Is(err, errTokenEndpointDegraded) {
+		t.Fatalf("allow() after failed probe = %v, want errTokenEndpointDegraded", err)
+	}
+
+	// A cancelled probe does not count; an answered one closes the breaker.
+	probe = probe.Add(30 * time.Second)
+	if err := b.allow(probe); err != nil {
+		t.Fatalf("probe allow(): %v", err)
+	}
+	b.done(probe, false, false)
+	if err := b.allow(probe); err != nil {
+		t.Fatalf("allow() after cancelled probe: %v", err)
+	}
+	b.done(probe, true, false)
+	if err := b.allow(probe); err != nil || b.degraded(probe) {
+		t.Errorf("allow() after answered probe = %v, degraded = %v", err, b.degraded(probe))
+	}
+}
+
+func TestPostTokenRequest_Breaker(t *testing.T) {
+	var requests int
+	status := http.StatusServiceUnavailable
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	setTestServer(t, srv)
+	setTokenTestConfig(t, "")
+	fc := setFakeClock(t, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	orig := tokenBreaker
+	t.Cleanup(func() { tokenBreaker = orig })
+	tokenBreaker = &circuitBreaker{threshold: 2, cooldown: time.Minute}
+
+	ctx := context.Background()
+	for range 2 {
+		if _, err := refreshAccessToken(ctx, "refresh"); err == nil {
+			t.Fatal("refreshAccessToken() against a failing server succeeded")
+		}
+	}
+	_, err := refreshAccessToken(ctx, "refresh")
+	if !errors.Is(err, errTokenEndpointDegraded) || errors.Is(err, tui.ErrServerUnreachable) {
+		t.Errorf("refreshAccessToken() while open = %v, want degraded and not unreachable", err)
+	}
+	if requests != 2 {
+		t.Errorf("server saw %d requests, want 2", requests)
+	}
+
+	fc.Advance(time.Minute)
+	status = http.StatusBadRequest
+	resp, _, err := postTokenRequest(ctx, url.Values{}, tokenKey())
+	if err != nil {
+		t.Fatalf("probe postTokenRequest(): %v", err)
+	}
+	resp.Body.Close()
+	if tokenBreaker.degraded(clock.Now()) {
+		t.Error("breaker still open after the server answered")
+	}
+}
@@ -2,21 +2,30 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os/exec"
 	"runtime"
+	"strings"
 )
 
-// openBrowser attempts to open url in the user's default browser.
+// openBrowser attempts to open url in the user's default browser, or in
+// -browser with -browser-profile and -browser-args.
 // Returns an error if launching the browser fails, but callers should
 // always print the URL as a fallback regardless of the error.
 func openBrowser(ctx context.Context, url string) error {
 	var cmd *exec.Cmd
 
-	switch runtime.GOOS {
-	case "darwin":
+	switch {
+	case cfg.BrowserApp != "":
+		name, args, err := browserCommand(runtime.GOOS, cfg.BrowserApp, cfg.BrowserProfile, cfg.BrowserArgs, url)
+		if err != nil {
+			return fmt.Errorf("failed to open browser: %w", err)
+		}
+		cmd = exec.CommandContext(ctx, name, args...)
+	case runtime.GOOS == "darwin":
 		cmd = exec.CommandContext(ctx, "open", url)
-	case "windows":
+	case runtime.GOOS == "windows":
 		cmd = exec.CommandContext(ctx, "cmd", "/c", "start", url)
 	default:
 		// Linux and other Unix-like systems
@@ -32,3 +41,99 @@ func openBrowser(ctx context.Context, url string) error {
 
 	return nil
 }
+
+// knownBrowser describes how to launch a browser -browser names, per OS,
+// and how it selects a profile.
+type knownBrowser struct {
+	linux   []string // executables, tried in order
+	macApp  string   // application name for `open -a`
+	windows string   // name `start` resolves through App Paths
+	firefox bool     // -P <profile> instead of Chromium's --profile-directory
+}
+
+var knownBrowsers = map[string]knownBrowser{
+	"chrome": {
+		linux:   []string{"google-chrome", "google-chrome-stable"},
+		macApp:  "Google Chrome",
+		windows: "chrome",
+	},
+	"chromium": {
+		linux:   []string{"chromium", "chromium-browser"},
+		macApp:  "Chromium",
+		windows: "chromium",
+	},
+	"edge": {
+		linux:   []string{"microsoft-edge", "microsoft-edge-stable"},
+		macApp:  "Microsoft Edge",
+		windows: "msedge",
+	},
+	"brave": {
+		linux:   []string{"brave-browser", "brave"},
+		macApp:  "Brave Browser",
+		windows: "brave",
+	},
+	"firefox": {
+		linux:   []string{"firefox"},
+		macApp:  "Firefox",
+		windows: "firefox",
+		firefox: true,
+	},
+}
+
+// validateBrowser checks the -browser, -browser-profile and -browser-args
+// combination: profiles and arguments need a browser to pass them to, and a
+// profile needs one whose profile option is known.
+func validateBrowser(app, profile string, args []string) error {
+	if app == "" {
+		if profile != "" || len(args) > 0 {
+			return errors.New("-browser-profile and -browser-args need -browser")
+		}
+		return nil
+	}
+	if _, ok := knownBrowsers[app]; !ok && profile != "" {
+		return fmt.Errorf("-browser-profile needs -browser to be chrome, chromium, edge, brave "+
+			"or firefox, not %q; pass the profile option of %s with -browser-args", app, app)
+	}
+	return nil
+}
+
+// browserCommand returns the command that opens url in browser on goos. A
+// browser not in knownBrowsers is run as a command. The profile option comes
+// first, then args (e.g. --incognito or -private-window), then url.
+func browserCommand(
+	goos, browser, profile string,
+	args []string,
+	url string,
+) (string, []string, error) {
+	known, ok := knownBrowsers[browser]
+	var opts []string
+	if profile != "" {
+		if known.firefox {
+			opts = append(opts, "-P", profile)
+		} else {
+			opts = append(opts, "--profile-directory="+profile)
+		}
+	}
+	opts = append(append(opts, args...), url)
+
+	if !ok {
+		return browser, opts, nil
+	}
+	switch goos {
+	case "darwin":
+		// -n starts a new instance so the options are not dropped when the
+		// browser is already running; the instance hands off to it.
+		return "open", append([]string{"-na", known.macApp, "--args"}, opts...), nil
+	case "windows":
+		// The empty argument is start's window title.
+		return "cmd", append([]string{"/c", "start", "", known.windows}, opts...), nil
+	default:
+		for _, name := range known.linux {
+			if path, err := exec.LookPath(name); err == nil {
+				return path, opts, nil
+			}
+		}
+		return "", nil, fmt.Errorf("%s not found (looked for %s)",
+			browser, strings.Join(known.linux, ", "))
+	}
+}
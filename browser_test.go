@@ -0,0 +1,65 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestBrowserCommand(t *testing.T) {
+	const url = "https://auth.example.com/authorize"
+	tests := []struct {
+		goos, browser, profile string
+		args                   []string
+		wantName               string
+		wantArgs               []string
+	}{
+		{
+			goos: "darwin", browser: "chrome", profile: "Profile 2", args: []string{"--incognito"},
+			wantName: "open",
+			wantArgs: []string{"-na", "Google Chrome", "--args",
+				"--profile-directory=Profile 2", "--incognito", url},
+		},
+		{
+			goos: "windows", browser: "firefox", profile: "work", args: []string{"-private-window"},
+			wantName: "cmd",
+			wantArgs: []string{"/c", "start", "", "firefox", "-P", "work", "-private-window", url},
+		},
+		{
+			goos: "linux", browser: "/opt/browser/bin/run", args: []string{"--new-window"},
+			wantName: "/opt/browser/bin/run",
+			wantArgs: []string{"--new-window", url},
+		},
+	}
+	for _, tt := range tests {
+		name, args, err := browserCommand(tt.goos, tt.browser, tt.profile, tt.args, url)
+		if err != nil {
+			t.Errorf("browserCommand(%s, %s) error = %v", tt.goos, tt.browser, err)
+			continue
+		}
+		if name != tt.wantName || !slices.Equal(args, tt.wantArgs) {
+			t.Errorf("browserCommand(%s, %s) = %s %q, want %s %q",
+				tt.goos, tt.browser, name, args, tt.wantName, tt.wantArgs)
+		}
+	}
+}
+
+func TestValidateBrowser(t *testing.T) {
+	tests := []struct {
+		app, profile string
+		args         []string
+		wantErr      bool
+	}{
+		{app: "", wantErr: false},
+		{app: "chrome", profile: "Default", wantErr: false},
+		{app: "my-browser", args: []string{"--private"}, wantErr: false},
+		{app: "", profile: "Default", wantErr: true},
+		{app: "", args: []string{"--incognito"}, wantErr: true},
+		{app: "my-browser", profile: "Default", wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := validateBrowser(tt.app, tt.profile, tt.args); (err != nil) != tt.wantErr {
+			t.Errorf("validateBrowser(%q, %q, %q) error = %v, wantErr %v",
+				tt.app, tt.profile, tt.args, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// runCall implements `oauth-cli call METHOD PATH`: it sends an API request
+// with the stored access token (refreshing it first if it has expired, and
+// once more on a 401) and prints the response body to stdout, preceded by the
+// status line and headers with -i. PATH is resolved against -api-url unless
+// it is an absolute URL on the same origin (or any origin with -any-origin).
+// It exits 1 when the response status is 400 or above.
+func runCall(ctx context.Context) int {
+	flagArgs, positional := splitPositional(os.Args[1:])
+	os.Args = append(os.Args[:1:1], flagArgs...)
+	initConfig()
+
+	if len(positional) != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: oauth-cli call [flags] METHOD PATH")
+		return 2
+	}
+	method := strings.ToUpper(positional[0])
+	target, err := apiRequestURL(positional[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	body, err := readRequestData(cfg.CallData, os.Stdin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	header := http.Header{}
+	if json.Valid(body) {
+		header.Set("Content-Type", "application/json")
+	}
+
+	storage, err := tokenForAudience(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	resp, err := callAPI(ctx, storage, method, target, body, apiCallOptions{header: header})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	if cfg.CallInclude {
+		writeResponseHead(os.Stdout, resp)
+	}
+	if _, err := io.Copy(os.Stdout, resp.Body); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to read response: %v\n", err)
+		return 1
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		fmt.Fprintf(os.Stderr, "Error: %s %s returned status %d\n", method, target, resp.StatusCode)
+		return 1
+	}
+	return 0
+}
+
+// splitPositional separates non-flag arguments from flags (with their values)
+// so flags may follow METHOD and PATH, as in `call GET /users -i`.
+func splitPositional(args []string) (flags, positional []string) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			return flags, append(positional, args[i+1:]...)
+		case len(arg) < 2 || arg[0] != '-':
+			positional = append(positional, arg)
+		default:
+			flags = append(flags, arg)
+			name := strings.TrimLeft(arg, "-")
+			if strings.Contains(name, "=") {
+				continue
+			}
+			f := flag.Lookup(name)
+			if f == nil {
+				continue
+			}
+			if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+				continue
+			}
+			if i+1 < len(args) {
+				i++
+				flags = append(flags, args[i])
+			}
+		}
+	}
+	return flags, positional
+}
+
+// apiRequestURL resolves path against cfg.APIURL. Absolute URLs are used as-is
+// when they share cfg.APIURL's scheme and host, so the access token is not sent
+// to another origin by mistake; cfg.CallAnyOrigin lifts that restriction.
+func apiRequestURL(path string) (string, error) {
+	if isEndpointURL(path) {
+		if !cfg.CallAnyOrigin && !sameOrigin(path, cfg.APIURL) {
+			return "", fmt.Errorf("%s is not on the -api-url origin %s; "+
+				"pass -any-origin to send the access token there", path, cfg.APIURL)
+		}
+		return path, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return strings.TrimSuffix(cfg.APIURL, "/") + path, nil
+}
+
+// sameOrigin reports whether the URLs a and b have the same scheme and host.
+func sameOrigin(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(ua.Scheme, ub.Scheme) && strings.EqualFold(ua.Host, ub.Host)
+}
+
+// readRequestData returns the request body for -data: the value itself, the
+// contents of the file named after "@", or stdin for "@-". It returns nil
+// when data is empty.
+func readRequestData(data string, stdin io.Reader) ([]byte, error) {
+	switch {
+	case data == "":
+		return nil, nil
+	case data == "@-":
+		return io.ReadAll(stdin)
+	case strings.HasPrefix(data, "@"):
+		body, err := os.ReadFile(data[1:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read -data file: %w", err)
+		}
+		return body, nil
+	default:
+		return []byte(data), nil
+	}
+}
+
+// writeResponseHead prints the status line and headers of resp, followed by
+// a blank line, like curl -i.
+func writeResponseHead(w io.Writer, resp *http.Response) {
+	fmt.Fprintf(w, "%s %s\n", resp.Proto, resp.Status)
+	names := make([]string, 0, len(resp.Header))
+	for name := range resp.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range resp.Header[name] {
+			fmt.Fprintf(w, "%s: %s\n", name, v)
+		}
+	}
+	fmt.Fprintln(w)
+}
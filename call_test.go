@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSplitPositional(t *testing.T) {
+	flags, positional := splitPositional([]string{
+		"-i", "POST", "/api/v1/users", "-data", "@body.json", "-scope=read write", "--", "-odd",
+	})
+	if want := []string{"-i", "-data", "@body.json", "-scope=read write"}; !slices.Equal(flags, want) {
+		t.Errorf("flags = %q, want %q", flags, want)
+	}
+	if want := []string{"POST", "/api/v1/users", "-odd"}; !slices.Equal(positional, want) {
+		t.Errorf("positional = %q, want %q", positional, want)
+	}
+}
+
+func TestAPIRequestURL(t *testing.T) {
+	orig := cfg.APIURL
+	t.Cleanup(func() { cfg.APIURL = orig })
+	cfg.APIURL = "https://api.example.com/"
+
+	for path, want := range map[string]string{
+		"/api/v1/users":                   "https://api.example.com/api/v1/users",
+		"api/v1/users?page=2":             "https://api.example.com/api/v1/users?page=2",
+		"https://API.example.com/v2/ping": "https://API.example.com/v2/ping",
+	} {
+		if got, err := apiRequestURL(path); err != nil || got != want {
+			t.Errorf("apiRequestURL(%q) = %q, %v; want %q", path, got, err, want)
+		}
+	}
+
+	for _, path := range []string{"https://other.test/ping", "http://api.example.com/ping"} {
+		if got, err := apiRequestURL(path); err == nil {
+			t.Errorf("apiRequestURL(%q) = %q, want an error for another origin", path, got)
+		}
+	}
+
+	origAny := cfg.CallAnyOrigin
+	t.Cleanup(func() { cfg.CallAnyOrigin = origAny })
+	cfg.CallAnyOrigin = true
+	if got, err := apiRequestURL("https://other.test/ping"); err != nil ||
+		got != "https://other.test/ping" {
+		t.Errorf("with -any-origin apiRequestURL() = %q, %v", got, err)
+	}
+}
+
+func TestReadRequestData(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "body.json")
+	if err := os.WriteFile(file, []byte(`{"name":"alice"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	stdin := strings.NewReader("from stdin")
+
+	for data, want := range map[string]string{
+		"":         "",
+		"a=1&b=2":  "a=1&b=2",
+		"@" + file: `{"name":"alice"}`,
+		"@-":       "from stdin",
+	} {
+		got, err := readRequestData(data, stdin)
+		if err != nil || string(got) != want {
+			t.Errorf("readRequestData(%q) = %q, %v; want %q", data, got, err, want)
+		}
+	}
+	if _, err := readRequestData("@"+filepath.Join(t.TempDir(), "missing"), stdin); err == nil {
+		t.Error("readRequestData() of a missing file succeeded")
+	}
+}
+
+func TestWriteResponseHead(t *testing.T) {
+	resp := &http.Response{
+		Proto:  "HTTP/1.1",
+		Status: "404 Not Found",
+		Header: http.Header{"X-Request-Id": {"abc"}, "Content-Type": {"application/json"}},
+	}
+	var b strings.Builder
+	writeResponseHead(&b, resp)
+	want := "HTTP/1.1 404 Not Found\nContent-Type: application/json\nX-Request-Id: abc\n\n"
+	if b.String() != want {
+		t.Errorf("writeResponseHead() = %q, want %q", b.String(), want)
+	}
+}
@@ -3,26 +3,70 @@ package main
 import (
 	"context"
 	"crypto/subtle"
+	"encoding/json"
 	"fmt"
 	"html"
 	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-authgate/oauth-cli/tui"
 )
 
 const (
-	// callbackTimeout is how long we wait for the browser to deliver the code.
-	callbackTimeout = 5 * time.Minute
+	// defaultCallbackTimeout is how long we wait for the browser to deliver
+	// the code unless -callback-timeout says otherwise.
+	defaultCallbackTimeout = 5 * time.Minute
 
 	// callbackWriteTimeout is the HTTP write deadline for the callback handler.
 	// It must exceed tokenExchangeTimeout to ensure the exchange result can be
 	// written back to the browser before the connection times out.
 	callbackWriteTimeout = 30 * time.Second
+
+	// callbackPath is the route the callback server handles.
+	callbackPath = "/callback"
+
+	// callbackHost is the address the callback server binds.
+	callbackHost = "127.0.0.1"
 )
 
+// validateRedirectURI checks that the browser will be sent back to this
+// process's callback server: a loopback http URI on port with the callback
+// path. A mismatch would otherwise only show up as a callback timeout.
+func validateRedirectURI(raw string, port int) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" {
+		return fmt.Errorf("scheme must be http for the local callback server, got %q", u.Scheme)
+	}
+	switch host := u.Hostname(); host {
+	case "localhost", callbackHost:
+	case "::1":
+		return fmt.Errorf("host %s is not served; the callback server listens on %s only",
+			host, callbackHost)
+	default:
+		return fmt.Errorf("host %q is not loopback; use localhost or %s", host, callbackHost)
+	}
+	if got := u.Port(); got != strconv.Itoa(port) {
+		if got == "" {
+			got = "none (80)"
+		}
+		return fmt.Errorf("port %s does not match the callback port %d (-port / CALLBACK_PORT)",
+			got, port)
+	}
+	if u.Path != callbackPath {
+		return fmt.Errorf("path %q does not match the callback route %s", u.Path, callbackPath)
+	}
+	return nil
+}
+
 // callbackResult holds the outcome of the local callback round-trip.
 type callbackResult struct {
 	Storage *tui.TokenStorage
@@ -30,143 +74,311 @@ type callbackResult struct {
 	Desc    string
 }
 
+// unwrap converts the result into the (storage, error) pair returned to callers.
+func (r callbackResult) unwrap() (*tui.TokenStorage, error) {
+	if r.Error != "" {
+		if r.Desc != "" {
+			return nil, fmt.Errorf("%s: %s", r.Error, r.Desc)
+		}
+		return nil, fmt.Errorf("%s", r.Error)
+	}
+	return r.Storage, nil
+}
+
 // startCallbackServer starts a local HTTP server on the given port and waits
 // for the OAuth callback. It validates the returned state against expectedState,
 // then calls exchangeFn with the received authorization code. The HTTP response
 // is held open until exchangeFn returns so the browser reflects the true outcome.
 //
+// exchangeFn runs under ctx rather than the request context, so a browser that
+// disconnects mid-exchange does not abort the token request. Once an exchange
+// has started it is also shielded from ctx cancellation: the authorization code
+// is single-use, so abandoning the exchange would lose the user's grant.
+//
 // The server shuts itself down after the first request or when ctx is cancelled.
+// If ctx is cancelled while an exchange is in flight, startCallbackServer waits
+// for it to finish and returns its result.
 func startCallbackServer(
 	ctx context.Context,
 	port int,
 	expectedState string,
 	exchangeFn func(ctx context.Context, code string) (*tui.TokenStorage, error),
 ) (*tui.TokenStorage, error) {
-	resultCh := make(chan callbackResult, 1)
+	cs, err := newCallbackServer(ctx, port, expectedState, exchangeFn)
+	if err != nil {
+		return nil, err
+	}
+	defer cs.Close()
+
+	if cfg.ListenURLFile != "" {
+		err := writeListenURLFile(cfg.ListenURLFile, cs.callbackURL(), expectedState)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write listen URL file: %w", err)
+		}
+		defer os.Remove(cfg.ListenURLFile)
+	}
+	return cs.Wait(ctx)
+}
+
+// listenInfo is the document -listen-url-file receives once the callback
+// listener accepts connections, for editor plugins that drive the flow.
+type listenInfo struct {
+	CallbackURL string `json:"callback_url"`
+	RedirectURI string `json:"redirect_uri"`
+	State       string `json:"state"`
+	PID         int    `json:"pid"`
+}
+
+// writeListenURLFile atomically writes the listen info to path (mode 0600,
+// as the state is a CSRF secret). The file is removed when the listener
+// closes, so its presence means a callback can be delivered.
+func writeListenURLFile(path, callbackURL, state string) error {
+	data, err := json.MarshalIndent(listenInfo{
+		CallbackURL: callbackURL,
+		RedirectURI: sentRedirectURI(),
+		State:       state,
+		PID:         os.Getpid(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileSync(path, append(data, '\n'))
+}
+
+// callbackServer is the local listener of one authorization. Callbacks
+// carrying its state are exchanged with exchangeFn, which holds the PKCE
+// verifier.
+type callbackServer struct {
+	srv  *http.Server
+	addr string // bound host:port
 
-	// sendResult delivers the result exactly once. Any concurrent or subsequent
+	ctx        context.Context
+	state      string
+	exchangeFn func(ctx context.Context, code string) (*tui.TokenStorage, error)
+	resultCh   chan callbackResult
+
+	// sendOnce delivers the result exactly once. Any concurrent or subsequent
 	// invocations (e.g. a browser retry or automated agent) are silently
 	// discarded, preventing a goroutine from blocking forever on the send.
-	var once sync.Once
-	sendResult := func(r callbackResult) {
-		once.Do(func() { resultCh <- r })
-	}
+	sendOnce sync.Once
 
 	// exchangeOnce ensures the token exchange runs at most once even when the
 	// browser retries the callback request.
-	var (
-		exchangeOnce    sync.Once
-		exchangeStorage *tui.TokenStorage
-		exchangeErr     error
-	)
-
-	mux := http.NewServeMux()
-	mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
-		q := r.URL.Query()
-
-		// Check for OAuth error response first.
-		if oauthErr := q.Get("error"); oauthErr != "" {
-			desc := q.Get("error_description")
-			writeCallbackPage(w, false, oauthErr, desc)
-			sendResult(callbackResult{Error: oauthErr, Desc: desc})
-			return
-		}
-
-		// Validate state (CSRF protection) using constant-time comparison.
-		state := q.Get("state")
-		if len(state) != len(expectedState) ||
-			subtle.ConstantTimeCompare([]byte(state), []byte(expectedState)) != 1 {
-			writeCallbackPage(w, false, "state_mismatch",
-				"State parameter does not match. Possible CSRF attack.")
-			sendResult(callbackResult{
-				Error: "state_mismatch",
-				Desc:  "state parameter mismatch",
-			})
-			return
-		}
-
-		code := q.Get("code")
-		if code == "" {
-			writeCallbackPage(w, false, "missing_code", "No authorization code in callback.")
-			sendResult(callbackResult{Error: "missing_code", Desc: "code parameter missing"})
-			return
-		}
+	exchangeOnce    sync.Once
+	exchanging      atomic.Bool
+	exchangeStorage *tui.TokenStorage
+	exchangeErr     error
+}
 
-		// Hold the HTTP response open while exchanging the code for tokens so
-		// the browser reflects the true outcome (success or failure).
-		exchangeOnce.Do(func() {
-			exchangeStorage, exchangeErr = exchangeFn(r.Context(), code)
-		})
-		if exchangeErr != nil {
-			writeCallbackPage(w, false, "token_exchange_failed", exchangeErr.Error())
-			sendResult(callbackResult{Error: "token_exchange_failed", Desc: exchangeErr.Error()})
-			return
-		}
+func (cs *callbackServer) sendResult(r callbackResult) {
+	cs.sendOnce.Do(func() { cs.resultCh <- r })
+}
 
-		writeCallbackPage(w, true, "", "")
-		sendResult(callbackResult{Storage: exchangeStorage})
-	})
+// newCallbackServer binds 127.0.0.1:port and starts serving the callback for
+// state. exchangeFn is invoked with a context derived from ctx.
+func newCallbackServer(
+	ctx context.Context,
+	port int,
+	state string,
+	exchangeFn func(ctx context.Context, code string) (*tui.TokenStorage, error),
+) (*callbackServer, error) {
+	cs := &callbackServer{
+		ctx:        ctx,
+		state:      state,
+		exchangeFn: exchangeFn,
+		resultCh:   make(chan callbackResult, 1),
+	}
 
-	srv := &http.Server{
-		Addr:         fmt.Sprintf("127.0.0.1:%d", port),
-		Handler:      mux,
+	cs.srv = &http.Server{
+		Addr:         net.JoinHostPort(callbackHost, strconv.Itoa(port)),
+		Handler:      cs,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: callbackWriteTimeout,
 	}
 
 	// Use a listener so we can report the actual bound port.
-	ln, err := (&net.ListenConfig{}).Listen(ctx, "tcp", srv.Addr)
+	ln, err := (&net.ListenConfig{}).Listen(ctx, "tcp", cs.srv.Addr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to start callback server on port %d: %w", port, err)
 	}
 
-	// Serve in background; shut down after receiving the result.
+	cs.addr = ln.Addr().String()
+
 	go func() {
-		_ = srv.Serve(ln)
+		_ = cs.srv.Serve(ln)
 	}()
+	return cs, nil
+}
 
-	defer func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-		defer cancel()
-		_ = srv.Shutdown(ctx)
-	}()
+// callbackURL returns the URL of the callback route on the bound listener.
+func (cs *callbackServer) callbackURL() string {
+	return "http://" + cs.addr + callbackPath
+}
 
-	// Wait for callback, timeout, or context cancellation.
-	timer := time.NewTimer(callbackTimeout)
+// ServeHTTP dispatches the callback route and answers every other path with a
+// bare 404, so probes of the local port learn nothing. Each request is
+// logged to the debug log; the query is omitted because it carries the code
+// and state.
+func (cs *callbackServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != callbackPath {
+		debugf("callback server: %s %s from %s (%q): 404", r.Method, r.URL.Path,
+			r.RemoteAddr, r.UserAgent())
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	debugf("callback server: %s %s from %s (%q)", r.Method, r.URL.Path, r.RemoteAddr, r.UserAgent())
+	cs.handleCallback(w, r)
+}
+
+// Wait blocks until the callback is handled, cfg.CallbackTimeout elapses, or
+// ctx is cancelled. An exchange already in flight when ctx is cancelled is
+// allowed to finish and its result is returned.
+func (cs *callbackServer) Wait(ctx context.Context) (*tui.TokenStorage, error) {
+	timer := time.NewTimer(cfg.CallbackTimeout)
 	defer timer.Stop()
 
 	select {
-	case result := <-resultCh:
-		if result.Error != "" {
-			if result.Desc != "" {
-				return nil, fmt.Errorf("%s: %s", result.Error, result.Desc)
-			}
-			return nil, fmt.Errorf("%s", result.Error)
-		}
-		return result.Storage, nil
+	case result := <-cs.resultCh:
+		return result.unwrap()
 
 	case <-ctx.Done():
+		// An in-flight exchange always delivers a result, so waiting is bounded
+		// by the exchange's own timeout.
+		if cs.exchanging.Load() {
+			return (<-cs.resultCh).unwrap()
+		}
 		return nil, ctx.Err()
 
 	case <-timer.C:
-		return nil, fmt.Errorf("timed out waiting for browser authorization (%s)", callbackTimeout)
+		return nil, fmt.Errorf("timed out waiting for browser authorization (%s)",
+			cfg.CallbackTimeout)
+	}
+}
+
+// Close shuts the listener down, giving in-progress responses a moment to finish.
+func (cs *callbackServer) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_ = cs.srv.Shutdown(ctx)
+}
+
+func (cs *callbackServer) handleCallback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	// Mix-up defense (RFC 9207): when the server advertises the iss parameter,
+	// a response without it or from another issuer is rejected before
+	// anything in it, including an error, is acted on.
+	if cfg.ExpectedIssuer != "" && q.Get("iss") != cfg.ExpectedIssuer {
+		writeCallbackPage(w, false, "issuer_mismatch",
+			"The authorization response did not come from the expected server.")
+		cs.sendResult(callbackResult{
+			Error: "issuer_mismatch",
+			Desc:  fmt.Sprintf("iss %q does not match issuer %q", q.Get("iss"), cfg.ExpectedIssuer),
+		})
+		return
+	}
+
+	// Check for OAuth error response first.
+	if oauthErr := q.Get("error"); oauthErr != "" {
+		desc := q.Get("error_description")
+		writeCallbackPage(w, false, oauthErr, desc)
+		cs.sendResult(callbackResult{Error: oauthErr, Desc: desc})
+		return
+	}
+
+	// Validate state (CSRF protection) using constant-time comparison.
+	state := q.Get("state")
+	if len(state) != len(cs.state) ||
+		subtle.ConstantTimeCompare([]byte(state), []byte(cs.state)) != 1 {
+		writeCallbackPage(w, false, "state_mismatch",
+			"State parameter does not match. Possible CSRF attack.")
+		cs.sendResult(callbackResult{
+			Error: "state_mismatch",
+			Desc:  "state parameter mismatch",
+		})
+		return
 	}
+
+	// Signed states additionally carry their issue time; reject stale ones.
+	if cfg.StateKey != nil {
+		_, err := verifySignedState(cfg.StateKey, state, cfg.StateMaxAge, clock.Now())
+		if err != nil {
+			writeCallbackPage(w, false, "invalid_state",
+				"The authorization request is no longer valid. Please start the login again.")
+			cs.sendResult(callbackResult{Error: "invalid_state", Desc: err.Error()})
+			return
+		}
+	}
+
+	code := q.Get("code")
+	if code == "" {
+		writeCallbackPage(w, false, "missing_code", "No authorization code in callback.")
+		cs.sendResult(callbackResult{Error: "missing_code", Desc: "code parameter missing"})
+		return
+	}
+
+	// Hold the HTTP response open while exchanging the code for tokens so
+	// the browser reflects the true outcome (success or failure). The
+	// exchange is bound to the flow's context, not r.Context(), which is
+	// cancelled as soon as the browser closes the connection.
+	cs.exchangeOnce.Do(func() {
+		cs.exchanging.Store(true)
+		cs.exchangeStorage, cs.exchangeErr = cs.exchangeFn(context.WithoutCancel(cs.ctx), code)
+	})
+	if cs.exchangeErr != nil {
+		writeCallbackPage(w, false, "token_exchange_failed", cs.exchangeErr.Error())
+		cs.sendResult(callbackResult{Error: "token_exchange_failed", Desc: cs.exchangeErr.Error()})
+		return
+	}
+
+	if cfg.ConfirmIdentity {
+		writeConfirmIdentityPage(w, tokenSubject(cs.exchangeStorage))
+	} else {
+		writeCallbackPage(w, true, "", "")
+	}
+	cs.sendResult(callbackResult{Storage: cs.exchangeStorage})
+}
+
+// writeConfirmIdentityPage tells the browser which account signed in when
+// -confirm-identity holds the tokens until the user confirms in the terminal.
+func writeConfirmIdentityPage(w http.ResponseWriter, subject string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html lang="%s">
+<head><title>%s</title></head>
+<body style="font-family:sans-serif;text-align:center;padding:4rem">
+  <h1>%s</h1>
+  <p>%s</p>
+  <p>%s</p>
+</body>
+</html>`,
+		tui.Language(),
+		html.EscapeString(tui.T("page.confirm.title")),
+		html.EscapeString(tui.T("page.confirm.heading", subject)),
+		html.EscapeString(tui.T("page.confirm.body")),
+		html.EscapeString(tui.T("page.confirm.wrong")))
 }
 
-// writeCallbackPage writes a minimal HTML response to the browser tab.
+// writeCallbackPage writes a minimal HTML response to the browser tab, in the
+// language selected with -lang.
 func writeCallbackPage(w http.ResponseWriter, success bool, errCode, errDesc string) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
 	if success {
-		fmt.Fprint(w, `<!DOCTYPE html>
-<html>
-<head><title>Authorization Successful</title></head>
+		fmt.Fprintf(w, `<!DOCTYPE html>
+<html lang="%s">
+<head><title>%s</title></head>
 <body style="font-family:sans-serif;text-align:center;padding:4rem">
-  <h1 style="color:#2ea44f">&#10003; Authorization Successful</h1>
-  <p>You have been successfully authorized.</p>
-  <p>You can close this tab and return to your terminal.</p>
+  <h1 style="color:#2ea44f">&#10003; %s</h1>
+  <p>%s</p>
+  <p>%s</p>
 </body>
-</html>`)
+</html>`,
+			tui.Language(),
+			html.EscapeString(tui.T("page.success.title")),
+			html.EscapeString(tui.T("page.success.title")),
+			html.EscapeString(tui.T("page.success.body")),
+			html.EscapeString(tui.T("page.success.close")))
 		return
 	}
 
@@ -175,12 +387,17 @@ func writeCallbackPage(w http.ResponseWriter, success bool, errCode, errDesc str
 		msg = errDesc
 	}
 	fmt.Fprintf(w, `<!DOCTYPE html>
-<html>
-<head><title>Authorization Failed</title></head>
+<html lang="%s">
+<head><title>%s</title></head>
 <body style="font-family:sans-serif;text-align:center;padding:4rem">
-  <h1 style="color:#cb2431">&#10007; Authorization Failed</h1>
+  <h1 style="color:#cb2431">&#10007; %s</h1>
+  <p>%s</p>
   <p>%s</p>
-  <p>You can close this tab and check your terminal for details.</p>
 </body>
-</html>`, html.EscapeString(msg))
+</html>`,
+		tui.Language(),
+		html.EscapeString(tui.T("page.failure.title")),
+		html.EscapeString(tui.T("page.failure.title")),
+		html.EscapeString(msg),
+		html.EscapeString(tui.T("page.failure.close")))
 }
@@ -2,10 +2,14 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -273,3 +277,393 @@ func TestCallbackServer_MissingCode(t *testing.T) {
 		t.Fatal("timed out waiting for callback result")
 	}
 }
+
+// TestCallbackServer_ClientDisconnectDuringExchange verifies that the token
+// exchange is not cancelled when the browser drops the connection while the
+// response is being held open.
+func TestCallbackServer_ClientDisconnectDuringExchange(t *testing.T) {
+	const port = 19007
+	state := "test-state-disconnect"
+
+	exchangeStarted := make(chan struct{})
+	slowFn := func(ctx context.Context, _ string) (*tui.TokenStorage, error) {
+		close(exchangeStarted)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(300 * time.Millisecond):
+		}
+		return mockExchangeFn(t)(ctx, "")
+	}
+	ch := startCallbackServerAsync(t, port, state, slowFn)
+
+	reqCtx, cancelReq := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, fmt.Sprintf(
+		"http://127.0.0.1:%d/callback?code=mycode&state=%s",
+		port, state,
+	), nil)
+	if err != nil {
+		t.Fatalf("failed to build request: %v", err)
+	}
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	// Simulate the browser tab being closed mid-exchange.
+	<-exchangeStarted
+	cancelReq()
+
+	select {
+	case result := <-ch:
+		if result.err != nil {
+			t.Errorf("expected exchange to complete, got: %v", result.err)
+		}
+		if result.storage == nil {
+			t.Error("expected non-nil storage")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for callback result")
+	}
+}
+
+// TestCallbackServer_CancelDuringExchange verifies that cancelling the CLI
+// context while an exchange is in flight waits for the exchange and returns
+// its tokens instead of discarding the grant.
+func TestCallbackServer_CancelDuringExchange(t *testing.T) {
+	const port = 19008
+	state := "test-state-cancel"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	exchangeStarted := make(chan struct{})
+	slowFn := func(exCtx context.Context, _ string) (*tui.TokenStorage, error) {
+		close(exchangeStarted)
+		select {
+		case <-exCtx.Done():
+			return nil, exCtx.Err()
+		case <-time.After(300 * time.Millisecond):
+		}
+		return mockExchangeFn(t)(exCtx, "")
+	}
+
+	ch := make(chan serverResult, 1)
+	go func() {
+		storage, err := startCallbackServer(ctx, port, state, slowFn)
+		ch <- serverResult{storage: storage, err: err}
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	pageCh := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(fmt.Sprintf(
+			"http://127.0.0.1:%d/callback?code=mycode&state=%s",
+			port, state,
+		))
+		if err != nil {
+			pageCh <- ""
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		pageCh <- string(body)
+	}()
+
+	<-exchangeStarted
+	cancel()
+
+	select {
+	case result := <-ch:
+		if result.err != nil {
+			t.Errorf("expected in-flight exchange to complete, got: %v", result.err)
+		}
+		if result.storage == nil || result.storage.AccessToken != "mock-access-token" {
+			t.Errorf("unexpected storage: %+v", result.storage)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for callback result")
+	}
+
+	select {
+	case page := <-pageCh:
+		if !strings.Contains(page, "Authorization Successful") {
+			t.Errorf("expected success page, got: %s", page)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for callback page")
+	}
+}
+
+func TestCallbackServer_CancelBeforeCallback(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := startCallbackServer(ctx, 19009, "state", mockExchangeFn(t))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got: %v", err)
+	}
+}
+
+func TestCallbackServer_ExpiredSignedState(t *testing.T) {
+	const port = 19010
+
+	origKey, origMaxAge := cfg.StateKey, cfg.StateMaxAge
+	t.Cleanup(func() { cfg.StateKey, cfg.StateMaxAge = origKey, origMaxAge })
+	cfg.StateKey, _ = newStateKey()
+	cfg.StateMaxAge = time.Minute
+
+	state, err := generateSignedState(cfg.StateKey, statePayload{Command: "login"},
+		time.Now().Add(-2*time.Minute))
+	if err != nil {
+		t.Fatalf("generateSignedState() error: %v", err)
+	}
+
+	ch := startCallbackServerAsync(t, port, state, mockExchangeFn(t))
+
+	resp, err := http.Get(fmt.Sprintf(
+		"http://127.0.0.1:%d/callback?code=mycode&state=%s",
+		port, state,
+	))
+	if err != nil {
+		t.Fatalf("GET callback failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "Authorization Failed") {
+		t.Errorf("expected failure page for expired state, got: %s", string(body))
+	}
+
+	select {
+	case result := <-ch:
+		if result.err == nil || !strings.Contains(result.err.Error(), "expired") {
+			t.Errorf("expected expired state error, got: %v", result.err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for callback result")
+	}
+}
+
+func TestCallbackServer_IssuerValidation(t *testing.T) {
+	origIssuer := cfg.ExpectedIssuer
+	t.Cleanup(func() { cfg.ExpectedIssuer = origIssuer })
+	cfg.ExpectedIssuer = "https://auth.example.com"
+
+	tests := []struct {
+		port    int
+		query   string
+		wantErr bool
+	}{
+		{19013, "&iss=https%3A%2F%2Fattacker.example", true},
+		{19014, "", true},
+		{19015, "&iss=https%3A%2F%2Fauth.example.com", false},
+	}
+	for _, tt := range tests {
+		exchanged := false
+		exchangeFn := func(ctx context.Context, code string) (*tui.TokenStorage, error) {
+			exchanged = true
+			return mockExchangeFn(t)(ctx, code)
+		}
+		ch := startCallbackServerAsync(t, tt.port, "iss-state", exchangeFn)
+
+		resp, err := http.Get(fmt.Sprintf(
+			"http://127.0.0.1:%d/callback?code=c&state=iss-state%s", tt.port, tt.query))
+		if err != nil {
+			t.Fatalf("GET callback failed: %v", err)
+		}
+		resp.Body.Close()
+
+		select {
+		case result := <-ch:
+			if (result.err != nil) != tt.wantErr {
+				t.Errorf("iss query %q: err = %v, wantErr %v", tt.query, result.err, tt.wantErr)
+			}
+			if tt.wantErr && exchanged {
+				t.Errorf("iss query %q: code was exchanged despite issuer mismatch", tt.query)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatal("timed out waiting for callback result")
+		}
+	}
+}
+
+func TestValidateRedirectURI(t *testing.T) {
+	tests := []struct {
+		uri     string
+		wantErr string
+	}{
+		{"http://localhost:8888/callback", ""},
+		{"http://127.0.0.1:8888/callback", ""},
+		{"https://localhost:8888/callback", "scheme"},
+		{"http://example.com:8888/callback", "not loopback"},
+		{"http://[::1]:8888/callback", "listens on 127.0.0.1"},
+		{"http://localhost:9000/callback", "port 9000"},
+		{"http://localhost/callback", "port none"},
+		{"http://localhost:8888/oauth/callback", "path"},
+	}
+	for _, tt := range tests {
+		err := validateRedirectURI(tt.uri, 8888)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("validateRedirectURI(%q) = %v, want nil", tt.uri, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("validateRedirectURI(%q) = %v, want error containing %q", tt.uri, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCallbackServer_UnrelatedPathNotFound(t *testing.T) {
+	const port = 19016
+	origLog := debugLog
+	t.Cleanup(func() { debugLog = origLog })
+	logPath := filepath.Join(t.TempDir(), "debug.log")
+	if err := openDebugLog(logPath); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := startCallbackServerAsync(t, port, "probe-state", mockExchangeFn(t))
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/admin?x=1", port))
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound || len(body) != 0 {
+		t.Errorf("GET /admin = %d %q, want bare 404", resp.StatusCode, body)
+	}
+
+	// The pending login is unaffected by the probe.
+	resp, err = http.Get(fmt.Sprintf("http://127.0.0.1:%d/callback?code=c&state=probe-state", port))
+	if err != nil {
+		t.Fatalf("GET callback failed: %v", err)
+	}
+	resp.Body.Close()
+	if result := <-ch; result.err != nil {
+		t.Errorf("login failed after probe: %v", result.err)
+	}
+
+	logged, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(logged), "GET /admin") || strings.Contains(string(logged), "code=c") {
+		t.Errorf("debug log = %q, want the probe path without callback query", logged)
+	}
+}
+
+func TestCallbackServer_ConfigurableTimeout(t *testing.T) {
+	origTimeout := cfg.CallbackTimeout
+	t.Cleanup(func() { cfg.CallbackTimeout = origTimeout })
+	cfg.CallbackTimeout = 100 * time.Millisecond
+
+	ch := startCallbackServerAsync(t, 19017, "timeout-state", mockExchangeFn(t))
+	select {
+	case result := <-ch:
+		if result.err == nil || !strings.Contains(result.err.Error(), "100ms") {
+			t.Errorf("err = %v, want timeout after 100ms", result.err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("callback server ignored callbackTimeout")
+	}
+}
+
+func TestCallbackServer_ListenURLFile(t *testing.T) {
+	origFile := cfg.ListenURLFile
+	t.Cleanup(func() { cfg.ListenURLFile = origFile })
+	cfg.ListenURLFile = filepath.Join(t.TempDir(), "listen.json")
+
+	ch := startCallbackServerAsync(t, 19018, "listen-state", mockExchangeFn(t))
+
+	data, err := os.ReadFile(cfg.ListenURLFile)
+	if err != nil {
+		t.Fatalf("listen URL file not written: %v", err)
+	}
+	var info listenInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		t.Fatalf("invalid listen URL file: %v\n%s", err, data)
+	}
+	if info.CallbackURL != "http://127.0.0.1:19018/callback" || info.State != "listen-state" {
+		t.Errorf("listen info = %+v", info)
+	}
+
+	// Deliver the callback exactly as a plugin would, from the file alone.
+	resp, err := http.Get(info.CallbackURL + "?code=c&state=" + info.State)
+	if err != nil {
+		t.Fatalf("GET callback: %v", err)
+	}
+	resp.Body.Close()
+
+	select {
+	case result := <-ch:
+		if result.err != nil {
+			t.Fatalf("unexpected error: %v", result.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback not handled")
+	}
+	if _, err := os.Stat(cfg.ListenURLFile); !os.IsNotExist(err) {
+		t.Errorf("listen URL file left behind after the server closed: %v", err)
+	}
+}
+
+func TestWriteCallbackPage_Language(t *testing.T) {
+	t.Cleanup(func() { tui.SetLanguage(tui.DefaultLanguage) })
+
+	tests := []struct {
+		locale string
+		want   string
+	}{
+		{"zh_TW.UTF-8", "授權成功"},
+		{"zh-Hans", "授权成功"},
+		{"C", "Authorization Successful"},
+		{"de_DE.UTF-8", "Authorization Successful"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.locale, func(t *testing.T) {
+			lang, _ := tui.MatchLanguage(tt.locale)
+			tui.SetLanguage(lang)
+			rec := httptest.NewRecorder()
+			writeCallbackPage(rec, true, "", "")
+			if body := rec.Body.String(); !strings.Contains(body, tt.want) {
+				t.Errorf("page for %s does not contain %q:\n%s", tt.locale, tt.want, body)
+			}
+		})
+	}
+}
+
+func TestMessageCatalogsComplete(t *testing.T) {
+	// Every English message must be translated in every catalog; a missing
+	// one silently falls back to English.
+	load := func(path string) map[string]string {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		return messages
+	}
+	english := load(filepath.Join("tui", "locales", "en.json"))
+	for _, lang := range tui.Languages() {
+		messages := load(filepath.Join("tui", "locales", lang+".json"))
+		for id := range english {
+			if _, ok := messages[id]; !ok {
+				t.Errorf("%s: message %s is not translated", lang, id)
+			}
+		}
+		for id := range messages {
+			if _, ok := english[id]; !ok {
+				t.Errorf("%s: message %s is not in en.json", lang, id)
+			}
+		}
+	}
+}
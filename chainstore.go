@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-authgate/sdk-go/credstore"
+)
+
+// chainStore tries an ordered list of stores, e.g. -token-store=keyring,sops
+// so a headless machine without a Secret Service daemon falls back to an
+// encrypted file instead of failing. Load returns the first store's token
+// that succeeds, Save writes to the first store that accepts the token, and
+// Delete removes the token from every store so no stale copy resurfaces.
+type chainStore struct {
+	stores []credstore.Store[credstore.Token]
+}
+
+// initChainStore builds a chainStore from the comma-separated modes. A member
+// that cannot be set up on this machine is skipped with a warning; it is an
+// error only when none is usable.
+func initChainStore(
+	modes, filePath, keyringService string,
+) (credstore.Store[credstore.Token], []string, error) {
+	var (
+		chain     chainStore
+		warnings  []string
+		fileModes []string
+	)
+	for mode := range strings.SplitSeq(modes, ",") {
+		mode = strings.TrimSpace(mode)
+		switch mode {
+		case "":
+			continue
+		case "file", "auto", "sops":
+			fileModes = append(fileModes, mode)
+		}
+		store, w, err := initTokenStore(mode, filePath, keyringService)
+		if err != nil {
+			if errors.Is(err, errInvalidTokenStore) {
+				return nil, nil, err
+			}
+			warnings = append(warnings, fmt.Sprintf("skipping token store %s: %v", mode, err))
+			continue
+		}
+		warnings = append(warnings, w...)
+		chain.stores = append(chain.stores, withFileBackup(store, filePath))
+	}
+	if len(fileModes) > 1 {
+		return nil, nil, fmt.Errorf(
+			"token-store %s: %s all use -token-file; list only one of them",
+			modes, strings.Join(fileModes, ", "))
+	}
+	if len(chain.stores) == 0 {
+		return nil, nil, fmt.Errorf("token-store %s: no usable store (%s)",
+			modes, strings.Join(warnings, "; "))
+	}
+	return &chain, warnings, nil
+}
+
+func (c *chainStore) Load(id string) (credstore.Token, error) {
+	var errs []error
+	for _, s := range c.stores {
+		tok, err := s.Load(id)
+		if err == nil {
+			return tok, nil
+		}
+		errs = append(errs, err)
+	}
+	return credstore.Token{}, errors.Join(errs...)
+}
+
+func (c *chainStore) Save(id string, tok credstore.Token) error {
+	var errs []error
+	for _, s := range c.stores {
+		err := s.Save(id, tok)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", s, err))
+	}
+	return errors.Join(errs...)
+}
+
+func (c *chainStore) Delete(id string) error {
+	var errs []error
+	for _, s := range c.stores {
+		if err := s.Delete(id); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s, err))
+		}
+	}
+	// Stores that never held the token may report an error for it.
+	if len(errs) == len(c.stores) {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+func (c *chainStore) String() string {
+	names := make([]string, len(c.stores))
+	for i, s := range c.stores {
+		names[i] = s.String()
+	}
+	return "chain: " + strings.Join(names, " -> ")
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-authgate/sdk-go/credstore"
+)
+
+// failingStore stands in for a keyring without a Secret Service daemon.
+type failingStore struct{}
+
+var errNoDaemon = errors.New("secret service unavailable")
+
+func (failingStore) Load(string) (credstore.Token, error) { return credstore.Token{}, errNoDaemon }
+func (failingStore) Save(string, credstore.Token) error   { return errNoDaemon }
+func (failingStore) Delete(string) error                  { return errNoDaemon }
+func (failingStore) String() string                       { return "failing" }
+
+func TestChainStore_FallsBack(t *testing.T) {
+	fallback := newMemoryStore()
+	chain := &chainStore{stores: []credstore.Store[credstore.Token]{failingStore{}, fallback}}
+
+	if err := chain.Save("cid", credstore.Token{AccessToken: "at"}); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	if tok, err := chain.Load("cid"); err != nil || tok.AccessToken != "at" {
+		t.Errorf("Load() = %+v, %v", tok, err)
+	}
+	if err := chain.Delete("cid"); err != nil {
+		t.Errorf("Delete() error: %v", err)
+	}
+	if _, err := fallback.Load("cid"); err == nil {
+		t.Error("Delete() left the token in the fallback store")
+	}
+}
+
+func TestInitTokenStore_Chain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+
+	store, warnings, err := initTokenStore("wincred, memory", path, "test-service")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	chain, ok := store.(*chainStore)
+	if !ok {
+		t.Fatalf("expected *chainStore, got %T", store)
+	}
+	if _, isMem := chain.stores[len(chain.stores)-1].(*memoryStore); !isMem {
+		t.Errorf("last store = %T, want *memoryStore", chain.stores[len(chain.stores)-1])
+	}
+	if len(chain.stores) == 1 && len(warnings) != 1 {
+		t.Errorf("expected a warning for the skipped wincred store, got %v", warnings)
+	}
+
+	for _, mode := range []string{"keyring,bogus", "file,sops", "op,"} {
+		if _, _, err := initTokenStore(mode, path, "test-service"); err == nil {
+			t.Errorf("initTokenStore(%q) expected error", mode)
+		}
+	}
+	if _, _, err := initTokenStore("keyring,bogus", path, "test-service"); !strings.Contains(err.Error(), "bogus") {
+		t.Errorf("error %v does not name the invalid mode", err)
+	}
+}
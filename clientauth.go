@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Token endpoint client authentication methods, as named in
+// token_endpoint_auth_methods_supported (RFC 8414).
+const (
+	authMethodNone          = "none"
+	authMethodSecretPost    = "client_secret_post"
+	authMethodSecretBasic   = "client_secret_basic"
+	authMethodPrivateKeyJWT = "private_key_jwt"
+	authMethodTLSClientAuth = "tls_client_auth"
+)
+
+// clientAssertionType is the client_assertion_type of private_key_jwt
+// (RFC 7523 §2.2).
+const clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// clientAssertionLifetime bounds how long a signed client assertion is valid.
+const clientAssertionLifetime = time.Minute
+
+// validateTokenAuthMethod checks that the credentials a configured
+// -token-auth-method needs are present.
+func validateTokenAuthMethod(method string) error {
+	switch method {
+	case "", authMethodNone:
+	case authMethodSecretPost, authMethodSecretBasic:
+		if cfg.ClientSecret == "" {
+			return fmt.Errorf("-token-auth-method=%s needs a client secret", method)
+		}
+	case authMethodPrivateKeyJWT:
+		if cfg.ClientKey == nil {
+			return errors.New("-token-auth-method=private_key_jwt needs -client-key")
+		}
+	case authMethodTLSClientAuth:
+		if cfg.ClientCert == nil {
+			return errors.New("-token-auth-method=tls_client_auth needs -client-cert and -client-key")
+		}
+	default:
+		return fmt.Errorf("invalid token-auth-method value: %s (must be %s, %s, %s, %s or %s)",
+			method, authMethodSecretBasic, authMethodSecretPost, authMethodPrivateKeyJWT,
+			authMethodTLSClientAuth, authMethodNone)
+	}
+	return nil
+}
+
+// tokenAuthMethodFor returns the configured -token-auth-method, or picks one
+// from the configured credentials: a client certificate means
+// tls_client_auth, a key private_key_jwt, no secret none. A secret goes in
+// the Authorization header when discovery advertises client_secret_basic.
+func tokenAuthMethodFor(ctx context.Context) string {
+	switch {
+	case cfg.TokenAuthMethod != "":
+		return cfg.TokenAuthMethod
+	case cfg.ClientCert != nil:
+		return authMethodTLSClientAuth
+	case cfg.ClientKey != nil:
+		return authMethodPrivateKeyJWT
+	case cfg.ClientSecret == "":
+		return authMethodNone
+	default:
+		return secretAuthMethod(advertisedAuthMethods(ctx))
+	}
+}
+
+// secretAuthMethod picks how to send a client secret given the methods the
+// server advertises (nil when unknown). client_secret_basic is preferred, as
+// RFC 6749 §2.3.1 requires servers to support it and some reject secrets in
+// the form body; without metadata the form body is kept for compatibility.
+func secretAuthMethod(supported []string) string {
+	if slices.Contains(supported, authMethodSecretBasic) {
+		return authMethodSecretBasic
+	}
+	return authMethodSecretPost
+}
+
+// advertisedAuthMethods returns token_endpoint_auth_methods_supported from
+// the server metadata with -discovery, or nil. The metadata is usually
+// served from the discovery cache.
+func advertisedAuthMethods(ctx context.Context) []string {
+	if !cfg.Discovery {
+		return nil
+	}
+	meta, err := fetchServerMetadata(ctx)
+	if err != nil {
+		return nil
+	}
+	return meta.TokenEndpointAuthMethodsSupported
+}
+
+// authenticateClient returns form with the client's credentials added for a
+// request to an endpoint of the server, and any headers to send with it.
+// audience is the token endpoint URL that private_key_jwt assertions are
+// addressed to.
+func authenticateClient(
+	ctx context.Context,
+	form url.Values,
+	audience string,
+) (url.Values, http.Header, error) {
+	form = cloneValues(form)
+	header := http.Header{}
+	switch tokenAuthMethodFor(ctx) {
+	case authMethodSecretPost:
+		form.Set("client_secret", cfg.ClientSecret)
+	case authMethodSecretBasic:
+		// RFC 6749 §2.3.1: both parts are form-encoded before Base64.
+		credentials := url.QueryEscape(cfg.ClientID) + ":" + url.QueryEscape(cfg.ClientSecret)
+		header.Set("Authorization",
+			"Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+	case authMethodPrivateKeyJWT:
+		assertion, err := signClientAssertion(cfg.ClientKey, audience, clock.Now())
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to sign client assertion: %w", err)
+		}
+		form.Set("client_assertion_type", clientAssertionType)
+		form.Set("client_assertion", assertion)
+	}
+	// none and tls_client_auth send only client_id; the latter
+	// authenticates with the certificate in the TLS handshake.
+	return form, header, nil
+}
+
+func cloneValues(v url.Values) url.Values {
+	out := make(url.Values, len(v))
+	for k, vs := range v {
+		out[k] = slices.Clone(vs)
+	}
+	return out
+}
+
+// signClientAssertion returns a private_key_jwt client assertion for
+// audience (RFC 7523 §3), signed with RS256, ES256, ES384 or EdDSA depending
+// on the key.
+func signClientAssertion(key crypto.Signer, audience string, now time.Time) (string, error) {
+	var (
+		alg  string
+		hash crypto.Hash
+	)
+	switch k := key.Public().(type) {
+	case *rsa.PublicKey:
+		alg, hash = "RS256", crypto.SHA256
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			alg, hash = "ES256", crypto.SHA256
+		case elliptic.P384():
+			alg, hash = "ES384", crypto.SHA384
+		default:
+			return "", fmt.Errorf("unsupported ECDSA curve %s", k.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+		alg = "EdDSA"
+	default:
+		return "", fmt.Errorf("unsupported key type %T", k)
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"iss": cfg.ClientID,
+		"sub": cfg.ClientID,
+		"aud": audience,
+		"jti": uuid.NewString(),
+		"iat": now.Unix(),
+		"exp": now.Add(clientAssertionLifetime).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	input := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(claims)
+
+	var sig []byte
+	switch hash {
+	case 0:
+		sig, err = key.Sign(rand.Reader, []byte(input), crypto.Hash(0))
+	case crypto.SHA256:
+		digest := sha256.Sum256([]byte(input))
+		sig, err = signDigest(key, digest[:], hash)
+	case crypto.SHA384:
+		digest := sha512.Sum384([]byte(input))
+		sig, err = signDigest(key, digest[:], hash)
+	}
+	if err != nil {
+		return "", err
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// signDigest signs digest, converting ECDSA's ASN.1 signature to the fixed
+// r||s form JWS requires (RFC 7518 §3.4).
+func signDigest(key crypto.Signer, digest []byte, hash crypto.Hash) ([]byte, error) {
+	sig, err := key.Sign(rand.Reader, digest, hash)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := key.Public().(*ecdsa.PublicKey)
+	if !ok {
+		return sig, nil
+	}
+	var parsed struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(sig, &parsed); err != nil {
+		return nil, err
+	}
+	size := (pub.Curve.Params().BitSize + 7) / 8
+	out := make([]byte, 2*size)
+	parsed.R.FillBytes(out[:size])
+	parsed.S.FillBytes(out[size:])
+	return out, nil
+}
+
+// loadClientKey reads a PEM private key (PKCS#8, PKCS#1 or SEC 1) for
+// private_key_jwt.
+func loadClientKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block found", path)
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+		return nil, fmt.Errorf("%s: unsupported key type %T", path, key)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%s: not a PKCS#8, PKCS#1 or EC private key", path)
+}
+
+// loadClientCredentials loads -client-cert and -client-key: a certificate
+// and key for tls_client_auth, or a key alone for private_key_jwt. The key of
+// a certificate can sign assertions too.
+func loadClientCredentials(certPath, keyPath string) (*tls.Certificate, crypto.Signer, error) {
+	switch {
+	case certPath != "" && keyPath == "":
+		return nil, nil, errors.New("-client-cert needs -client-key")
+	case certPath != "":
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		signer, _ := cert.PrivateKey.(crypto.Signer)
+		return &cert, signer, nil
+	case keyPath != "":
+		key, err := loadClientKey(keyPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load client key: %w", err)
+		}
+		return nil, key, nil
+	}
+	return nil, nil, nil
+}
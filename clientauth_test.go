@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setClientAuthTestConfig sets the client credentials for a test and restores
+// them afterwards.
+func setClientAuthTestConfig(t *testing.T, method, secret string, key crypto.Signer) {
+	t.Helper()
+	origMethod, origID, origSecret := cfg.TokenAuthMethod, cfg.ClientID, cfg.ClientSecret
+	origKey, origCert, origDiscovery := cfg.ClientKey, cfg.ClientCert, cfg.Discovery
+	t.Cleanup(func() {
+		cfg.TokenAuthMethod, cfg.ClientID, cfg.ClientSecret = origMethod, origID, origSecret
+		cfg.ClientKey, cfg.ClientCert, cfg.Discovery = origKey, origCert, origDiscovery
+	})
+	cfg.TokenAuthMethod, cfg.ClientID, cfg.ClientSecret = method, "test-client", secret
+	cfg.ClientKey, cfg.ClientCert, cfg.Discovery = key, nil, false
+}
+
+func TestAuthenticateClient(t *testing.T) {
+	form := url.Values{"grant_type": {"refresh_token"}}
+
+	t.Run("client_secret_post", func(t *testing.T) {
+		setClientAuthTestConfig(t, "", "s3cret", nil)
+		got, header, err := authenticateClient(context.Background(), form, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Get("client_secret") != "s3cret" || header.Get("Authorization") != "" {
+			t.Errorf("form = %v, header = %v", got, header)
+		}
+		if form.Has("client_secret") {
+			t.Error("authenticateClient modified the caller's form")
+		}
+	})
+
+	t.Run("client_secret_basic", func(t *testing.T) {
+		setClientAuthTestConfig(t, authMethodSecretBasic, "s3cret:+", nil)
+		got, header, err := authenticateClient(context.Background(), form, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "Basic " + base64.StdEncoding.EncodeToString([]byte("test-client:s3cret%3A%2B"))
+		if got.Has("client_secret") || header.Get("Authorization") != want {
+			t.Errorf("form = %v, Authorization = %q, want %q", got, header.Get("Authorization"), want)
+		}
+	})
+
+	t.Run("private_key_jwt", func(t *testing.T) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		setClientAuthTestConfig(t, "", "", key)
+		got, _, err := authenticateClient(context.Background(), form, "https://auth.example/token")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Get("client_assertion_type") != clientAssertionType || got.Get("client_assertion") == "" {
+			t.Errorf("form = %v, want a client assertion", got)
+		}
+	})
+
+	t.Run("none", func(t *testing.T) {
+		setClientAuthTestConfig(t, "", "", nil)
+		got, header, err := authenticateClient(context.Background(), form, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(form) || len(header) != 0 {
+			t.Errorf("form = %v, header = %v, want no credentials", got, header)
+		}
+	})
+}
+
+func TestSecretAuthMethod(t *testing.T) {
+	tests := []struct {
+		supported []string
+		want      string
+	}{
+		{nil, authMethodSecretPost},
+		{[]string{authMethodSecretPost, authMethodSecretBasic}, authMethodSecretBasic},
+		{[]string{authMethodSecretPost}, authMethodSecretPost},
+		{[]string{authMethodSecretBasic}, authMethodSecretBasic},
+		{[]string{authMethodPrivateKeyJWT}, authMethodSecretPost},
+	}
+	for _, tt := range tests {
+		if got := secretAuthMethod(tt.supported); got != tt.want {
+			t.Errorf("secretAuthMethod(%v) = %q, want %q", tt.supported, got, tt.want)
+		}
+	}
+}
+
+func TestSignClientAssertion(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setClientAuthTestConfig(t, "", "", key)
+	now := time.Unix(1700000000, 0)
+
+	jwt, err := signClientAssertion(key, "https://auth.example/token", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		t.Fatalf("assertion has %d parts, want 3", len(parts))
+	}
+
+	var header map[string]string
+	decodeSegment(t, parts[0], &header)
+	if header["alg"] != "ES256" {
+		t.Errorf("alg = %q, want ES256", header["alg"])
+	}
+	var claims map[string]any
+	decodeSegment(t, parts[1], &claims)
+	if claims["iss"] != "test-client" || claims["sub"] != "test-client" ||
+		claims["aud"] != "https://auth.example/token" || claims["jti"] == "" ||
+		claims["exp"] != float64(now.Add(clientAssertionLifetime).Unix()) {
+		t.Errorf("claims = %v", claims)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(sig) != 64 {
+		t.Fatalf("signature length = %d, err = %v; want 64 bytes", len(sig), err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+	if !ecdsa.Verify(&key.PublicKey, digest[:], r, s) {
+		t.Error("signature does not verify")
+	}
+}
+
+func decodeSegment(t *testing.T, segment string, v any) {
+	t.Helper()
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadClientKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "client.key")
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := loadClientKey(path)
+	if err != nil {
+		t.Fatalf("loadClientKey() error = %v", err)
+	}
+	if !key.PublicKey.Equal(signer.Public()) {
+		t.Error("loadClientKey() returned a different key")
+	}
+
+	if err := os.WriteFile(path, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadClientKey(path); err == nil {
+		t.Error("loadClientKey() of a non-PEM file succeeded")
+	}
+}
+
+func TestValidateTokenAuthMethod(t *testing.T) {
+	setClientAuthTestConfig(t, "", "", nil)
+	for _, method := range []string{
+		authMethodSecretBasic, authMethodSecretPost, authMethodPrivateKeyJWT,
+		authMethodTLSClientAuth, "client_secret_jwt",
+	} {
+		if err := validateTokenAuthMethod(method); err == nil {
+			t.Errorf("validateTokenAuthMethod(%q) without credentials succeeded", method)
+		}
+	}
+	for _, method := range []string{"", authMethodNone} {
+		if err := validateTokenAuthMethod(method); err != nil {
+			t.Errorf("validateTokenAuthMethod(%q) error = %v", method, err)
+		}
+	}
+}
+
+func TestRefreshAccessToken_ClientSecretBasicFromDiscovery(t *testing.T) {
+	var gotAuth, gotSecret string
+	mux := http.NewServeMux()
+	metadata := `{"issuer":"https://issuer",` +
+		`"token_endpoint_auth_methods_supported":["client_secret_post","client_secret_basic"]}`
+	mux.HandleFunc("/.well-known/oauth-authorization-server",
+		func(w http.ResponseWriter, _ *http.Request) { _, _ = w.Write([]byte(metadata)) })
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		gotAuth, gotSecret = r.Header.Get("Authorization"), r.PostForm.Get("client_secret")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"new-access","refresh_token":"new-refresh",` +
+			`"token_type":"Bearer","expires_in":3600}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	setTestServer(t, srv)
+	setTokenTestConfig(t, "")
+	setClientAuthTestConfig(t, "", "s3cret", nil)
+	origDir := cfg.DiscoveryCacheDir
+	t.Cleanup(func() { cfg.DiscoveryCacheDir = origDir })
+	cfg.DiscoveryCacheDir = t.TempDir()
+	cfg.Discovery = true
+
+	if _, err := refreshAccessToken(context.Background(), "old-refresh"); err != nil {
+		t.Fatalf("refreshAccessToken() error = %v", err)
+	}
+	want := "Basic " + base64.StdEncoding.EncodeToString([]byte("test-client:s3cret"))
+	if gotAuth != want || gotSecret != "" {
+		t.Errorf("Authorization = %q, client_secret = %q; want %q and no form secret",
+			gotAuth, gotSecret, want)
+	}
+}
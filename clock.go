@@ -0,0 +1,21 @@
+package main
+
+import "time"
+
+// Clock tells the time for expiry decisions: token expiry, the
+// -refresh-before skew buffer, refresh backoff, the token endpoint circuit
+// breaker, signed state age, the discovery and tokeninfo caches, and the
+// certificate expiry check of ping. Latency measurements (ping, -timing, tracing) and network timeouts use the
+// runtime clock directly, since they time real I/O.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the Clock of a normal run.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// clock is the process-wide Clock. Tests replace it to move time without
+// sleeping.
+var clock Clock = systemClock{}
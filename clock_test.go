@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-authgate/oauth-cli/tui"
+	"github.com/go-authgate/sdk-go/credstore"
+)
+
+// fakeClock is a Clock that only moves when told to.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// setFakeClock replaces clock with a fakeClock set to at for the test.
+func setFakeClock(t *testing.T, at time.Time) *fakeClock {
+	t.Helper()
+	orig := clock
+	t.Cleanup(func() { clock = orig })
+	c := &fakeClock{now: at}
+	clock = c
+	return c
+}
+
+func TestTokenExpiry_UsesClock(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	setFakeClock(t, at)
+
+	if got := tokenExpiry(3600); !got.Equal(at.Add(time.Hour)) {
+		t.Errorf("tokenExpiry(3600) = %v, want %v", got, at.Add(time.Hour))
+	}
+	if got := tokenExpiry(0); !got.IsZero() {
+		t.Errorf("tokenExpiry(0) = %v, want zero", got)
+	}
+}
+
+func TestTokenCache_RefreshBeforeBoundary(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	fc := setFakeClock(t, at)
+	orig := cfg.RefreshBefore
+	t.Cleanup(func() { cfg.RefreshBefore = orig })
+	cfg.RefreshBefore = 5 * time.Minute
+
+	c := newTokenCache()
+	c.put("k", &tui.TokenStorage{AccessToken: "a", ExpiresAt: at.Add(10 * time.Minute)})
+
+	// Valid until exactly cfg.RefreshBefore ahead of expiry.
+	fc.Advance(5*time.Minute - time.Second)
+	if _, ok := c.get("k"); !ok {
+		t.Error("get() one second before the skew buffer = miss, want hit")
+	}
+	fc.Advance(time.Second)
+	if _, ok := c.get("k"); ok {
+		t.Error("get() at the skew buffer = hit, want miss")
+	}
+}
+
+func TestTokenForAudience_BackoffElapses(t *testing.T) {
+	var refreshes int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		refreshes++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	setTestServer(t, srv)
+	setTokenTestConfig(t, "")
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	fc := setFakeClock(t, at)
+	origBefore, origBackoff := cfg.RefreshBefore, refreshBackoff
+	t.Cleanup(func() { cfg.RefreshBefore, refreshBackoff = origBefore, origBackoff })
+	cfg.RefreshBefore, refreshBackoff = 5*time.Minute, &refreshSchedule{}
+
+	if err := cfg.TokenStore.Save("test-client", credstore.Token{
+		AccessToken:  "expiring-access-token",
+		RefreshToken: "refresh",
+		ExpiresAt:    at.Add(time.Minute),
+	}); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	load := func() {
+		t.Helper()
+		tok, err := loadTokenForAudience(context.Background(), "test-client")
+		if err != nil || tok.AccessToken != "expiring-access-token" {
+			t.Fatalf("loadTokenForAudience() = %+v, %v; want the still-valid token", tok, err)
+		}
+	}
+	load()
+	fc.Advance(minRefreshBackoff - time.Second)
+	load()
+	if refreshes != 1 {
+		t.Fatalf("refresh requests within the backoff = %d, want 1", refreshes)
+	}
+	fc.Advance(time.Second)
+	load()
+	if refreshes != 2 {
+		t.Errorf("refresh requests after the backoff = %d, want 2", refreshes)
+	}
+}
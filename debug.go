@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+// debugLog receives diagnostic messages; nil unless -debug-log is set. It is
+// a file rather than stderr because the TUI owns the terminal.
+var debugLog *log.Logger
+
+// openDebugLog starts appending diagnostics to path.
+func openDebugLog(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	debugLog = log.New(f, "", log.LstdFlags|log.Lmicroseconds)
+	return nil
+}
+
+// debugf writes a diagnostic message when -debug-log is set.
+func debugf(format string, args ...any) {
+	if debugLog != nil {
+		_ = debugLog.Output(2, fmt.Sprintf(format, args...))
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+const (
+	discoveryTimeout    = 10 * time.Second
+	defaultDiscoveryTTL = time.Hour
+)
+
+// metadataPaths are the well-known locations tried, in order, when discovery
+// is enabled: OAuth 2.0 Authorization Server Metadata (RFC 8414) first, then
+// OpenID Connect Discovery.
+var metadataPaths = []string{
+	"/.well-known/oauth-authorization-server",
+	"/.well-known/openid-configuration",
+}
+
+// serverMetadata is the subset of authorization server metadata the CLI uses.
+type serverMetadata struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+
+	AuthorizationResponseIssParameterSupported bool `json:"authorization_response_iss_parameter_supported"`
+}
+
+// serverCapability is an optional endpoint and where metadata advertises it
+// ("" when it does not).
+type serverCapability struct {
+	name     string
+	endpoint string
+}
+
+// serverCapabilities lists the optional endpoints meta advertises.
+func serverCapabilities(meta *serverMetadata) []serverCapability {
+	return []serverCapability{
+		{"revocation", meta.RevocationEndpoint},
+		{"introspection", meta.IntrospectionEndpoint},
+		{"userinfo", meta.UserinfoEndpoint},
+		{"device", meta.DeviceAuthorizationEndpoint},
+	}
+}
+
+// applyServerCapabilities adapts activeProvider to the endpoints meta
+// advertises. Revocation and userinfo use the advertised endpoints, or are
+// disabled when there are none, so an aborted login does not POST to a
+// guessed path and report a 404. Token info is disabled when no
+// introspection endpoint is advertised, unless -tokeninfo-path names one. A
+// nil meta (discovery off or failed) changes nothing.
+func applyServerCapabilities(meta *serverMetadata) {
+	if meta == nil {
+		return
+	}
+	activeProvider.revokePath = meta.RevocationEndpoint
+	activeProvider.userinfoPath = meta.UserinfoEndpoint
+	if meta.IntrospectionEndpoint == "" && !cfg.TokenInfoPathSet {
+		activeProvider.tokenInfoPath = ""
+	}
+}
+
+// discoverCapabilities applies the optional endpoints of the server metadata
+// when -discovery is set, then re-checks the policy, which also covers the
+// advertised endpoints.
+func discoverCapabilities(ctx context.Context) {
+	if !cfg.Discovery {
+		return
+	}
+	meta, _ := fetchServerMetadata(ctx)
+	applyServerCapabilities(meta)
+	enforcePolicy("")
+}
+
+// responseIssuer returns the issuer the authorization response must carry in
+// its iss parameter (RFC 9207), or "" when meta does not advertise
+// authorization_response_iss_parameter_supported.
+func responseIssuer(meta *serverMetadata) string {
+	if meta == nil || !meta.AuthorizationResponseIssParameterSupported {
+		return ""
+	}
+	return meta.Issuer
+}
+
+// errMetadataNotFound is returned when none of the well-known paths serve metadata.
+var errMetadataNotFound = errors.New("server does not publish authorization server metadata")
+
+// metadataCacheEntry is a discovery document cached on disk, with the
+// validators used to revalidate it once it is older than cfg.DiscoveryTTL.
+type metadataCacheEntry struct {
+	Server       string          `json:"server"`
+	Path         string          `json:"path"`
+	ETag         string          `json:"etag,omitempty"`
+	LastModified string          `json:"last_modified,omitempty"`
+	FetchedAt    time.Time       `json:"fetched_at"`
+	Body         json.RawMessage `json:"body"`
+}
+
+// metadataCachePath returns the cache file for cfg.ServerURL's metadata, or ""
+// when caching is disabled.
+func metadataCachePath() string {
+	if cfg.DiscoveryCacheDir == "" || cfg.DiscoveryTTL <= 0 {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(cfg.ServerURL + cfg.ServerSocket))
+	return filepath.Join(cfg.DiscoveryCacheDir, hex.EncodeToString(sum[:8])+".json")
+}
+
+// loadMetadataCache returns the cached entry for cfg.ServerURL, or nil.
+func loadMetadataCache() *metadataCacheEntry {
+	path := metadataCachePath()
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var entry metadataCacheEntry
+	if json.Unmarshal(data, &entry) != nil || entry.Server != cfg.ServerURL {
+		return nil
+	}
+	return &entry
+}
+
+// saveMetadataCache stores entry. The cache is an optimisation, so failures
+// are ignored.
+func saveMetadataCache(entry *metadataCacheEntry) {
+	path := metadataCachePath()
+	if path == "" {
+		return
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if os.MkdirAll(filepath.Dir(path), 0o700) != nil {
+		return
+	}
+	_ = writeFileSync(path, data)
+}
+
+// fetchServerMetadata retrieves the server's metadata document from the first
+// well-known path that answers 200. Documents are cached on disk per server:
+// within cfg.DiscoveryTTL the cached copy is used without a request, after that
+// it is revalidated with If-None-Match/If-Modified-Since.
+func fetchServerMetadata(ctx context.Context) (*serverMetadata, error) {
+	cached := loadMetadataCache()
+	if cached != nil && clock.Now().Sub(cached.FetchedAt) < cfg.DiscoveryTTL {
+		return parseServerMetadata(cached.Path, cached.Body)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+	defer cancel()
+
+	paths := metadataPaths
+	if cached != nil {
+		// Revalidate the path that answered last time before trying the others.
+		paths = append([]string{cached.Path}, slices.DeleteFunc(slices.Clone(paths),
+			func(p string) bool { return p == cached.Path })...)
+	}
+	for _, path := range paths {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.ServerURL+path, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		revalidating := cached != nil && cached.Path == path
+		if revalidating {
+			if cached.ETag != "" {
+				req.Header.Set("If-None-Match", cached.ETag)
+			}
+			if cached.LastModified != "" {
+				req.Header.Set("If-Modified-Since", cached.LastModified)
+			}
+		}
+
+		resp, err := cfg.RetryClient.DoWithContext(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("request failed: %w", err)
+		}
+		body, err := readResponseBody(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+		if resp.StatusCode == http.StatusNotModified && revalidating {
+			cached.FetchedAt = clock.Now()
+			saveMetadataCache(cached)
+			return parseServerMetadata(path, cached.Body)
+		}
+		if resp.StatusCode != http.StatusOK {
+			continue
+		}
+
+		meta, err := parseServerMetadata(path, body)
+		if err != nil {
+			return nil, err
+		}
+		saveMetadataCache(&metadataCacheEntry{
+			Server:       cfg.ServerURL,
+			Path:         path,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			FetchedAt:    clock.Now(),
+			Body:         body,
+		})
+		return meta, nil
+	}
+	return nil, errMetadataNotFound
+}
+
+func parseServerMetadata(path string, body []byte) (*serverMetadata, error) {
+	var meta serverMetadata
+	if err := json.Unmarshal(body, &meta); err != nil {
+		return nil, fmt.Errorf("failed to parse metadata from %s: %w", path, err)
+	}
+	return &meta, nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	retry "github.com/appleboy/go-httpretry"
+)
+
+// setTestServer points cfg.ServerURL, cfg.RetryClient and cfg.NoRetryClient
+// at srv for the test.
+func setTestServer(t *testing.T, srv *httptest.Server) {
+	t.Helper()
+	origServerURL, origRetry, origNoRetry := cfg.ServerURL, cfg.RetryClient, cfg.NoRetryClient
+	t.Cleanup(func() {
+		cfg.ServerURL, cfg.RetryClient, cfg.NoRetryClient = origServerURL, origRetry, origNoRetry
+	})
+
+	client, err := retry.NewBackgroundClient(
+		retry.WithHTTPClient(srv.Client()),
+		retry.WithMaxRetries(0),
+	)
+	if err != nil {
+		t.Fatalf("failed to create retry client: %v", err)
+	}
+	cfg.ServerURL = srv.URL
+	cfg.RetryClient = client
+	cfg.NoRetryClient = client
+}
+
+func TestFetchServerMetadata_FallsBackToOpenIDConfiguration(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"issuer":"https://issuer","code_challenge_methods_supported":["plain"]}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	setTestServer(t, srv)
+
+	meta, err := fetchServerMetadata(context.Background())
+	if err != nil {
+		t.Fatalf("fetchServerMetadata() error: %v", err)
+	}
+	if meta.Issuer != "https://issuer" {
+		t.Errorf("issuer = %q", meta.Issuer)
+	}
+	if len(meta.CodeChallengeMethodsSupported) != 1 ||
+		meta.CodeChallengeMethodsSupported[0] != "plain" {
+		t.Errorf("code_challenge_methods_supported = %v", meta.CodeChallengeMethodsSupported)
+	}
+}
+
+func TestFetchServerMetadata_NotFound(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	setTestServer(t, srv)
+
+	if _, err := fetchServerMetadata(context.Background()); !errors.Is(err, errMetadataNotFound) {
+		t.Errorf("expected errMetadataNotFound, got: %v", err)
+	}
+}
+
+func TestResolvePKCEMethod(t *testing.T) {
+	origMethod, origDiscovery := cfg.PKCEMethod, cfg.Discovery
+	t.Cleanup(func() { cfg.PKCEMethod, cfg.Discovery = origMethod, origDiscovery })
+
+	meta := &serverMetadata{CodeChallengeMethodsSupported: []string{"plain"}}
+
+	tests := []struct {
+		name        string
+		explicit    string
+		discovery   bool
+		metaErr     error
+		want        string
+		wantWarning bool
+	}{
+		{"default without discovery", "", false, nil, "S256", false},
+		{"explicit wins over discovery", "none", true, nil, "none", false},
+		{"auto-selected from metadata", "", true, nil, "plain", true},
+		{"discovery failure falls back", "", true, errMetadataNotFound, "S256", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg.PKCEMethod, cfg.Discovery = tc.explicit, tc.discovery
+			got, warning := resolvePKCEMethod(meta, tc.metaErr)
+			if got != tc.want {
+				t.Errorf("resolvePKCEMethod() = %q, want %q", got, tc.want)
+			}
+			if (warning != "") != tc.wantWarning {
+				t.Errorf("warning = %q, wantWarning %v", warning, tc.wantWarning)
+			}
+		})
+	}
+}
+
+func TestFetchServerMetadata_CachesAndRevalidates(t *testing.T) {
+	var requests, notModified int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/oauth-authorization-server", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(`{"issuer":"https://issuer"}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	setTestServer(t, srv)
+
+	origDir, origTTL := cfg.DiscoveryCacheDir, cfg.DiscoveryTTL
+	t.Cleanup(func() { cfg.DiscoveryCacheDir, cfg.DiscoveryTTL = origDir, origTTL })
+	cfg.DiscoveryCacheDir = t.TempDir()
+	cfg.DiscoveryTTL = time.Hour
+
+	for range 2 {
+		if meta, err := fetchServerMetadata(context.Background()); err != nil || meta.Issuer != "https://issuer" {
+			t.Fatalf("fetchServerMetadata() = %+v, %v", meta, err)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("requests = %d, want 1 (second call served from cache)", requests)
+	}
+
+	// Once the TTL has passed, the cached document is revalidated.
+	entry := loadMetadataCache()
+	entry.FetchedAt = time.Now().Add(-2 * time.Hour)
+	saveMetadataCache(entry)
+	if meta, err := fetchServerMetadata(context.Background()); err != nil || meta.Issuer != "https://issuer" {
+		t.Fatalf("fetchServerMetadata() after TTL = %+v, %v", meta, err)
+	}
+	if notModified != 1 {
+		t.Errorf("conditional requests answered 304 = %d, want 1", notModified)
+	}
+	if entry := loadMetadataCache(); time.Since(entry.FetchedAt) > time.Minute {
+		t.Errorf("revalidation did not refresh fetched_at: %v", entry.FetchedAt)
+	}
+}
+
+func TestApplyServerCapabilities(t *testing.T) {
+	orig := activeProvider
+	t.Cleanup(func() { activeProvider = orig })
+
+	applyServerCapabilities(nil)
+	if activeProvider.revokePath != orig.revokePath {
+		t.Errorf("nil metadata changed revokePath to %q", activeProvider.revokePath)
+	}
+
+	applyServerCapabilities(&serverMetadata{RevocationEndpoint: "https://issuer/connect/revocation"})
+	if activeProvider.revokePath != "https://issuer/connect/revocation" {
+		t.Errorf("revokePath = %q, want the advertised endpoint", activeProvider.revokePath)
+	}
+
+	applyServerCapabilities(&serverMetadata{})
+	if activeProvider.revokePath != "" {
+		t.Errorf("revokePath = %q, want revocation disabled", activeProvider.revokePath)
+	}
+	if activeProvider.userinfoPath != "" || activeProvider.tokenInfoPath != "" {
+		t.Errorf("userinfoPath = %q, tokenInfoPath = %q; want both disabled",
+			activeProvider.userinfoPath, activeProvider.tokenInfoPath)
+	}
+
+	origSet := cfg.TokenInfoPathSet
+	t.Cleanup(func() { cfg.TokenInfoPathSet = origSet })
+	activeProvider = orig
+	cfg.TokenInfoPathSet = true
+	applyServerCapabilities(&serverMetadata{UserinfoEndpoint: "https://issuer/userinfo"})
+	if activeProvider.userinfoPath != "https://issuer/userinfo" {
+		t.Errorf("userinfoPath = %q, want the advertised endpoint", activeProvider.userinfoPath)
+	}
+	if activeProvider.tokenInfoPath != orig.tokenInfoPath {
+		t.Errorf("tokenInfoPath = %q, want the configured %q kept",
+			activeProvider.tokenInfoPath, orig.tokenInfoPath)
+	}
+}
+
+func TestCurrentPolicyTarget_IncludesDiscoveredEndpoints(t *testing.T) {
+	orig, origURL := activeProvider, cfg.ServerURL
+	t.Cleanup(func() { activeProvider, cfg.ServerURL = orig, origURL })
+	cfg.ServerURL = "https://auth.example.com"
+	p := &policy{AllowedServers: []string{cfg.ServerURL}}
+	if err := p.check(currentPolicyTarget("")); err != nil {
+		t.Fatalf("check() before discovery error = %v", err)
+	}
+
+	applyServerCapabilities(&serverMetadata{
+		RevocationEndpoint: "https://revoke.evil.io/revoke",
+		UserinfoEndpoint:   "https://userinfo.evil.io/userinfo",
+	})
+	target := currentPolicyTarget("")
+	for _, want := range []string{"https://revoke.evil.io/revoke", "https://userinfo.evil.io/userinfo"} {
+		if !slices.Contains(target.endpoints, want) {
+			t.Errorf("policy target endpoints %v lack %s", target.endpoints, want)
+		}
+	}
+	if err := p.check(target); err == nil {
+		t.Error("check() accepted endpoints advertised outside allowed_servers")
+	}
+}
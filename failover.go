@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// tokenEndpointState records which token endpoint issued each token when
+// -token-fallback-urls is set, so refreshes go back to the replica that
+// holds the grant. The file maps "authgate:<host>/<token key>" to the
+// endpoint URL; it is a routing hint only and holds no secrets.
+var tokenEndpointState struct {
+	sync.Mutex
+	path string // "" disables stickiness
+}
+
+// parseTokenFallbackURLs splits the comma-separated -token-fallback-urls
+// value into absolute http(s) URLs.
+func parseTokenFallbackURLs(value string) ([]string, error) {
+	var urls []string
+	for raw := range strings.SplitSeq(value, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid token-fallback-urls entry: %s (must be an http(s) URL)", raw)
+		}
+		urls = append(urls, raw)
+	}
+	return urls, nil
+}
+
+// stickyEndpointKey identifies the token for key on this server.
+func stickyEndpointKey(key string) string {
+	return credentialTargetPrefix(cfg.ServerURL) + key
+}
+
+func loadEndpointState() map[string]string {
+	state := make(map[string]string)
+	if data, err := os.ReadFile(tokenEndpointState.path); err == nil {
+		_ = json.Unmarshal(data, &state)
+	}
+	return state
+}
+
+// stickyEndpoint returns the endpoint that issued the token for key, or "".
+func stickyEndpoint(key string) string {
+	tokenEndpointState.Lock()
+	defer tokenEndpointState.Unlock()
+	if tokenEndpointState.path == "" {
+		return ""
+	}
+	return loadEndpointState()[stickyEndpointKey(key)]
+}
+
+// recordStickyEndpoint remembers that endpoint issued the token for key.
+// Stickiness is an optimisation, so failures are ignored.
+func recordStickyEndpoint(key, endpoint string) {
+	tokenEndpointState.Lock()
+	defer tokenEndpointState.Unlock()
+	if tokenEndpointState.path == "" {
+		return
+	}
+	state := loadEndpointState()
+	if state[stickyEndpointKey(key)] == endpoint {
+		return
+	}
+	state[stickyEndpointKey(key)] = endpoint
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return
+	}
+	if os.MkdirAll(filepath.Dir(tokenEndpointState.path), 0o700) != nil {
+		return
+	}
+	_ = writeFileSync(tokenEndpointState.path, data)
+}
+
+// tokenEndpoints returns the token endpoints to try for key: the one that
+// issued its token first, then the primary, then the fallbacks in order.
+func tokenEndpoints(key string) []string {
+	endpoints := append([]string{endpointURL(activeProvider.tokenPath)}, cfg.TokenFallbackURLs...)
+	sticky := stickyEndpoint(key)
+	if sticky == "" || !slices.Contains(endpoints, sticky) {
+		return endpoints
+	}
+	return append([]string{sticky},
+		slices.DeleteFunc(endpoints, func(e string) bool { return e == sticky })...)
+}
+
+// postTokenRequest POSTs form, with the client's credentials added, to the
+// token endpoint for key, the key whose refresh token or grant form carries.
+// When an endpoint cannot be reached (after the retry client gives up), the
+// next one in tokenEndpoints is tried; any HTTP response, including an OAuth
+// error or a 5xx that outlasted the retries, ends the failover. It returns
+// the endpoint that answered. Requests pass through tokenBreaker.
+func postTokenRequest(
+	ctx context.Context,
+	form url.Values,
+	key string,
+) (*http.Response, string, error) {
+	if err := tokenBreaker.allow(clock.Now()); err != nil {
+		return nil, "", err
+	}
+	// Local errors and cancellation leave the breaker as it is.
+	var answered, unreachable bool
+	defer func() {
+		tokenBreaker.done(clock.Now(), answered, unreachable && ctx.Err() == nil)
+	}()
+
+	endpoints := tokenEndpoints(key)
+	var errs []error
+	for _, endpoint := range endpoints {
+		authForm, header, err := authenticateClient(ctx, form, endpoint)
+		if err != nil {
+			return nil, "", err
+		}
+		req, err := http.NewRequestWithContext(
+			ctx,
+			http.MethodPost,
+			endpoint,
+			strings.NewReader(authForm.Encode()),
+		)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to create request: %w", err)
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Accept", tokenAcceptHeader)
+
+		resp, err := cfg.RetryClient.DoWithContext(ctx, req)
+		if err == nil {
+			answered = true
+			return resp, endpoint, nil
+		}
+		if resp != nil {
+			// The retries ran out on a 5xx or 429: the endpoint is reachable,
+			// and the grant may be bound to it, so another one is not tried.
+			resp.Body.Close()
+			answered = resp.StatusCode < http.StatusInternalServerError
+			unreachable = !answered
+			return nil, "", err
+		}
+		if len(endpoints) == 1 || ctx.Err() != nil {
+			unreachable = true
+			return nil, "", err
+		}
+		debugf("token endpoint %s unreachable, failing over: %v", endpoint, err)
+		errs = append(errs, fmt.Errorf("%s: %w", endpoint, err))
+	}
+	unreachable = true
+	return nil, "", errors.Join(errs...)
+}
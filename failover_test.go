@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/go-authgate/sdk-go/credstore"
+)
+
+func TestParseTokenFallbackURLs(t *testing.T) {
+	got, err := parseTokenFallbackURLs(
+		" https://eu.example.com/oauth/token, ,https://us.example.com/token")
+	if err != nil {
+		t.Fatalf("parseTokenFallbackURLs() error = %v", err)
+	}
+	want := []string{"https://eu.example.com/oauth/token", "https://us.example.com/token"}
+	if !slices.Equal(got, want) {
+		t.Errorf("parseTokenFallbackURLs() = %v, want %v", got, want)
+	}
+
+	for _, bad := range []string{"/oauth/token", "ftp://eu.example.com/token"} {
+		if _, err := parseTokenFallbackURLs(bad); err == nil {
+			t.Errorf("parseTokenFallbackURLs(%q) expected error", bad)
+		}
+	}
+}
+
+func TestExchangeCode_FailsOverAndSticks(t *testing.T) {
+	replica := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"replica-access-token","refresh_token":"rt",` +
+			`"token_type":"Bearer","expires_in":300}`))
+	}))
+	defer replica.Close()
+	setTestServer(t, replica)
+
+	// The primary is a closed listener: connections are refused.
+	primary := httptest.NewServer(http.NotFoundHandler())
+	primary.Close()
+	cfg.ServerURL = primary.URL
+
+	origFallbacks, origState := cfg.TokenFallbackURLs, tokenEndpointState.path
+	t.Cleanup(func() {
+		cfg.TokenFallbackURLs, tokenEndpointState.path = origFallbacks, origState
+	})
+	cfg.TokenFallbackURLs = []string{replica.URL + "/oauth/token"}
+	tokenEndpointState.path = filepath.Join(t.TempDir(), "token-endpoints.json")
+
+	if got := tokenEndpoints(tokenKey())[0]; got != primary.URL+"/oauth/token" {
+		t.Fatalf("first endpoint before any grant = %q, want the primary", got)
+	}
+
+	storage, err := exchangeCode(context.Background(), "code", "verifier")
+	if err != nil {
+		t.Fatalf("exchangeCode() error = %v", err)
+	}
+	if storage.AccessToken != "replica-access-token" {
+		t.Errorf("AccessToken = %q, want replica-access-token", storage.AccessToken)
+	}
+
+	// The replica issued the token, so refreshes try it first.
+	if got := tokenEndpoints(tokenKey())[0]; got != replica.URL+"/oauth/token" {
+		t.Errorf("first endpoint after failover = %q, want the replica", got)
+	}
+	if _, err := refreshAccessToken(context.Background(), "rt"); err != nil {
+		t.Errorf("refreshAccessToken() error = %v", err)
+	}
+}
+
+func TestPostTokenRequest_NoFailoverOnServerError(t *testing.T) {
+	var fallbackCalls int
+	fallback := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		fallbackCalls++
+	}))
+	defer fallback.Close()
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+	setTestServer(t, primary)
+
+	origFallbacks := cfg.TokenFallbackURLs
+	t.Cleanup(func() { cfg.TokenFallbackURLs = origFallbacks })
+	cfg.TokenFallbackURLs = []string{fallback.URL + "/oauth/token"}
+
+	resp, _, err := postTokenRequest(context.Background(), url.Values{}, tokenKey())
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("postTokenRequest() succeeded against a failing primary")
+	}
+	if fallbackCalls != 0 {
+		t.Errorf("fallback called %d times after the primary answered 503, want 0", fallbackCalls)
+	}
+}
+
+func TestMintAudienceToken_SticksToBaseKey(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"audience-access-token","token_type":"Bearer",` +
+			`"expires_in":300}`))
+	}))
+	defer srv.Close()
+	setTestServer(t, srv)
+	setTokenTestConfig(t, "https://api.example.com")
+
+	origFallbacks, origState := cfg.TokenFallbackURLs, tokenEndpointState.path
+	t.Cleanup(func() {
+		cfg.TokenFallbackURLs, tokenEndpointState.path = origFallbacks, origState
+	})
+	cfg.TokenFallbackURLs = []string{"https://replica.example.com/oauth/token"}
+	tokenEndpointState.path = filepath.Join(t.TempDir(), "token-endpoints.json")
+
+	if err := cfg.TokenStore.Save(cfg.ClientID, credstore.Token{
+		AccessToken:  "base-access-token",
+		RefreshToken: "base-refresh",
+		ClientID:     cfg.ClientID,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mintAudienceToken(context.Background(), tokenKey()); err != nil {
+		t.Fatalf("mintAudienceToken() error = %v", err)
+	}
+	if got := stickyEndpoint(cfg.ClientID); got != srv.URL+"/oauth/token" {
+		t.Errorf("sticky endpoint of the base key = %q, want the issuing endpoint", got)
+	}
+	if got := stickyEndpoint(tokenKey()); got != "" {
+		t.Errorf("sticky endpoint recorded under the audience key %q", got)
+	}
+}
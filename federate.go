@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// OAuth 2.0 Token Exchange (RFC 8693) identifiers.
+const (
+	grantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+	tokenTypeIDToken       = "urn:ietf:params:oauth:token-type:id_token"
+	tokenTypeAccessToken   = "urn:ietf:params:oauth:token-type:access_token"
+)
+
+// CI providers whose OIDC tokens `federate -from` accepts.
+const (
+	federateGitHubActions = "github-actions"
+	federateGitLabCI      = "gitlab-ci"
+)
+
+// gitlabIDTokenEnv is the variable a GitLab job declares under id_tokens for
+// federate to read; GitLab has no endpoint to request one at run time.
+const gitlabIDTokenEnv = "AUTHGATE_ID_TOKEN"
+
+// runFederate implements `oauth-cli federate -from github-actions|gitlab-ci`:
+// it reads the CI job's OIDC token and exchanges it at the token endpoint for
+// an access token (RFC 8693), which is printed to stdout. Nothing is stored,
+// so a CI job needs neither a client secret nor a refresh token.
+func runFederate(ctx context.Context) int {
+	initConfig()
+
+	err := func() error {
+		if cfg.FederateFrom == "" {
+			return errors.New("-from is required (github-actions or gitlab-ci)")
+		}
+		aud := cfg.CIAudience
+		if aud == "" {
+			aud = cfg.ServerURL
+		}
+		subjectToken, err := ciIDToken(ctx, cfg.FederateFrom, aud)
+		if err != nil {
+			return err
+		}
+		accessToken, err := exchangeSubjectToken(ctx, subjectToken)
+		if err != nil {
+			return err
+		}
+		fmt.Println(accessToken)
+		return nil
+	}()
+	auditLog.record("federate", cfg.FederateFrom, err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// ciIDToken returns the OIDC token of the current CI job. GitHub Actions
+// mints one for aud on request (the job needs `permissions: id-token: write`);
+// GitLab CI provides it through gitlabIDTokenEnv, with the audience set in
+// the job's id_tokens block.
+func ciIDToken(ctx context.Context, from, aud string) (string, error) {
+	switch from {
+	case federateGitHubActions:
+		requestURL := os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL")
+		requestToken := os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN")
+		if requestURL == "" || requestToken == "" {
+			return "", errors.New(
+				"ACTIONS_ID_TOKEN_REQUEST_URL is not set; " +
+					"run in GitHub Actions with `permissions: id-token: write`")
+		}
+		return fetchGitHubIDToken(ctx, requestURL, requestToken, aud)
+	case federateGitLabCI:
+		if token := os.Getenv(gitlabIDTokenEnv); token != "" {
+			return token, nil
+		}
+		return "", fmt.Errorf("%s is not set; declare it under id_tokens in .gitlab-ci.yml",
+			gitlabIDTokenEnv)
+	default:
+		return "", fmt.Errorf("unknown CI provider %q (must be github-actions or gitlab-ci)", from)
+	}
+}
+
+// fetchGitHubIDToken requests an OIDC token for aud from the GitHub Actions
+// token service.
+func fetchGitHubIDToken(ctx context.Context, requestURL, requestToken, aud string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, apiCallTimeout)
+	defer cancel()
+
+	u, err := url.Parse(requestURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid ACTIONS_ID_TOKEN_REQUEST_URL: %w", err)
+	}
+	query := u.Query()
+	query.Set("audience", aud)
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+requestToken)
+	req.Header.Set("Accept", "application/json")
+
+	// The default client, not cfg.HTTPClient: GitHub is not the authorization
+	// server, so its pins, resolver and Unix socket do not apply.
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("GitHub OIDC token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := readResponseBody(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GitHub OIDC token request failed with status %d: %s",
+			resp.StatusCode, errorBodySnippet(body))
+	}
+	var tokenResp struct {
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(body, &tokenResp); err != nil || tokenResp.Value == "" {
+		return "", errors.New("GitHub OIDC token response has no value")
+	}
+	return tokenResp.Value, nil
+}
+
+// exchangeSubjectToken exchanges subjectToken, an OIDC ID token, for an access
+// token at the token endpoint.
+func exchangeSubjectToken(ctx context.Context, subjectToken string) (_ string, err error) {
+	ctx, span := startSpan(ctx, "oauth.federate", spanKindInternal)
+	defer func() { span.end(err) }()
+	span.set("oauth.grant_type", grantTypeTokenExchange)
+
+	ctx, cancel := context.WithTimeout(ctx, tokenExchangeTimeout)
+	defer cancel()
+
+	data := url.Values{}
+	data.Set("grant_type", grantTypeTokenExchange)
+	data.Set("subject_token", subjectToken)
+	data.Set("subject_token_type", tokenTypeIDToken)
+	data.Set("requested_token_type", tokenTypeAccessToken)
+	data.Set("client_id", cfg.ClientID)
+	if cfg.Scope != "" {
+		data.Set("scope", strings.ReplaceAll(cfg.Scope, " ", cfg.ScopeSeparator))
+	}
+	setAudienceParams(data)
+
+	resp, _, err := postTokenRequest(ctx, data, tokenKey())
+	if err != nil {
+		return "", fmt.Errorf("token exchange request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := readResponseBody(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", parseOAuthError(resp.StatusCode, body, "token exchange")
+	}
+
+	tokenResp, err := decodeTokenResponse(resp.Header.Get("Content-Type"), body)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse token response: %w", err)
+	}
+	if tokenResp.Error != "" {
+		return "", fmt.Errorf("%s: %s", tokenResp.Error, tokenResp.ErrorDescription)
+	}
+	// RFC 8693 §2.2.1: token_type may be N_A for non-bearer tokens, which
+	// this command cannot use, so the usual Bearer check applies.
+	if err := validateTokenResponse(
+		tokenResp.AccessToken,
+		tokenResp.TokenType,
+		int(tokenResp.ExpiresIn),
+	); err != nil {
+		return "", fmt.Errorf("invalid token response: %w", err)
+	}
+	return tokenResp.AccessToken, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCIIDToken_GitHubActions(t *testing.T) {
+	var gotAuth, gotAudience string
+	gh := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		gotAudience = r.URL.Query().Get("audience")
+		_, _ = w.Write([]byte(`{"value":"github-oidc-token"}`))
+	}))
+	defer gh.Close()
+	t.Setenv("ACTIONS_ID_TOKEN_REQUEST_URL", gh.URL+"/token?api-version=2.0")
+	t.Setenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN", "request-token")
+
+	token, err := ciIDToken(context.Background(), federateGitHubActions, "https://auth.example.com")
+	if err != nil {
+		t.Fatalf("ciIDToken() error: %v", err)
+	}
+	if token != "github-oidc-token" {
+		t.Errorf("token = %q", token)
+	}
+	if gotAuth != "Bearer request-token" || gotAudience != "https://auth.example.com" {
+		t.Errorf("request Authorization = %q, audience = %q", gotAuth, gotAudience)
+	}
+}
+
+func TestCIIDToken_Missing(t *testing.T) {
+	t.Setenv("ACTIONS_ID_TOKEN_REQUEST_URL", "")
+	t.Setenv(gitlabIDTokenEnv, "")
+
+	for _, from := range []string{federateGitHubActions, federateGitLabCI, "jenkins"} {
+		if _, err := ciIDToken(context.Background(), from, "aud"); err == nil {
+			t.Errorf("ciIDToken(%q) succeeded without a CI token", from)
+		}
+	}
+
+	t.Setenv(gitlabIDTokenEnv, "gitlab-oidc-token")
+	if token, err := ciIDToken(context.Background(), federateGitLabCI, "aud"); err != nil ||
+		token != "gitlab-oidc-token" {
+		t.Errorf("ciIDToken(gitlab-ci) = %q, %v", token, err)
+	}
+}
+
+func TestExchangeSubjectToken(t *testing.T) {
+	var form map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		form = map[string]string{}
+		for k := range r.PostForm {
+			form[k] = r.PostForm.Get(k)
+		}
+		if r.PostForm.Get("subject_token") != "ci-oidc-token" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant","error_description":"untrusted issuer"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"federated-access-token","token_type":"Bearer",` +
+			`"issued_token_type":"urn:ietf:params:oauth:token-type:access_token","expires_in":600}`))
+	}))
+	defer srv.Close()
+	setTestServer(t, srv)
+	setTokenTestConfig(t, "api://deploy")
+
+	got, err := exchangeSubjectToken(context.Background(), "ci-oidc-token")
+	if err != nil {
+		t.Fatalf("exchangeSubjectToken() error: %v", err)
+	}
+	if got != "federated-access-token" {
+		t.Errorf("access token = %q", got)
+	}
+	for k, want := range map[string]string{
+		"grant_type":         grantTypeTokenExchange,
+		"subject_token_type": tokenTypeIDToken,
+		"client_id":          "test-client",
+		"audience":           "api://deploy",
+	} {
+		if form[k] != want {
+			t.Errorf("%s = %q, want %q", k, form[k], want)
+		}
+	}
+	if _, ok := form["client_secret"]; ok {
+		t.Error("public client sent client_secret")
+	}
+
+	_, err = exchangeSubjectToken(context.Background(), "forged-token")
+	if err == nil || !strings.Contains(err.Error(), "untrusted issuer") {
+		t.Errorf("exchangeSubjectToken(forged) error = %v", err)
+	}
+}
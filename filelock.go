@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Defaults of -lock-stale-age, -lock-timeout and -lock-retry-delay.
+const (
+	defaultLockStaleAge   = 30 * time.Second
+	defaultLockTimeout    = 10 * time.Second
+	defaultLockRetryDelay = 50 * time.Millisecond
+)
+
+// acquireFileLock takes the cross-process lock for path: a <path>.lock file
+// created exclusively, the same scheme the sdk-go file store uses for the
+// token file, holding the PID of its owner. While the lock is held by
+// someone else it retries every cfg.LockRetryDelay, with jitter so waiting
+// processes do not retry in step, for up to cfg.LockTimeout. The returned
+// function releases the lock.
+func acquireFileLock(path string) (func(), error) {
+	lockPath := path + ".lock"
+	deadline := clock.Now().Add(cfg.LockTimeout)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			_, err = f.WriteString(strconv.Itoa(os.Getpid()))
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(lockPath)
+				return nil, fmt.Errorf("failed to write lock file: %w", err)
+			}
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("failed to create lock file: %w", err)
+		}
+		if staleLock(lockPath, clock.Now()) {
+			os.Remove(lockPath)
+			continue
+		}
+		if clock.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock file %s", lockPath)
+		}
+		time.Sleep(lockRetryDelay(cfg.LockRetryDelay))
+	}
+}
+
+// staleLock reports whether the lock file at lockPath was left behind: it is
+// older than cfg.LockStaleAge and the process recorded in it is no longer
+// running, so a slow writer keeps its lock however long it takes. A lock
+// without a readable PID (written by another tool) is judged by its age.
+func staleLock(lockPath string, now time.Time) bool {
+	info, err := os.Stat(lockPath)
+	if err != nil || now.Sub(info.ModTime()) <= cfg.LockStaleAge {
+		return false
+	}
+	data, err := os.ReadFile(lockPath)
+	if err != nil {
+		return false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return true
+	}
+	return !processAlive(pid)
+}
+
+// processAlive reports whether a process with pid is running. On Windows,
+// finding the process opens a handle to it, which fails once it has exited;
+// elsewhere signal 0 probes it without delivering anything.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		_ = p.Release()
+		return true
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// lockRetryDelay returns d spread uniformly over [d/2, 3d/2).
+func lockRetryDelay(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d)
+}
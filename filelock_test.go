@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAcquireFileLock_WaitsForRelease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	release, err := acquireFileLock(path)
+	if err != nil {
+		t.Fatalf("acquireFileLock() error: %v", err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		release2, err := acquireFileLock(path)
+		if err != nil {
+			t.Errorf("second acquireFileLock() error: %v", err)
+		} else {
+			release2()
+		}
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("lock acquired while still held")
+	case <-time.After(200 * time.Millisecond):
+	}
+	release()
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("lock not acquired after release")
+	}
+}
+
+func TestAcquireFileLock_RemovesStaleLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	lockPath := path + ".lock"
+	if err := os.WriteFile(lockPath, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * cfg.LockStaleAge)
+	if err := os.Chtimes(lockPath, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	release, err := acquireFileLock(path)
+	if err != nil {
+		t.Fatalf("acquireFileLock() error: %v", err)
+	}
+	release()
+	if _, err := os.Stat(lockPath); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("lock file still present after release: %v", err)
+	}
+}
+
+// writeAgedLock creates the lock file for path holding pid, older than
+// cfg.LockStaleAge.
+func writeAgedLock(t *testing.T, path string, pid int) {
+	t.Helper()
+	lockPath := path + ".lock"
+	if err := os.WriteFile(lockPath, []byte(strconv.Itoa(pid)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * cfg.LockStaleAge)
+	if err := os.Chtimes(lockPath, old, old); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAcquireFileLock_KeepsLockOfLiveProcess(t *testing.T) {
+	origTimeout := cfg.LockTimeout
+	t.Cleanup(func() { cfg.LockTimeout = origTimeout })
+	cfg.LockTimeout = 200 * time.Millisecond
+
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	writeAgedLock(t, path, os.Getpid())
+
+	if release, err := acquireFileLock(path); err == nil {
+		release()
+		t.Fatal("acquireFileLock() broke the lock of a running process")
+	}
+	if _, err := os.Stat(path + ".lock"); err != nil {
+		t.Errorf("lock file of a running process removed: %v", err)
+	}
+}
+
+func TestAcquireFileLock_BreaksLockOfExitedProcess(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	writeAgedLock(t, path, cmd.Process.Pid)
+
+	release, err := acquireFileLock(path)
+	if err != nil {
+		t.Fatalf("acquireFileLock() error: %v", err)
+	}
+	defer release()
+	data, err := os.ReadFile(path + ".lock")
+	if err != nil || string(data) != strconv.Itoa(os.Getpid()) {
+		t.Errorf("lock file = %q, %v; want this process's PID", data, err)
+	}
+}
+
+func TestLockRetryDelay(t *testing.T) {
+	d := 100 * time.Millisecond
+	seen := make(map[time.Duration]bool)
+	for range 100 {
+		got := lockRetryDelay(d)
+		if got < d/2 || got >= d*3/2 {
+			t.Fatalf("lockRetryDelay(%s) = %s, want within [%s, %s)", d, got, d/2, d*3/2)
+		}
+		seen[got] = true
+	}
+	if len(seen) < 2 {
+		t.Error("lockRetryDelay() returned the same delay every time")
+	}
+}
+
+func TestStaleLock_UsesClock(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), "tokens.json.lock")
+	if err := os.WriteFile(lockPath, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := setFakeClock(t, info.ModTime())
+	if staleLock(lockPath, clock.Now()) {
+		t.Fatal("fresh lock reported stale")
+	}
+	c.Advance(cfg.LockStaleAge + time.Second)
+	if !staleLock(lockPath, clock.Now()) {
+		t.Error("lock past -lock-stale-age on the clock not reported stale")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/go-authgate/oauth-cli/tui"
+)
+
+// formatFuncs are the functions available to -format templates besides the
+// text/template builtins.
+var formatFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"join": func(sep string, elems []string) string {
+		return strings.Join(elems, sep)
+	},
+}
+
+// parseFormat parses a -format template.
+func parseFormat(text string) (*template.Template, error) {
+	return template.New("format").Funcs(formatFuncs).Parse(text)
+}
+
+// writeFormat executes tmpl with data, adding a trailing newline unless the
+// output already ends with one. Nothing is written if execution fails.
+func writeFormat(w io.Writer, tmpl *template.Template, data any) error {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return err
+	}
+	if buf.Len() > 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// statusView is the data `status -format` templates see: the stored token
+// plus the facts `status` prints about it.
+type statusView struct {
+	tui.TokenStorage
+	Server          string
+	TokenStore      string
+	ReadOnly        bool
+	Valid           bool
+	ExpiresIn       time.Duration
+	HasRefreshToken bool
+	Session         string
+
+	// Fingerprint and RefreshFingerprint identify the tokens without
+	// revealing them (see tui.TokenFingerprint).
+	Fingerprint        string
+	RefreshFingerprint string
+}
+
+// newStatusView summarizes tok as of now. Session is "offline", "online" or
+// "" (see sessionKind).
+func newStatusView(tok *tui.TokenStorage, now time.Time) statusView {
+	v := statusView{
+		TokenStorage:    *tok,
+		Server:          cfg.ServerURL,
+		TokenStore:      cfg.TokenStoreMode,
+		ReadOnly:        cfg.ReadOnly,
+		Valid:           tui.TokenValid(tok, now),
+		HasRefreshToken: tok.RefreshToken != "",
+		Fingerprint:     tui.TokenFingerprint(tok.AccessToken),
+	}
+	if !tok.ExpiresAt.IsZero() {
+		v.ExpiresIn = tok.ExpiresAt.Sub(now).Round(time.Second)
+	}
+	if tok.RefreshToken != "" {
+		v.RefreshFingerprint = tui.TokenFingerprint(tok.RefreshToken)
+	}
+	v.Session = sessionKind(tokenKey(), tok)
+	return v
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-authgate/oauth-cli/tui"
+)
+
+func TestWriteFormat(t *testing.T) {
+	tok := &tui.TokenStorage{AccessToken: "access", RefreshToken: "refresh", TokenType: "Bearer"}
+	tests := []struct {
+		format string
+		data   any
+		want   string
+	}{
+		{"{{.AccessToken}}", tok, "access\n"},
+		{"{{.TokenType}} {{.AccessToken}}\n", tok, "Bearer access\n"},
+		{`{{join "," .Scopes}}`, identity{Scopes: []string{"read", "write"}}, "read,write\n"},
+		{"{{json .Scopes}}", identity{Scopes: []string{"read"}}, "[\"read\"]\n"},
+		{"", tok, ""},
+	}
+	for _, tt := range tests {
+		tmpl, err := parseFormat(tt.format)
+		if err != nil {
+			t.Fatalf("parseFormat(%q) error = %v", tt.format, err)
+		}
+		var out strings.Builder
+		if err := writeFormat(&out, tmpl, tt.data); err != nil {
+			t.Fatalf("writeFormat(%q) error = %v", tt.format, err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("writeFormat(%q) = %q, want %q", tt.format, out.String(), tt.want)
+		}
+	}
+
+	if _, err := parseFormat("{{.AccessToken"); err == nil {
+		t.Error("parseFormat() of an unterminated action succeeded")
+	}
+	tmpl, _ := parseFormat("{{.NoSuchField}}")
+	var out strings.Builder
+	if err := writeFormat(&out, tmpl, tok); err == nil || out.Len() != 0 {
+		t.Errorf("writeFormat() with an unknown field = %q, %v; want an error and no output",
+			out.String(), err)
+	}
+}
+
+func TestNewStatusView(t *testing.T) {
+	setTokenTestConfig(t, "")
+	origPath := grantedScopeState.path
+	t.Cleanup(func() { grantedScopeState.path = origPath })
+	grantedScopeState.path = filepath.Join(t.TempDir(), "granted-scopes.json")
+	recordGrantedScope(tokenKey(), "offline_access read")
+	now := time.Now()
+
+	v := newStatusView(&tui.TokenStorage{
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		ExpiresAt:    now.Add(90 * time.Second),
+	}, now)
+	if !v.Valid || v.ExpiresIn != 90*time.Second || !v.HasRefreshToken ||
+		v.Session != "offline" || v.AccessToken != "access" {
+		t.Errorf("newStatusView() = %+v", v)
+	}
+
+	v = newStatusView(&tui.TokenStorage{ExpiresAt: now.Add(-time.Minute)}, now)
+	if v.Valid || v.ExpiresIn != -time.Minute || v.Session != "" {
+		t.Errorf("newStatusView() of an expired token = %+v", v)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/go-authgate/oauth-cli/tui"
+	"github.com/go-authgate/sdk-go/credstore"
+)
+
+// machineBindingParam is the token request parameter carrying the machine
+// binding with -bind-machine; AuthGate records it with the grant.
+const machineBindingParam = "machine_binding"
+
+// errMachineBinding is returned when a stored token was not issued on this
+// machine (for example, a token file copied from another host).
+var errMachineBinding = errors.New(
+	"stored token is not bound to this machine (-bind-machine); log in again")
+
+// machineBinding returns a stable, non-reversible identifier of this machine:
+// a truncated SHA-256 of the OS machine ID and the hostname. Neither value is
+// sent or stored in the clear.
+var machineBinding = sync.OnceValue(func() string {
+	host, _ := os.Hostname()
+	sum := sha256.Sum256([]byte("authgate-machine-binding\x00" + machineID() + "\x00" + host))
+	return hex.EncodeToString(sum[:16])
+})
+
+var (
+	ioregUUID  = regexp.MustCompile(`"IOPlatformUUID" = "([^"]+)"`)
+	regMachine = regexp.MustCompile(`MachineGuid\s+REG_SZ\s+(\S+)`)
+)
+
+// setMachineBinding adds the machine binding to a token request when
+// -bind-machine is set.
+func setMachineBinding(params url.Values) {
+	if cfg.BindMachine {
+		params.Set(machineBindingParam, machineBinding())
+	}
+}
+
+// machineID returns the operating system's machine identifier, or "" when
+// it cannot be read (the binding then rests on the hostname alone).
+func machineID() string {
+	switch runtime.GOOS {
+	case "darwin":
+		out, err := exec.Command("ioreg", "-rd1", "-c", "IOPlatformExpertDevice").Output()
+		if m := ioregUUID.FindSubmatch(out); err == nil && m != nil {
+			return string(m[1])
+		}
+	case "windows":
+		out, err := exec.Command("reg", "query",
+			`HKLM\SOFTWARE\Microsoft\Cryptography`, "/v", "MachineGuid").Output()
+		if m := regMachine.FindSubmatch(out); err == nil && m != nil {
+			return string(m[1])
+		}
+	default:
+		for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+			if data, err := os.ReadFile(path); err == nil {
+				if id := strings.TrimSpace(string(data)); id != "" {
+					return id
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// machineBindingRecord ties the token stored under a key to the machine it
+// was saved on. Only the token's fingerprint is kept.
+type machineBindingRecord struct {
+	Token   string `json:"token"`
+	Machine string `json:"machine"`
+}
+
+// boundStore enforces -bind-machine: Save records which machine stored each
+// token, and Load refuses tokens that have no record for this machine. The
+// records live in the user cache directory, so a token file copied to
+// another host (with or without the records) is rejected there.
+type boundStore struct {
+	credstore.Store[credstore.Token]
+	path    string
+	machine string
+	mu      sync.Mutex
+}
+
+func (s *boundStore) load() map[string]machineBindingRecord {
+	records := make(map[string]machineBindingRecord)
+	if data, err := os.ReadFile(s.path); err == nil {
+		_ = json.Unmarshal(data, &records)
+	}
+	return records
+}
+
+func (s *boundStore) Load(id string) (credstore.Token, error) {
+	tok, err := s.Store.Load(id)
+	if err != nil {
+		return tok, err
+	}
+	s.mu.Lock()
+	rec, ok := s.load()[stickyEndpointKey(id)]
+	s.mu.Unlock()
+	if !ok || rec.Machine != s.machine || rec.Token != tui.TokenFingerprint(tok.AccessToken) {
+		return credstore.Token{}, errMachineBinding
+	}
+	return tok, nil
+}
+
+func (s *boundStore) Save(id string, tok credstore.Token) error {
+	if err := s.Store.Save(id, tok); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records := s.load()
+	records[stickyEndpointKey(id)] = machineBindingRecord{
+		Token:   tui.TokenFingerprint(tok.AccessToken),
+		Machine: s.machine,
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	return writeFileSync(s.path, data)
+}
+
+func (s *boundStore) Delete(id string) error {
+	if err := s.Store.Delete(id); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records := s.load()
+	if _, ok := records[stickyEndpointKey(id)]; !ok {
+		return nil
+	}
+	delete(records, stickyEndpointKey(id))
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileSync(s.path, data)
+}
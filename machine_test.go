@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-authgate/sdk-go/credstore"
+)
+
+func TestBoundStore(t *testing.T) {
+	dir := t.TempDir()
+	base := credstore.NewTokenFileStore(filepath.Join(dir, "tokens.json"))
+	records := filepath.Join(dir, "machine-bindings.json")
+	here := &boundStore{Store: base, path: records, machine: "machine-a"}
+	tok := credstore.Token{AccessToken: "bound-access-token", RefreshToken: "refresh"}
+
+	if err := here.Save("client", tok); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if got, err := here.Load("client"); err != nil || got.AccessToken != tok.AccessToken {
+		t.Errorf("Load() on the same machine = %+v, %v", got, err)
+	}
+
+	// The token file and the records copied to another machine.
+	elsewhere := &boundStore{Store: base, path: records, machine: "machine-b"}
+	if _, err := elsewhere.Load("client"); !errors.Is(err, errMachineBinding) {
+		t.Errorf("Load() on another machine error = %v, want errMachineBinding", err)
+	}
+
+	// A token written to the store without going through the binding.
+	if err := base.Save("client", credstore.Token{AccessToken: "copied-access-token"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := here.Load("client"); !errors.Is(err, errMachineBinding) {
+		t.Errorf("Load() of an unbound token error = %v, want errMachineBinding", err)
+	}
+}
+
+func TestSetMachineBinding(t *testing.T) {
+	orig := cfg.BindMachine
+	t.Cleanup(func() { cfg.BindMachine = orig })
+
+	for _, enabled := range []bool{false, true} {
+		cfg.BindMachine = enabled
+		params := url.Values{}
+		setMachineBinding(params)
+		if got := params.Get(machineBindingParam); (got != "") != enabled || len(got) > 32 {
+			t.Errorf("bindMachine=%v: %s = %q", enabled, machineBindingParam, got)
+		}
+	}
+	if machineBinding() != machineBinding() {
+		t.Error("machineBinding() is not stable")
+	}
+}
@@ -1,22 +1,32 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"crypto"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"math"
+	"mime"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
 	"syscall"
+	"text/template"
 	"time"
+	"unicode"
 
 	"github.com/go-authgate/oauth-cli/tui"
 	"github.com/go-authgate/sdk-go/credstore"
@@ -28,43 +38,324 @@ import (
 	"github.com/joho/godotenv"
 )
 
+// Config holds the settings of a run. doInitConfig fills cfg from flags,
+// environment variables and defaults; the rest of the package reads them
+// from there, and tests swap individual fields. cfg is still process-wide,
+// as are activeProvider, clock and the cache-dir state, so tests that change
+// them cannot run in parallel.
+type Config struct {
+	ServerURL      string
+	ClientID       string
+	ClientSecret   string
+	RedirectURI    string
+	CallbackPort   int
+	Scope          string
+	ScopeSeparator string
+	Audience       string
+	Resource       string
+	PKCEMethod     string
+	PKCEBytes      int
+	Discovery      bool
+	DiscoveryTTL   time.Duration
+	StateKey       []byte
+	StateMaxAge    time.Duration
+	RevokeOnAbort  bool
+	OutputFormat   string
+	ShowToken      bool
+	ReadOnly       bool
+	TokenFile      string
+	TokenStore     credstore.Store[credstore.Token]
+	TokenStoreMode string
+	WincredRoaming bool
+	OPVault        string
+	PassPath       string
+	HTTPClient     *http.Client
+	RetryClient    *retry.Client
+	NoRetryClient  *retry.Client // for requests that must not be repeated
+
+	// ClientIDOptional is set by subcommands that only talk to public server
+	// endpoints and therefore do not require CLIENT_ID.
+	ClientIDOptional bool
+
+	// CallbackTimeout is how long to wait for the browser callback.
+	CallbackTimeout time.Duration
+
+	// ReopenAfter re-opens the browser once when the callback is this late;
+	// 0 disables it.
+	ReopenAfter time.Duration
+
+	// PublicRedirectURI is the redirect URI sent to the server when the
+	// callback server is reached through a forward (-public-redirect-uri or
+	// a detected remote development environment); "" sends RedirectURI.
+	PublicRedirectURI string
+
+	// BrowserApp is the -browser login opens instead of the system default;
+	// BrowserProfile and BrowserArgs are passed to it.
+	BrowserApp     string
+	BrowserProfile string
+	BrowserArgs    []string
+
+	// RefreshBefore refreshes stored tokens this long before they expire; a
+	// failed early refresh falls back to the still-valid token.
+	RefreshBefore time.Duration
+
+	// TokenFallbackURLs are tried in order when the token endpoint cannot be
+	// reached.
+	TokenFallbackURLs []string
+
+	// TokenInfoPathSet reports that -tokeninfo-path or TOKENINFO_PATH was
+	// given, so discovery keeps the token info endpoint.
+	TokenInfoPathSet bool
+
+	// ServerSocket is the Unix socket the server is reached through when
+	// SERVER_URL is unix:///path; ServerURL then names unixSocketHost.
+	ServerSocket string
+
+	// ListenURLFile receives the callback URL and state once the callback
+	// server listens; "" disables it.
+	ListenURLFile string
+
+	// NudgeWindow is how close to expiry the stored refresh token must be
+	// for refreshNudge to warn; 0 disables the warning.
+	NudgeWindow time.Duration
+
+	// BindMachine sends the machine binding with token requests and refuses
+	// stored tokens saved on another machine.
+	BindMachine bool
+
+	// LockStaleAge, LockTimeout and LockRetryDelay tune acquireFileLock: how
+	// old a lock of an exited process must be before it is broken, how long
+	// to wait for the lock, and the (jittered) pause between attempts.
+	LockStaleAge   time.Duration
+	LockTimeout    time.Duration
+	LockRetryDelay time.Duration
+
+	// RawOutput prints tokeninfo responses exactly as received.
+	RawOutput bool
+
+	// TokenInfoCacheTTL is how long positive token info responses are
+	// reused within a run; 0 disables the cache.
+	TokenInfoCacheTTL time.Duration
+
+	// FederateFrom is the CI provider whose OIDC token federate exchanges;
+	// CIAudience is the audience requested for it ("" means ServerURL).
+	FederateFrom string
+	CIAudience   string
+
+	// APIURL is the base URL call resolves paths against; CallData is its
+	// request body (-data) and CallInclude prints response headers.
+	// CallAnyOrigin lets call send the token to absolute URLs on other
+	// origins.
+	APIURL        string
+	CallData      string
+	CallInclude   bool
+	CallAnyOrigin bool
+
+	// TokenTypeHint is the token_type_hint `revoke -` sends; "" sends none.
+	TokenTypeHint string
+
+	// RevokeAll makes revoke cover every stored entry of the client.
+	RevokeAll bool
+
+	// StatusDiff and StatusSnapshot name the snapshot files status compares
+	// the token file with and writes it to.
+	StatusDiff     string
+	StatusSnapshot string
+
+	// BenchConcurrency and BenchDuration are the number of workers and the
+	// length of a `bench refresh` run.
+	BenchConcurrency int
+	BenchDuration    time.Duration
+
+	// FormatTemplate renders the output of token, status and whoami
+	// (-format); nil keeps their default output.
+	FormatTemplate *template.Template
+
+	// TokenAuthMethod is the configured -token-auth-method ("" chooses one;
+	// see tokenAuthMethodFor). ClientCert and ClientKey are the loaded
+	// -client-cert and -client-key.
+	TokenAuthMethod string
+	ClientCert      *tls.Certificate
+	ClientKey       crypto.Signer
+
+	// ConfirmIdentity holds tokens from a new login until the user confirms
+	// the signed-in account in the terminal.
+	ConfirmIdentity bool
+
+	// StrictChecks makes a failed token verification or API check after
+	// login fail the run, and treats a missing token info endpoint as an
+	// error rather than a skipped step.
+	StrictChecks bool
+
+	// ExpectedIssuer is the issuer that must be returned in the iss parameter
+	// of the authorization response (RFC 9207); "" when the server does not
+	// advertise it.
+	ExpectedIssuer string
+
+	// DiscoveryCacheDir holds cached metadata documents; "" disables the cache.
+	DiscoveryCacheDir string
+
+	// Progress writes -progress=json events; nil while the TUI shows progress.
+	Progress *progressWriter
+
+	// Timings collects per-request HTTP timings; nil unless -timing is set.
+	Timings *timingRecorder
+}
+
+// cfg is the configuration of the current run.
+var cfg = Config{
+	ScopeSeparator:    " ",
+	CallbackTimeout:   defaultCallbackTimeout,
+	TokenInfoCacheTTL: defaultTokenInfoCacheTTL,
+	LockStaleAge:      defaultLockStaleAge,
+	LockTimeout:       defaultLockTimeout,
+	LockRetryDelay:    defaultLockRetryDelay,
+}
+
 var (
-	serverURL      string
-	clientID       string
-	clientSecret   string
-	redirectURI    string
-	callbackPort   int
-	scope          string
-	tokenFile      string
-	tokenStore     credstore.Store[credstore.Token]
 	configOnce     sync.Once
-	retryClient    *retry.Client
 	configWarnings []string
 
+	flagProvider     *string
+	flagTenant       *string
+	flagAuthorizeURL *string
+	flagTokenURL     *string
+	flagTokenInfoURL *string
+	flagFallbackURLs *string
 	flagServerURL    *string
 	flagClientID     *string
 	flagClientSecret *string
+	flagSecretStdin  *bool
+	flagTokenAuth    *string
+	flagClientCert   *string
+	flagClientKey    *string
 	flagRedirectURI  *string
+	flagPublicRedir  *string
 	flagCallbackPort *int
+	flagCallbackWait *time.Duration
+	flagListenURL    *string
+	flagReopenAfter  *time.Duration
+	flagBrowser      *string
+	flagBrowserProf  *string
+	flagBrowserArgs  *string
+	flagRefreshAhead *time.Duration
 	flagScope        *string
+	flagScopeSep     *string
+	flagAudience     *string
+	flagOffline      *bool
+	flagResource     *string
 	flagTokenFile    *string
 	flagTokenStore   *string
+	flagTiming       *bool
+	flagNudgeDays    *int
+	flagNoNudge      *bool
+	flagHTTP1        *bool
+	flagNoKeepAlive  *bool
+	flagIdlePerHost  *int
+	flagRateLimit    *float64
+	flagRateBurst    *int
+	flagBreakerFails *int
+	flagBreakerCool  *time.Duration
+	flagLockStale    *time.Duration
+	flagLockTimeout  *time.Duration
+	flagLockRetry    *time.Duration
+	flagDialTimeout  *time.Duration
+	flagResolver     *string
+	flagPinSHA256    pinList
+	flagPreferIP     *string
+	flagDebugLog     *string
+	flagAuditLog     *string
+	flagAuditMaxSize *int
+	flagOutput       *string
+	flagProgress     *string
+	flagLang         *string
+	flagShowToken    *bool
+	flagRaw          *bool
+	flagFederateFrom *string
+	flagCIAudience   *string
+	flagAPIURL       *string
+	flagData         *string
+	flagInclude      *bool
+	flagAnyOrigin    *bool
+	flagFormat       *string
+	flagTypeHint     *string
+	flagRevokeAll    *bool
+	flagDiff         *string
+	flagSnapshot     *string
+	flagConcurrency  *int
+	flagBenchTime    *time.Duration
+	flagConfirmIdent *bool
+	flagStrict       *bool
+	flagReadOnly     *bool
+	flagBindMachine  *bool
+	flagWincredRoam  *bool
+	flagOPVault      *string
+	flagPassPath     *string
+	flagRevokeAbort  *bool
+	flagPKCEMethod   *string
+	flagPKCEBytes    *int
+	flagDiscovery    *bool
+	flagDiscoveryTTL *time.Duration
+	flagTokenInfoTTL *time.Duration
+	flagSignedState  *bool
+	flagStateMaxAge  *time.Duration
 )
 
 const (
 	tokenExchangeTimeout     = 10 * time.Second
 	tokenVerificationTimeout = 10 * time.Second
 	refreshTokenTimeout      = 10 * time.Second
+	apiCallTimeout           = 10 * time.Second
 	maxResponseSize          = 1 << 20 // 1 MiB
+
+	// maxExpiresIn rejects token lifetimes no real server issues (one year),
+	// which would otherwise overflow or pin a token as valid indefinitely.
+	maxExpiresIn = 366 * 24 * 60 * 60
+
+	// maxErrorBodyEcho caps how much of a non-OAuth error body is quoted in
+	// error messages.
+	maxErrorBodyEcho = 512
 )
 
 func init() {
 	_ = godotenv.Load()
 
+	flagProvider = flag.String(
+		"provider",
+		"",
+		"Server type preset: "+providerNames()+" (default: authgate or PROVIDER env)",
+	)
+	flagTenant = flag.String(
+		"tenant",
+		"",
+		"Azure AD tenant ID or domain for -provider=azure (default: common or TENANT env)",
+	)
+	flagAuthorizeURL = flag.String(
+		"authorize-path",
+		"",
+		"Authorization endpoint path or URL, overriding the provider preset (or AUTHORIZE_PATH env)",
+	)
+	flagTokenURL = flag.String(
+		"token-path",
+		"",
+		"Token endpoint path or URL, overriding the provider preset (or TOKEN_PATH env)",
+	)
+	flagTokenInfoURL = flag.String(
+		"tokeninfo-path",
+		"",
+		"Token info endpoint path or URL, overriding the provider preset (or TOKENINFO_PATH env)",
+	)
+	flagFallbackURLs = flag.String(
+		"token-fallback-urls",
+		"",
+		"Comma-separated token endpoint URLs to fail over to when the token endpoint is unreachable "+
+			"(or TOKEN_FALLBACK_URLS env)",
+	)
 	flagServerURL = flag.String(
 		"server-url",
 		"",
-		"OAuth server URL (default: http://localhost:8080 or SERVER_URL env)",
+		"OAuth server URL, or unix:///path for a local socket "+
+			"(default: provider's URL, e.g. http://localhost:8080, or SERVER_URL env)",
 	)
 	flagClientID = flag.String("client-id", "", "OAuth client ID (required, or set CLIENT_ID env)")
 	flagClientSecret = flag.String(
@@ -72,17 +363,105 @@ func init() {
 		"",
 		"OAuth client secret (confidential clients only; omit for public/PKCE clients)",
 	)
+	flagSecretStdin = flag.Bool(
+		"secret-stdin",
+		false,
+		"Read the client secret from the first line of standard input",
+	)
+	flagTokenAuth = flag.String(
+		"token-auth-method",
+		"",
+		"Client authentication at the token endpoint: client_secret_basic, client_secret_post, "+
+			"private_key_jwt, tls_client_auth or none (default: from the credentials, or TOKEN_AUTH_METHOD env)",
+	)
+	flagClientCert = flag.String(
+		"client-cert",
+		"",
+		"PEM client certificate for tls_client_auth (needs -client-key; or CLIENT_CERT env)",
+	)
+	flagClientKey = flag.String(
+		"client-key",
+		"",
+		"PEM private key for private_key_jwt, or for -client-cert (or CLIENT_KEY env)",
+	)
 	flagRedirectURI = flag.String(
 		"redirect-uri",
 		"",
 		"Redirect URI registered with the OAuth server (default: http://localhost:CALLBACK_PORT/callback)",
 	)
+	flagPublicRedir = flag.String(
+		"public-redirect-uri",
+		"",
+		"Redirect URI sent to the server when the callback port is forwarded, or off "+
+			"(default: detected in Codespaces and Gitpod, or PUBLIC_REDIRECT_URI env)",
+	)
 	flagCallbackPort = flag.Int(
 		"port",
 		0,
 		"Local port for the callback server (default: 8888 or CALLBACK_PORT env)",
 	)
-	flagScope = flag.String("scope", "", "Space-separated OAuth scopes (default: \"read write\")")
+	flagCallbackWait = flag.Duration(
+		"callback-timeout",
+		0,
+		"How long to wait for the browser callback (default: 5m or CALLBACK_TIMEOUT env)",
+	)
+	flagReopenAfter = flag.Duration(
+		"reopen-after",
+		0,
+		"Open the browser again if no callback has arrived after this long, e.g. 60s (or REOPEN_AFTER env)",
+	)
+	flagBrowser = flag.String(
+		"browser",
+		"",
+		"Browser for login: chrome, chromium, edge, brave, firefox or a command "+
+			"(default: system default or BROWSER_APP env)",
+	)
+	flagBrowserProf = flag.String(
+		"browser-profile",
+		"",
+		"Browser profile to log in with, e.g. \"Profile 2\" (or BROWSER_PROFILE env)",
+	)
+	flagBrowserArgs = flag.String(
+		"browser-args",
+		"",
+		"Extra browser arguments, e.g. --incognito or -private-window (or BROWSER_ARGS env)",
+	)
+	flagRefreshAhead = flag.Duration(
+		"refresh-before",
+		0,
+		"Refresh a stored token this long before it expires, e.g. 2m; 0s refreshes only expired tokens (or REFRESH_BEFORE env)",
+	)
+	flagListenURL = flag.String(
+		"listen-url-file",
+		"",
+		"Write the callback URL and state as JSON to this file while the callback server listens "+
+			"(or LISTEN_URL_FILE env)",
+	)
+	flagScope = flag.String(
+		"scope",
+		"",
+		"Space- or comma-separated OAuth scopes (default: \"read write\" or the provider's default)",
+	)
+	flagScopeSep = flag.String(
+		"scope-separator",
+		"",
+		"Separator for scopes sent to the server: space, comma (default: space or SCOPE_SEPARATOR env)",
+	)
+	flagOffline = flag.Bool(
+		"offline",
+		false,
+		"Request the offline_access scope for a long-lived refresh token (or OFFLINE env)",
+	)
+	flagAudience = flag.String(
+		"audience",
+		"",
+		"Audience to request tokens for; tokens are cached per audience (or AUDIENCE env)",
+	)
+	flagResource = flag.String(
+		"resource",
+		"",
+		"Resource indicator (RFC 8707); tokens are cached per resource (or RESOURCE env)",
+	)
 	flagTokenFile = flag.String(
 		"token-file",
 		"",
@@ -91,7 +470,267 @@ func init() {
 	flagTokenStore = flag.String(
 		"token-store",
 		"",
-		"Token storage backend: auto, file, keyring (default: auto or TOKEN_STORE env)",
+		"Token storage backend: auto, file, keyring, wincred, op, pass, gopass, sops, memory, "+
+			"or a comma-separated fallback list (default: auto or TOKEN_STORE env)",
+	)
+	flagOPVault = flag.String(
+		"op-vault",
+		"",
+		"1Password vault for -token-store=op (or OP_VAULT env)",
+	)
+	flagPassPath = flag.String(
+		"pass-path",
+		"",
+		"Password store directory for -token-store=pass/gopass (default: authgate or PASS_PATH env)",
+	)
+	flagWincredRoam = flag.Bool(
+		"wincred-roaming",
+		false,
+		"With -token-store=wincred, save enterprise (roaming) credentials (or WINCRED_ROAMING env)",
+	)
+	flagBindMachine = flag.Bool(
+		"bind-machine",
+		false,
+		"Bind tokens to this machine and refuse stored tokens saved on another host (or BIND_MACHINE env)",
+	)
+	flagReadOnly = flag.Bool(
+		"read-only",
+		false,
+		"Never write to the token store; fail when a refresh or login is needed (or READ_ONLY env)",
+	)
+	flagPKCEMethod = flag.String(
+		"pkce-method",
+		"",
+		"PKCE code_challenge_method: S256, plain, none (default: S256 or PKCE_METHOD env)",
+	)
+	flagPKCEBytes = flag.Int(
+		"pkce-verifier-bytes",
+		0,
+		"Random bytes in the PKCE code_verifier, 32-96 (default: 32 or PKCE_VERIFIER_BYTES env)",
+	)
+	flagDiscovery = flag.Bool(
+		"discovery",
+		false,
+		"Fetch server metadata from /.well-known and adapt to it (or DISCOVERY env)",
+	)
+	flagDiscoveryTTL = flag.Duration(
+		"discovery-ttl",
+		0,
+		"Reuse cached server metadata for this long before revalidating; 0s disables the cache "+
+			"(default: 1h or DISCOVERY_TTL env)",
+	)
+	flagTokenInfoTTL = flag.Duration(
+		"tokeninfo-cache-ttl",
+		0,
+		"Reuse positive token info responses for the same token for this long; 0s disables the cache "+
+			"(default: 30s or TOKENINFO_CACHE_TTL env)",
+	)
+	flagSignedState = flag.Bool(
+		"signed-state",
+		false,
+		"Embed an HMAC-signed, timestamped payload in the OAuth state (or SIGNED_STATE env)",
+	)
+	flagStateMaxAge = flag.Duration(
+		"state-max-age",
+		0,
+		"Reject signed states older than this (default: 10m or STATE_MAX_AGE env)",
+	)
+	flagRevokeAbort = flag.Bool(
+		"revoke-on-abort",
+		false,
+		"Revoke tokens obtained during a run that is interrupted (or REVOKE_ON_ABORT env)",
+	)
+	flagOutput = flag.String(
+		"output",
+		"",
+		"Login result format: text, json (default: text or OUTPUT env)",
+	)
+	flagProgress = flag.String(
+		"progress",
+		"",
+		"Login progress display: tui, or json for NDJSON events on stderr (default: tui or PROGRESS env)",
+	)
+	flagShowToken = flag.Bool(
+		"show-token",
+		false,
+		"Print the full access token in the login summary instead of its fingerprint (or SHOW_TOKEN env)",
+	)
+	flagRaw = flag.Bool(
+		"raw",
+		false,
+		"tokeninfo: print the server response as received instead of indented and paged (or RAW_OUTPUT env)",
+	)
+	flagFederateFrom = flag.String(
+		"from",
+		"",
+		"federate: CI provider whose OIDC token to exchange, github-actions or gitlab-ci (or FEDERATE_FROM env)",
+	)
+	flagCIAudience = flag.String(
+		"ci-audience",
+		"",
+		"federate: audience of the GitHub Actions OIDC token (default: server URL or CI_AUDIENCE env)",
+	)
+	flagAPIURL = flag.String(
+		"api-url",
+		"",
+		"call: base URL that request paths are resolved against (default: server URL or API_URL env)",
+	)
+	flagData = flag.String(
+		"data",
+		"",
+		"call: request body; @file reads it from a file and @- from stdin",
+	)
+	flagInclude = flag.Bool("i", false, "call: print the response status line and headers")
+	flagAnyOrigin = flag.Bool(
+		"any-origin",
+		false,
+		"call: allow absolute URLs outside the -api-url origin, sending the token there",
+	)
+	flagTypeHint = flag.String(
+		"token-type-hint",
+		"",
+		"revoke: token_type_hint sent with a token from stdin or @file: access_token, refresh_token",
+	)
+	flagRevokeAll = flag.Bool(
+		"all-for-client",
+		false,
+		"revoke: revoke and remove every stored token of the client (all audiences and resources)",
+	)
+	flagDiff = flag.String(
+		"diff",
+		"",
+		"status: compare the token file with this snapshot and print the changes as JSON",
+	)
+	flagSnapshot = flag.String(
+		"snapshot",
+		"",
+		"status: write the token file's entries by fingerprint to this snapshot file",
+	)
+	flagConcurrency = flag.Int("concurrency", 10, "bench: number of concurrent workers")
+	flagBenchTime = flag.Duration("duration", 30*time.Second, "bench: how long to run")
+	flagFormat = flag.String(
+		"format",
+		"",
+		"token, status, whoami: Go template for the output, e.g. '{{.AccessToken}}'",
+	)
+	flagStrict = flag.Bool(
+		"strict",
+		false,
+		"Exit non-zero when the post-login token check fails or the server has no token info endpoint "+
+			"(or STRICT env)",
+	)
+	flagConfirmIdent = flag.Bool(
+		"confirm-identity",
+		false,
+		"Show the signed-in account after login and ask before saving the tokens (or CONFIRM_IDENTITY env)",
+	)
+	flagLang = flag.String(
+		"lang",
+		"",
+		"Language of callback pages and prompts: "+strings.Join(tui.Languages(), ", ")+
+			" (default: from LC_ALL, LC_MESSAGES or LANG env)",
+	)
+	flagHTTP1 = flag.Bool(
+		"http1",
+		false,
+		"Never negotiate HTTP/2 with the server (or HTTP1 env)",
+	)
+	flagNoKeepAlive = flag.Bool(
+		"disable-keep-alives",
+		false,
+		"Open a new connection for every request (or DISABLE_KEEP_ALIVES env)",
+	)
+	flagIdlePerHost = flag.Int(
+		"max-idle-conns-per-host",
+		0,
+		"Idle connections kept open per host (default: 2 or MAX_IDLE_CONNS_PER_HOST env)",
+	)
+	flagRateLimit = flag.Float64(
+		"rate-limit",
+		0,
+		"Maximum requests per second to the server, retries included; 0 is unlimited (or RATE_LIMIT env)",
+	)
+	flagRateBurst = flag.Int(
+		"rate-burst",
+		0,
+		"Requests allowed at once before -rate-limit applies (default: 1 or RATE_BURST env)",
+	)
+	flagBreakerFails = flag.Int(
+		"breaker-failures",
+		-1,
+		"Consecutive token endpoint failures before pausing token requests; 0 disables "+
+			"(default: 5 or BREAKER_FAILURES env)",
+	)
+	flagBreakerCool = flag.Duration(
+		"breaker-cooldown",
+		0,
+		"How long token requests pause after -breaker-failures (default: 30s or BREAKER_COOLDOWN env)",
+	)
+	flagLockStale = flag.Duration(
+		"lock-stale-age",
+		0,
+		"Break a token file lock of an exited process after this long "+
+			"(default: 30s or LOCK_STALE_AGE env)",
+	)
+	flagLockTimeout = flag.Duration(
+		"lock-timeout",
+		0,
+		"How long to wait for the token file lock (default: 10s or LOCK_TIMEOUT env)",
+	)
+	flagLockRetry = flag.Duration(
+		"lock-retry-delay",
+		0,
+		"Pause between token file lock attempts, jittered (default: 50ms or LOCK_RETRY_DELAY env)",
+	)
+	flagDialTimeout = flag.Duration(
+		"dial-timeout",
+		0,
+		"Timeout for establishing a TCP connection; 0s leaves it to the OS (or DIAL_TIMEOUT env)",
+	)
+	flagPreferIP = flag.String(
+		"prefer-ip",
+		"",
+		"Dial the server over IPv4 (4) or IPv6 (6) first instead of racing both (or PREFER_IP env)",
+	)
+	flagResolver = flag.String(
+		"resolver",
+		"",
+		"DNS server (IP[:port]) for resolving the server host instead of the system resolver (or RESOLVER env)",
+	)
+	flag.Var(
+		&flagPinSHA256,
+		"pin-sha256",
+		"Base64 SHA-256 of an accepted server public key (SPKI); repeatable, connections fail on mismatch (or PIN_SHA256 env, comma-separated)",
+	)
+	flagNudgeDays = flag.Int(
+		"nudge-days",
+		0,
+		"Warn when the stored refresh token expires within this many days (default: 7 or NUDGE_DAYS env)",
+	)
+	flagNoNudge = flag.Bool(
+		"no-nudge",
+		false,
+		"Do not warn about an expiring refresh token (or NO_NUDGE env)",
+	)
+	flagTiming = flag.Bool(
+		"timing",
+		false,
+		"Report DNS, connect, TLS, TTFB and total durations for each HTTP call (or TIMING env)",
+	)
+	flagDebugLog = flag.String(
+		"debug-log",
+		"",
+		"Append diagnostic messages (e.g. callback server requests) to this file (or DEBUG_LOG env)",
+	)
+	flagAuditLog = flag.String(
+		"audit-log",
+		"",
+		"Append a JSON-lines audit log of credential operations to this file (or AUDIT_LOG env)",
+	)
+	flagAuditMaxSize = flag.Int(
+		"audit-log-max-size",
+		0,
+		"Rotate the audit log when it exceeds this many MiB (default: 10 or AUDIT_LOG_MAX_SIZE env)",
 	)
 }
 
@@ -103,17 +742,157 @@ func initConfig() {
 func doInitConfig() {
 	flag.Parse()
 
-	serverURL = getConfig(*flagServerURL, "SERVER_URL", "http://localhost:8080")
-	clientID = getConfig(*flagClientID, "CLIENT_ID", "")
-	clientSecret = getConfig(*flagClientSecret, "CLIENT_SECRET", "")
-	if *flagClientSecret != "" {
+	var err error
+
+	// Select the language first so every warning below is translated.
+	langTag := *flagLang
+	if langTag == "" {
+		langTag = systemLocale()
+	}
+	lang, ok := tui.MatchLanguage(langTag)
+	tui.SetLanguage(lang)
+	if !ok && *flagLang != "" {
+		configWarnings = append(configWarnings, tui.T("warn.unknown_lang", *flagLang))
+	}
+
+	providerName := getConfig(*flagProvider, "PROVIDER", defaultProvider)
+	tenant := getConfig(*flagTenant, "TENANT", "common")
+	activeProvider, err = resolveProvider(providerName, tenant)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	for _, o := range []struct {
+		name, flagValue, envKey string
+		path                    *string
+	}{
+		{"authorize-path", *flagAuthorizeURL, "AUTHORIZE_PATH", &activeProvider.authorizePath},
+		{"token-path", *flagTokenURL, "TOKEN_PATH", &activeProvider.tokenPath},
+		{"tokeninfo-path", *flagTokenInfoURL, "TOKENINFO_PATH", &activeProvider.tokenInfoPath},
+	} {
+		value := getConfig(o.flagValue, o.envKey, "")
+		if value == "" {
+			continue
+		}
+		if *o.path, err = overrideEndpoint(o.name, value); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	cfg.TokenInfoPathSet = getConfig(*flagTokenInfoURL, "TOKENINFO_PATH", "") != ""
+
+	cfg.ServerURL = getConfig(*flagServerURL, "SERVER_URL", activeProvider.defaultServerURL)
+	if socket, ok, err := parseUnixServerURL(cfg.ServerURL); ok {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Invalid SERVER_URL: %v\n", err)
+			os.Exit(1)
+		}
+		cfg.ServerSocket = socket
+		cfg.ServerURL = "http://" + unixSocketHost
+	}
+	cfg.ClientID = getConfig(*flagClientID, "CLIENT_ID", "")
+	cfg.ClientSecret = getConfig(*flagClientSecret, "CLIENT_SECRET", "")
+	switch {
+	case *flagSecretStdin && *flagClientSecret != "":
+		fmt.Fprintln(os.Stderr, "Error: use either -client-secret or -secret-stdin, not both")
+		os.Exit(1)
+	case *flagSecretStdin:
+		cfg.ClientSecret, err = readSecret(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -secret-stdin: %v\n", err)
+			os.Exit(1)
+		}
+	case *flagClientSecret != "":
 		configWarnings = append(configWarnings,
-			"Client secret passed via command-line flag. "+
-				"This may be visible in process listings. "+
-				"Consider using CLIENT_SECRET env var or .env file instead.")
+			tui.T("warn.secret_flag"))
+	}
+	cfg.ClientCert, cfg.ClientKey, err = loadClientCredentials(
+		getConfig(*flagClientCert, "CLIENT_CERT", ""), getConfig(*flagClientKey, "CLIENT_KEY", ""))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	cfg.TokenAuthMethod = getConfig(*flagTokenAuth, "TOKEN_AUTH_METHOD", "")
+	if err := validateTokenAuthMethod(cfg.TokenAuthMethod); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	cfg.Scope = normalizeScopes(getConfig(*flagScope, "SCOPE", activeProvider.defaultScope))
+	cfg.ScopeSeparator, err = parseScopeSeparator(
+		getConfig(*flagScopeSep, "SCOPE_SEPARATOR", "space"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	offlineEnabled, _ := strconv.ParseBool(getEnv("OFFLINE", "false"))
+	if *flagOffline || offlineEnabled {
+		cfg.Scope = withScope(cfg.Scope, offlineAccessScope)
+	}
+	cfg.Audience = getConfig(*flagAudience, "AUDIENCE", "")
+	cfg.Resource = getConfig(*flagResource, "RESOURCE", "")
+	if activeProvider.audienceAsScope && cfg.Audience != "" {
+		cfg.Scope = defaultScopeFor(cfg.Scope, cfg.Audience)
+	}
+	cfg.Scope = normalizeScopes(cfg.Scope)
+	cfg.PKCEMethod = getConfig(*flagPKCEMethod, "PKCE_METHOD", "")
+	discoveryEnabled, _ := strconv.ParseBool(getEnv("DISCOVERY", "false"))
+	cfg.Discovery = *flagDiscovery || discoveryEnabled
+	if cfg.Discovery {
+		ttlStr := ""
+		if isFlagSet("discovery-ttl") {
+			ttlStr = flagDiscoveryTTL.String()
+		}
+		ttlStr = getConfig(ttlStr, "DISCOVERY_TTL", defaultDiscoveryTTL.String())
+		if cfg.DiscoveryTTL, err = time.ParseDuration(ttlStr); err != nil || cfg.DiscoveryTTL < 0 {
+			fmt.Fprintf(os.Stderr, "Error: invalid discovery-ttl value: %s\n", ttlStr)
+			os.Exit(1)
+		}
+		if dir, err := os.UserCacheDir(); err == nil {
+			cfg.DiscoveryCacheDir = filepath.Join(dir, "authgate-oauth-cli", "metadata")
+		}
+	}
+	cfg.TokenFallbackURLs, err = parseTokenFallbackURLs(
+		getConfig(*flagFallbackURLs, "TOKEN_FALLBACK_URLS", ""))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		refreshExpiryState.path = filepath.Join(dir, "authgate-oauth-cli", "refresh-expiry.json")
+		grantedScopeState.path = filepath.Join(dir, "authgate-oauth-cli", "granted-scopes.json")
+	}
+	nudgeDaysStr := ""
+	if *flagNudgeDays != 0 {
+		nudgeDaysStr = strconv.Itoa(*flagNudgeDays)
+	}
+	nudgeDaysStr = getConfig(nudgeDaysStr, "NUDGE_DAYS", strconv.Itoa(defaultNudgeDays))
+	nudgeDays, err := strconv.Atoi(nudgeDaysStr)
+	if err != nil || nudgeDays < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid nudge-days value: %s\n", nudgeDaysStr)
+		os.Exit(1)
+	}
+	noNudgeEnabled, _ := strconv.ParseBool(getEnv("NO_NUDGE", "false"))
+	if !*flagNoNudge && !noNudgeEnabled {
+		cfg.NudgeWindow = time.Duration(nudgeDays) * 24 * time.Hour
+	}
+	if len(cfg.TokenFallbackURLs) > 0 {
+		if dir, err := os.UserCacheDir(); err == nil {
+			tokenEndpointState.path = filepath.Join(dir, "authgate-oauth-cli", "token-endpoints.json")
+		}
+	}
+	revokeOnAbortEnabled, _ := strconv.ParseBool(getEnv("REVOKE_ON_ABORT", "false"))
+	cfg.RevokeOnAbort = *flagRevokeAbort || revokeOnAbortEnabled
+	cfg.TokenFile, err = canonicalTokenPath(getConfig(*flagTokenFile, "TOKEN_FILE", ".authgate-tokens.json"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid token file path: %v\n", err)
+		os.Exit(1)
+	}
+	cfg.OutputFormat = getConfig(*flagOutput, "OUTPUT", outputText)
+	if cfg.OutputFormat != outputText && cfg.OutputFormat != outputJSON {
+		fmt.Fprintf(os.Stderr,
+			"Error: invalid output value: %s (must be text or json)\n", cfg.OutputFormat)
+		os.Exit(1)
 	}
-	scope = getConfig(*flagScope, "SCOPE", "read write")
-	tokenFile = getConfig(*flagTokenFile, "TOKEN_FILE", ".authgate-tokens.json")
 
 	// Resolve callback port (int flag needs special handling).
 	portStr := ""
@@ -121,28 +900,128 @@ func doInitConfig() {
 		portStr = strconv.Itoa(*flagCallbackPort)
 	}
 	portStr = getConfig(portStr, "CALLBACK_PORT", "8888")
-	if _, err := fmt.Sscanf(portStr, "%d", &callbackPort); err != nil || callbackPort <= 0 {
-		callbackPort = 8888
+	if _, err := fmt.Sscanf(portStr, "%d", &cfg.CallbackPort); err != nil || cfg.CallbackPort <= 0 {
+		cfg.CallbackPort = 8888
+	}
+
+	timeoutStr := ""
+	if *flagCallbackWait != 0 {
+		timeoutStr = flagCallbackWait.String()
+	}
+	timeoutStr = getConfig(timeoutStr, "CALLBACK_TIMEOUT", defaultCallbackTimeout.String())
+	cfg.CallbackTimeout, err = time.ParseDuration(timeoutStr)
+	if err != nil || cfg.CallbackTimeout <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid callback-timeout value: %s\n", timeoutStr)
+		os.Exit(1)
+	}
+
+	reopenStr := ""
+	if *flagReopenAfter != 0 {
+		reopenStr = flagReopenAfter.String()
+	}
+	reopenStr = getConfig(reopenStr, "REOPEN_AFTER", "0s")
+	if cfg.ReopenAfter, err = time.ParseDuration(reopenStr); err != nil || cfg.ReopenAfter < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid reopen-after value: %s\n", reopenStr)
+		os.Exit(1)
+	}
+	cfg.BrowserApp = getConfig(*flagBrowser, "BROWSER_APP", "")
+	cfg.BrowserProfile = getConfig(*flagBrowserProf, "BROWSER_PROFILE", "")
+	cfg.BrowserArgs = strings.Fields(getConfig(*flagBrowserArgs, "BROWSER_ARGS", ""))
+	if err := validateBrowser(cfg.BrowserApp, cfg.BrowserProfile, cfg.BrowserArgs); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	refreshBeforeStr := ""
+	if *flagRefreshAhead != 0 {
+		refreshBeforeStr = flagRefreshAhead.String()
+	}
+	refreshBeforeStr = getConfig(refreshBeforeStr, "REFRESH_BEFORE", "0s")
+	cfg.RefreshBefore, err = time.ParseDuration(refreshBeforeStr)
+	if err != nil || cfg.RefreshBefore < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid refresh-before value: %s\n", refreshBeforeStr)
+		os.Exit(1)
 	}
+	cfg.ListenURLFile = getConfig(*flagListenURL, "LISTEN_URL_FILE", "")
 
 	// Resolve redirect URI (default depends on port, so compute after port is known).
-	defaultRedirectURI := fmt.Sprintf("http://localhost:%d/callback", callbackPort)
-	redirectURI = getConfig(*flagRedirectURI, "REDIRECT_URI", defaultRedirectURI)
+	defaultRedirectURI := fmt.Sprintf("http://localhost:%d/callback", cfg.CallbackPort)
+	cfg.RedirectURI = getConfig(*flagRedirectURI, "REDIRECT_URI", defaultRedirectURI)
+	publicRedirect, notice, err := resolvePublicRedirect(
+		getConfig(*flagPublicRedir, "PUBLIC_REDIRECT_URI", ""),
+		getConfig(*flagRedirectURI, "REDIRECT_URI", "") != "", os.Getenv, cfg.CallbackPort)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	cfg.PublicRedirectURI = publicRedirect
+	if notice != "" {
+		configWarnings = append(configWarnings, notice)
+	}
 
 	// Validate SERVER_URL.
-	if err := validateServerURL(serverURL); err != nil {
+	if err := validateServerURL(cfg.ServerURL); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Invalid SERVER_URL: %v\n", err)
 		os.Exit(1)
 	}
 
-	if strings.HasPrefix(strings.ToLower(serverURL), "http://") {
+	// Resolve PKCE verifier length (int flag needs special handling).
+	pkceBytesStr := ""
+	if *flagPKCEBytes != 0 {
+		pkceBytesStr = strconv.Itoa(*flagPKCEBytes)
+	}
+	pkceBytesStr = getConfig(
+		pkceBytesStr,
+		"PKCE_VERIFIER_BYTES",
+		strconv.Itoa(DefaultPKCEVerifierBytes),
+	)
+	if _, err := fmt.Sscanf(pkceBytesStr, "%d", &cfg.PKCEBytes); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid pkce-verifier-bytes value: %s\n", pkceBytesStr)
+		os.Exit(1)
+	}
+	if err := validatePKCEVerifierBytes(cfg.PKCEBytes); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	signedStateEnabled, _ := strconv.ParseBool(getEnv("SIGNED_STATE", "false"))
+	if *flagSignedState || signedStateEnabled {
+		maxAgeStr := ""
+		if *flagStateMaxAge != 0 {
+			maxAgeStr = flagStateMaxAge.String()
+		}
+		maxAgeStr = getConfig(maxAgeStr, "STATE_MAX_AGE", defaultStateMaxAge.String())
+		maxAge, err := time.ParseDuration(maxAgeStr)
+		if err != nil || maxAge <= 0 {
+			fmt.Fprintf(os.Stderr, "Error: invalid state-max-age value: %s\n", maxAgeStr)
+			os.Exit(1)
+		}
+		cfg.StateMaxAge = maxAge
+		if cfg.StateKey, err = newStateKey(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	switch cfg.PKCEMethod {
+	case "", pkceMethodS256:
+	case pkceMethodPlain:
 		configWarnings = append(configWarnings,
-			"Using HTTP instead of HTTPS. Tokens will be transmitted in plaintext!")
+			tui.T("warn.pkce_plain"))
+	case pkceMethodNone:
 		configWarnings = append(configWarnings,
-			"This is only safe for local development. Use HTTPS in production.")
+			tui.T("warn.pkce_none"))
+	default:
+		fmt.Fprintf(os.Stderr,
+			"Error: invalid pkce-method value: %s (must be S256, plain, or none)\n", cfg.PKCEMethod)
+		os.Exit(1)
+	}
+	enforcePolicy(cfg.PKCEMethod)
+
+	if strings.HasPrefix(strings.ToLower(cfg.ServerURL), "http://") && cfg.ServerSocket == "" {
+		configWarnings = append(configWarnings, tui.T("warn.http"), tui.T("warn.http_dev_only"))
 	}
 
-	if clientID == "" {
+	if cfg.ClientID == "" && !cfg.ClientIDOptional {
 		fmt.Println("Error: CLIENT_ID not set. Please provide it via:")
 		fmt.Println("  1. Command-line flag: -client-id=<your-client-id>")
 		fmt.Println("  2. Environment variable: CLIENT_ID=<your-client-id>")
@@ -151,44 +1030,322 @@ func doInitConfig() {
 		os.Exit(1)
 	}
 
-	if _, err := uuid.Parse(clientID); err != nil {
-		configWarnings = append(configWarnings,
-			"CLIENT_ID doesn't appear to be a valid UUID: "+clientID)
+	// Only AuthGate issues UUID client IDs; other providers use their own formats.
+	if _, err := uuid.Parse(cfg.ClientID); err != nil && cfg.ClientID != "" &&
+		providerName == defaultProvider {
+		configWarnings = append(configWarnings, tui.T("warn.client_id_uuid", cfg.ClientID))
 	}
 
 	// Build HTTP client with TLS and retry support.
-	baseHTTPClient := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig:     &tls.Config{MinVersion: tls.VersionTLS12},
-			MaxIdleConns:        10,
-			IdleConnTimeout:     90 * time.Second,
-			TLSHandshakeTimeout: 10 * time.Second,
-		},
+	transportOpts := transportOptions{
+		http1:             *flagHTTP1,
+		disableKeepAlives: *flagNoKeepAlive,
+	}
+	if v, _ := strconv.ParseBool(getEnv("HTTP1", "false")); v {
+		transportOpts.http1 = true
+	}
+	if v, _ := strconv.ParseBool(getEnv("DISABLE_KEEP_ALIVES", "false")); v {
+		transportOpts.disableKeepAlives = true
+	}
+	idlePerHostStr := ""
+	if *flagIdlePerHost != 0 {
+		idlePerHostStr = strconv.Itoa(*flagIdlePerHost)
+	}
+	idlePerHostStr = getConfig(idlePerHostStr, "MAX_IDLE_CONNS_PER_HOST", "0")
+	if transportOpts.maxIdleConnsPerHost, err = strconv.Atoi(idlePerHostStr); err != nil ||
+		transportOpts.maxIdleConnsPerHost < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid max-idle-conns-per-host value: %s\n", idlePerHostStr)
+		os.Exit(1)
+	}
+	dialTimeoutStr := ""
+	if *flagDialTimeout != 0 {
+		dialTimeoutStr = flagDialTimeout.String()
+	}
+	dialTimeoutStr = getConfig(dialTimeoutStr, "DIAL_TIMEOUT", "0s")
+	if transportOpts.dialTimeout, err = time.ParseDuration(dialTimeoutStr); err != nil ||
+		transportOpts.dialTimeout < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid dial-timeout value: %s\n", dialTimeoutStr)
+		os.Exit(1)
+	}
+	transportOpts.resolver, err = parseResolver(getConfig(*flagResolver, "RESOLVER", ""))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	switch transportOpts.preferIP = getConfig(*flagPreferIP, "PREFER_IP", ""); transportOpts.preferIP {
+	case "", "4", "6":
+	default:
+		fmt.Fprintf(os.Stderr,
+			"Error: invalid prefer-ip value: %s (must be 4 or 6)\n", transportOpts.preferIP)
+		os.Exit(1)
 	}
+	pinValues := []string(flagPinSHA256)
+	if len(pinValues) == 0 {
+		pinValues = strings.Split(getEnv("PIN_SHA256", ""), ",")
+	}
+	if transportOpts.pins, err = parsePins(pinValues); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	transportOpts.unixSocket = cfg.ServerSocket
+	transportOpts.clientCert = cfg.ClientCert
+	cfg.HTTPClient = &http.Client{Transport: newHTTPTransport(transportOpts)}
 
-	var err error
-	retryClient, err = retry.NewBackgroundClient(retry.WithHTTPClient(baseHTTPClient))
+	showTokenEnabled, _ := strconv.ParseBool(getEnv("SHOW_TOKEN", "false"))
+	cfg.ShowToken = *flagShowToken || showTokenEnabled
+
+	rawOutputEnabled, _ := strconv.ParseBool(getEnv("RAW_OUTPUT", "false"))
+	cfg.RawOutput = *flagRaw || rawOutputEnabled
+
+	tokenInfoTTLStr := ""
+	if isFlagSet("tokeninfo-cache-ttl") {
+		tokenInfoTTLStr = flagTokenInfoTTL.String()
+	}
+	tokenInfoTTLStr = getConfig(
+		tokenInfoTTLStr, "TOKENINFO_CACHE_TTL", defaultTokenInfoCacheTTL.String())
+	if cfg.TokenInfoCacheTTL, err = time.ParseDuration(tokenInfoTTLStr); err != nil ||
+		cfg.TokenInfoCacheTTL < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid tokeninfo-cache-ttl value: %s\n", tokenInfoTTLStr)
+		os.Exit(1)
+	}
+
+	switch cfg.FederateFrom = getConfig(*flagFederateFrom, "FEDERATE_FROM", ""); cfg.FederateFrom {
+	case "", federateGitHubActions, federateGitLabCI:
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid from value: %s (must be github-actions or gitlab-ci)\n",
+			cfg.FederateFrom)
+		os.Exit(1)
+	}
+	cfg.CIAudience = getConfig(*flagCIAudience, "CI_AUDIENCE", "")
+
+	cfg.APIURL = getConfig(*flagAPIURL, "API_URL", cfg.ServerURL)
+	if !isEndpointURL(cfg.APIURL) {
+		fmt.Fprintf(os.Stderr, "Error: invalid api-url value: %s (must be an http(s) URL)\n", cfg.APIURL)
+		os.Exit(1)
+	}
+	cfg.CallData = *flagData
+	cfg.CallInclude = *flagInclude
+	cfg.CallAnyOrigin = *flagAnyOrigin
+
+	cfg.TokenTypeHint = *flagTypeHint
+	cfg.RevokeAll = *flagRevokeAll
+	cfg.StatusDiff = *flagDiff
+	cfg.StatusSnapshot = *flagSnapshot
+	if cfg.BenchConcurrency = *flagConcurrency; cfg.BenchConcurrency < 1 {
+		fmt.Fprintf(os.Stderr, "Error: invalid concurrency value: %d (must be at least 1)\n",
+			cfg.BenchConcurrency)
+		os.Exit(1)
+	}
+	if cfg.BenchDuration = *flagBenchTime; cfg.BenchDuration <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid duration value: %s (must be positive)\n", cfg.BenchDuration)
+		os.Exit(1)
+	}
+	if err := validateTokenTypeHint(cfg.TokenTypeHint); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *flagFormat != "" {
+		if cfg.FormatTemplate, err = parseFormat(*flagFormat); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid format value: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	confirmIdentityEnabled, _ := strconv.ParseBool(getEnv("CONFIRM_IDENTITY", "false"))
+	cfg.ConfirmIdentity = *flagConfirmIdent || confirmIdentityEnabled
+
+	strictEnabled, _ := strconv.ParseBool(getEnv("STRICT", "false"))
+	cfg.StrictChecks = *flagStrict || strictEnabled
+
+	switch mode := getConfig(*flagProgress, "PROGRESS", progressTUI); mode {
+	case progressTUI:
+	case progressJSON:
+		if cfg.ConfirmIdentity {
+			fmt.Fprintln(os.Stderr,
+				"Error: -confirm-identity needs the interactive TUI; it cannot be used with -progress=json")
+			os.Exit(1)
+		}
+		cfg.Progress = newProgressWriter(os.Stderr)
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid progress value: %s (must be tui or json)\n", mode)
+		os.Exit(1)
+	}
+
+	timingEnabled, _ := strconv.ParseBool(getEnv("TIMING", "false"))
+	if *flagTiming || timingEnabled {
+		cfg.Timings = &timingRecorder{}
+		cfg.HTTPClient.Transport = &timingTransport{
+			base:     cfg.HTTPClient.Transport,
+			recorder: cfg.Timings,
+		}
+	}
+
+	if tracer != nil {
+		cfg.HTTPClient.Transport = &tracingTransport{base: cfg.HTTPClient.Transport}
+	}
+
+	rateLimitStr := ""
+	if *flagRateLimit != 0 {
+		rateLimitStr = strconv.FormatFloat(*flagRateLimit, 'g', -1, 64)
+	}
+	rateLimitStr = getConfig(rateLimitStr, "RATE_LIMIT", "0")
+	rateLimit, err := strconv.ParseFloat(rateLimitStr, 64)
+	if err != nil || rateLimit < 0 || math.IsNaN(rateLimit) || math.IsInf(rateLimit, 0) {
+		fmt.Fprintf(os.Stderr, "Error: invalid rate-limit value: %s\n", rateLimitStr)
+		os.Exit(1)
+	}
+	rateBurstStr := ""
+	if *flagRateBurst != 0 {
+		rateBurstStr = strconv.Itoa(*flagRateBurst)
+	}
+	rateBurstStr = getConfig(rateBurstStr, "RATE_BURST", "1")
+	rateBurst, err := strconv.Atoi(rateBurstStr)
+	if err != nil || rateBurst < 1 {
+		fmt.Fprintf(os.Stderr, "Error: invalid rate-burst value: %s\n", rateBurstStr)
+		os.Exit(1)
+	}
+
+	if rateLimit > 0 {
+		// Outermost, so time spent waiting is not reported as -timing or
+		// span latency.
+		cfg.HTTPClient.Transport = &rateLimitTransport{
+			base:    cfg.HTTPClient.Transport,
+			limiter: newRateLimiter(rateLimit, rateBurst),
+		}
+	}
+
+	breakerFailsStr := ""
+	if *flagBreakerFails >= 0 {
+		breakerFailsStr = strconv.Itoa(*flagBreakerFails)
+	}
+	breakerFailsStr = getConfig(breakerFailsStr, "BREAKER_FAILURES", "5")
+	if tokenBreaker.threshold, err = strconv.Atoi(breakerFailsStr); err != nil ||
+		tokenBreaker.threshold < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid breaker-failures value: %s\n", breakerFailsStr)
+		os.Exit(1)
+	}
+	breakerCoolStr := ""
+	if *flagBreakerCool != 0 {
+		breakerCoolStr = flagBreakerCool.String()
+	}
+	breakerCoolStr = getConfig(breakerCoolStr, "BREAKER_COOLDOWN", "30s")
+	if tokenBreaker.cooldown, err = time.ParseDuration(breakerCoolStr); err != nil ||
+		tokenBreaker.cooldown <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid breaker-cooldown value: %s\n", breakerCoolStr)
+		os.Exit(1)
+	}
+	lockStaleStr := ""
+	if *flagLockStale != 0 {
+		lockStaleStr = flagLockStale.String()
+	}
+	lockStaleStr = getConfig(lockStaleStr, "LOCK_STALE_AGE", "30s")
+	if cfg.LockStaleAge, err = time.ParseDuration(lockStaleStr); err != nil ||
+		cfg.LockStaleAge <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid lock-stale-age value: %s\n", lockStaleStr)
+		os.Exit(1)
+	}
+	lockTimeoutStr := ""
+	if *flagLockTimeout != 0 {
+		lockTimeoutStr = flagLockTimeout.String()
+	}
+	lockTimeoutStr = getConfig(lockTimeoutStr, "LOCK_TIMEOUT", "10s")
+	if cfg.LockTimeout, err = time.ParseDuration(lockTimeoutStr); err != nil ||
+		cfg.LockTimeout <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid lock-timeout value: %s\n", lockTimeoutStr)
+		os.Exit(1)
+	}
+	lockRetryStr := ""
+	if *flagLockRetry != 0 {
+		lockRetryStr = flagLockRetry.String()
+	}
+	lockRetryStr = getConfig(lockRetryStr, "LOCK_RETRY_DELAY", "50ms")
+	if cfg.LockRetryDelay, err = time.ParseDuration(lockRetryStr); err != nil ||
+		cfg.LockRetryDelay <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid lock-retry-delay value: %s\n", lockRetryStr)
+		os.Exit(1)
+	}
+
+	if path := getConfig(*flagDebugLog, "DEBUG_LOG", ""); path != "" {
+		if err := openDebugLog(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to open debug log: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if path := getConfig(*flagAuditLog, "AUDIT_LOG", ""); path != "" {
+		maxSizeStr := ""
+		if *flagAuditMaxSize != 0 {
+			maxSizeStr = strconv.Itoa(*flagAuditMaxSize)
+		}
+		maxSizeStr = getConfig(maxSizeStr, "AUDIT_LOG_MAX_SIZE", "10")
+		maxSize, err := strconv.Atoi(maxSizeStr)
+		if err != nil || maxSize <= 0 {
+			fmt.Fprintf(os.Stderr, "Error: invalid audit-log-max-size value: %s\n", maxSizeStr)
+			os.Exit(1)
+		}
+		auditLog = newAuditLogger(path, int64(maxSize)<<20)
+	}
+
+	cfg.RetryClient, err = retry.NewBackgroundClient(retry.WithHTTPClient(cfg.HTTPClient))
+	if err == nil {
+		cfg.NoRetryClient, err = retry.NewBackgroundClient(
+			retry.WithHTTPClient(cfg.HTTPClient), retry.WithMaxRetries(0))
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: failed to create retry client: %v\n", err)
 		os.Exit(1)
 	}
 
 	const defaultKeyringService = "authgate-oauth-cli"
-	tokenStoreMode := getConfig(*flagTokenStore, "TOKEN_STORE", "auto")
+	cfg.TokenStoreMode = getConfig(*flagTokenStore, "TOKEN_STORE", "auto")
+	wincredRoamingEnabled, _ := strconv.ParseBool(getEnv("WINCRED_ROAMING", "false"))
+	cfg.WincredRoaming = *flagWincredRoam || wincredRoamingEnabled
+	cfg.OPVault = getConfig(*flagOPVault, "OP_VAULT", "")
+	cfg.PassPath = getConfig(*flagPassPath, "PASS_PATH", "authgate")
 	var warnings []string
-	tokenStore, warnings, err = initTokenStore(tokenStoreMode, tokenFile, defaultKeyringService)
+	cfg.TokenStore, warnings, err = initTokenStore(
+		cfg.TokenStoreMode, cfg.TokenFile, defaultKeyringService)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 	configWarnings = append(configWarnings, warnings...)
+	cfg.TokenStore = withFileBackup(cfg.TokenStore, cfg.TokenFile)
+
+	bindMachineEnabled, _ := strconv.ParseBool(getEnv("BIND_MACHINE", "false"))
+	cfg.BindMachine = *flagBindMachine || bindMachineEnabled
+	if cfg.BindMachine {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -bind-machine needs a user cache directory: %v\n", err)
+			os.Exit(1)
+		}
+		cfg.TokenStore = &boundStore{
+			Store:   cfg.TokenStore,
+			path:    filepath.Join(dir, "authgate-oauth-cli", "machine-bindings.json"),
+			machine: machineBinding(),
+		}
+	}
+
+	readOnlyEnabled, _ := strconv.ParseBool(getEnv("READ_ONLY", "false"))
+	cfg.ReadOnly = *flagReadOnly || readOnlyEnabled
+	if cfg.ReadOnly {
+		cfg.TokenStore = readOnlyStore{Store: cfg.TokenStore}
+	}
 }
 
+// errInvalidTokenStore is returned by initTokenStore for an unknown mode.
+var errInvalidTokenStore = errors.New("invalid token-store value")
+
 // initTokenStore creates a token store based on the given mode.
 // It returns the store, any warnings, and an error if the mode is invalid.
 func initTokenStore(
 	mode, filePath, keyringService string,
 ) (credstore.Store[credstore.Token], []string, error) {
+	if strings.Contains(mode, ",") {
+		return initChainStore(mode, filePath, keyringService)
+	}
 	fileStore := credstore.NewTokenFileStore(filePath)
 	var warnings []string
 
@@ -197,6 +1354,31 @@ func initTokenStore(
 		return fileStore, nil, nil
 	case "keyring":
 		return credstore.NewTokenKeyringStore(keyringService), nil, nil
+	case "wincred":
+		if runtime.GOOS != "windows" {
+			return nil, nil, errors.New("token-store wincred is only available on Windows")
+		}
+		return newWincredStore(cfg.ServerURL, cfg.WincredRoaming), nil, nil
+	case "op":
+		if cfg.OPVault == "" {
+			return nil, nil, errors.New("token-store op requires -op-vault or OP_VAULT")
+		}
+		if _, err := exec.LookPath("op"); err != nil {
+			return nil, nil, errors.New("token-store op requires the 1Password CLI (op) in PATH")
+		}
+		return newOPStore(cfg.ServerURL, cfg.OPVault), nil, nil
+	case "sops":
+		if _, err := exec.LookPath("sops"); err != nil {
+			return nil, nil, errors.New("token-store sops requires sops in PATH")
+		}
+		return newSOPSStore(filePath), nil, nil
+	case "memory":
+		return newMemoryStore(), nil, nil
+	case "pass", "gopass":
+		if _, err := exec.LookPath(mode); err != nil {
+			return nil, nil, fmt.Errorf("token-store %s requires %s in PATH", mode, mode)
+		}
+		return newPassStore(mode, cfg.PassPath, cfg.ServerURL), nil, nil
 	case "auto":
 		ss := credstore.DefaultTokenSecureStore(keyringService, filePath)
 		if !ss.UseKeyring() {
@@ -206,8 +1388,8 @@ func initTokenStore(
 		return ss, warnings, nil
 	default:
 		return nil, nil, fmt.Errorf(
-			"invalid token-store value: %s (must be auto, file, or keyring)",
-			mode,
+			"%w: %s (must be auto, file, keyring, wincred, op, pass, gopass, sops, or memory)",
+			errInvalidTokenStore, mode,
 		)
 	}
 }
@@ -219,6 +1401,18 @@ func getConfig(flagValue, envKey, defaultValue string) string {
 	return getEnv(envKey, defaultValue)
 }
 
+// isFlagSet reports whether the named flag was given on the command line, for
+// flags whose zero value is meaningful.
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -226,6 +1420,30 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// systemLocale returns the POSIX locale for messages, e.g. "zh_TW.UTF-8".
+func systemLocale() string {
+	for _, key := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(key); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// readSecret returns the first line of r without its line ending, so a secret
+// can be piped in (-secret-stdin) instead of appearing in process arguments.
+func readSecret(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(io.LimitReader(r, maxResponseSize)).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	secret := strings.TrimRight(line, "\r\n")
+	if secret == "" {
+		return "", errors.New("no secret on standard input")
+	}
+	return secret, nil
+}
+
 func validateServerURL(rawURL string) error {
 	if rawURL == "" {
 		return errors.New("server URL cannot be empty")
@@ -243,10 +1461,32 @@ func validateServerURL(rawURL string) error {
 	return nil
 }
 
+// resolvePKCEMethod returns the PKCE method to use. An explicit -pkce-method
+// always wins; otherwise, with discovery enabled, the method is chosen from
+// the server's code_challenge_methods_supported in meta. A discovery failure
+// (metaErr) falls back to S256 and is reported as a warning.
+func resolvePKCEMethod(meta *serverMetadata, metaErr error) (string, string) {
+	if cfg.PKCEMethod != "" {
+		return cfg.PKCEMethod, ""
+	}
+	if !cfg.Discovery {
+		return pkceMethodS256, ""
+	}
+	if metaErr != nil {
+		return pkceMethodS256, fmt.Sprintf("Server discovery failed, using PKCE S256: %v", metaErr)
+	}
+	selected := selectPKCEMethod(meta.CodeChallengeMethodsSupported)
+	if selected != pkceMethodS256 {
+		return selected, fmt.Sprintf(
+			"Server does not advertise PKCE S256 support, using PKCE method %q", selected)
+	}
+	return selected, ""
+}
+
 // isPublicClient returns true when no client secret is configured —
 // i.e., this is a public client that must use PKCE.
 func isPublicClient() bool {
-	return clientSecret == ""
+	return cfg.ClientSecret == "" && cfg.ClientKey == nil && cfg.ClientCert == nil
 }
 
 // -----------------------------------------------------------------------
@@ -260,12 +1500,75 @@ type ErrorResponse struct {
 }
 
 // tokenResponse is the JSON structure returned by /oauth/token.
+// Azure AD's ext_expires_in (an outage-resilience extension) is ignored: tokens
+// are refreshed at their regular expiry. The embedded ErrorResponse catches
+// servers (GitHub) that report OAuth errors with a 200 status.
 type tokenResponse struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
-	TokenType    string `json:"token_type"`
-	ExpiresIn    int    `json:"expires_in"`
-	Scope        string `json:"scope"`
+	AccessToken  string  `json:"access_token"`
+	RefreshToken string  `json:"refresh_token"`
+	TokenType    string  `json:"token_type"`
+	ExpiresIn    flexInt `json:"expires_in"`
+	// RefreshExpiresIn is a Keycloak extension: the refresh token lifetime.
+	RefreshExpiresIn flexInt `json:"refresh_expires_in"`
+	Scope            string  `json:"scope"`
+	IDToken          string  `json:"id_token"`
+	ErrorResponse
+}
+
+// tokenAcceptHeader asks for JSON token responses. GitHub answers with
+// application/x-www-form-urlencoded unless JSON is requested, and other
+// servers may ignore the header, so decodeTokenResponse accepts both.
+const tokenAcceptHeader = "application/json, application/x-www-form-urlencoded;q=0.9"
+
+// decodeTokenResponse parses a token endpoint response body according to its
+// Content-Type: form-encoded bodies are decoded field by field, anything else
+// as JSON.
+func decodeTokenResponse(contentType string, body []byte) (*tokenResponse, error) {
+	var tokenResp tokenResponse
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType != "application/x-www-form-urlencoded" {
+		if err := json.Unmarshal(body, &tokenResp); err != nil {
+			return nil, err
+		}
+		return &tokenResp, nil
+	}
+
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+	tokenResp.AccessToken = values.Get("access_token")
+	tokenResp.RefreshToken = values.Get("refresh_token")
+	tokenResp.TokenType = values.Get("token_type")
+	tokenResp.Scope = values.Get("scope")
+	tokenResp.IDToken = values.Get("id_token")
+	tokenResp.Error = values.Get("error")
+	tokenResp.ErrorDescription = values.Get("error_description")
+	if v := values.Get("expires_in"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expires_in %q: %w", v, err)
+		}
+		tokenResp.ExpiresIn = flexInt(n)
+	}
+	if v := values.Get("refresh_expires_in"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid refresh_expires_in %q: %w", v, err)
+		}
+		tokenResp.RefreshExpiresIn = flexInt(n)
+	}
+	return &tokenResp, nil
+}
+
+// tokenExpiry converts expires_in to an absolute expiry. Servers that omit
+// expires_in (GitHub OAuth apps) issue non-expiring tokens, recorded as a zero
+// ExpiresAt; see tui.TokenValid.
+func tokenExpiry(expiresIn int) time.Time {
+	if expiresIn == 0 {
+		return time.Time{}
+	}
+	return clock.Now().Add(time.Duration(expiresIn) * time.Second)
 }
 
 // errResponseTooLarge is returned when a server response exceeds maxResponseSize.
@@ -294,7 +1597,40 @@ func parseOAuthError(statusCode int, body []byte, action string) error {
 	if jsonErr := json.Unmarshal(body, &errResp); jsonErr == nil && errResp.Error != "" {
 		return fmt.Errorf("%s: %s", errResp.Error, errResp.ErrorDescription)
 	}
-	return fmt.Errorf("%s failed with status %d: %s", action, statusCode, string(body))
+	return fmt.Errorf("%s failed with status %d: %s", action, statusCode, errorBodySnippet(body))
+}
+
+// errorBodySnippet returns body for quoting in an error message: truncated to
+// maxErrorBodyEcho bytes, with control characters replaced so a hostile
+// server cannot inject terminal escape sequences.
+func errorBodySnippet(body []byte) string {
+	truncated := len(body) > maxErrorBodyEcho
+	if truncated {
+		body = body[:maxErrorBodyEcho]
+	}
+	s := strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && r != '\n' && r != '\t' {
+			return '\uFFFD'
+		}
+		return r
+	}, strings.ToValidUTF8(string(body), "\uFFFD"))
+	if truncated {
+		s += "... (truncated)"
+	}
+	return s
+}
+
+// serverUnreachable marks err, from a request that got no usable response
+// (connection failure, or retries exhausted), as tui.ErrServerUnreachable.
+// Errors that never reached the network, like a request that could not be
+// built or an open circuit breaker, are returned unchanged.
+func serverUnreachable(err error) error {
+	var netErr net.Error
+	var retryErr *retry.RetryError
+	if !errors.As(err, &netErr) && !errors.As(err, &retryErr) {
+		return err
+	}
+	return fmt.Errorf("%w (%w)", tui.ErrServerUnreachable, err)
 }
 
 // isRefreshTokenError checks whether the response body indicates an expired
@@ -302,11 +1638,17 @@ func parseOAuthError(statusCode int, body []byte, action string) error {
 func isRefreshTokenError(body []byte) bool {
 	var errResp ErrorResponse
 	if err := json.Unmarshal(body, &errResp); err == nil {
-		return errResp.Error == "invalid_grant" || errResp.Error == "invalid_token"
+		return isRefreshTokenErrorCode(errResp.Error)
 	}
 	return false
 }
 
+// isRefreshTokenErrorCode reports whether an OAuth error code means the refresh
+// token is expired or invalid. GitHub uses bad_refresh_token.
+func isRefreshTokenErrorCode(code string) bool {
+	return code == "invalid_grant" || code == "invalid_token" || code == "bad_refresh_token"
+}
+
 // validateTokenResponse performs basic sanity checks on a token response.
 func validateTokenResponse(accessToken, tokenType string, expiresIn int) error {
 	if accessToken == "" {
@@ -315,10 +1657,15 @@ func validateTokenResponse(accessToken, tokenType string, expiresIn int) error {
 	if len(accessToken) < 10 {
 		return fmt.Errorf("access_token is too short (length: %d)", len(accessToken))
 	}
-	if expiresIn <= 0 {
-		return fmt.Errorf("expires_in must be positive, got: %d", expiresIn)
+	// expires_in is optional (RFC 6749 §5.1); 0 means the server omitted it.
+	if expiresIn < 0 {
+		return fmt.Errorf("expires_in must not be negative, got: %d", expiresIn)
+	}
+	if expiresIn > maxExpiresIn {
+		return fmt.Errorf("expires_in is implausibly large, got: %d (max %d)", expiresIn, maxExpiresIn)
 	}
-	if tokenType != "" && tokenType != "Bearer" {
+	// token_type is case-insensitive (RFC 6749 §5.1); GitHub sends "bearer".
+	if tokenType != "" && !strings.EqualFold(tokenType, "Bearer") {
 		return fmt.Errorf("unexpected token_type: %s (expected Bearer)", tokenType)
 	}
 	return nil
@@ -331,46 +1678,48 @@ func validateTokenResponse(accessToken, tokenType string, expiresIn int) error {
 // buildAuthURL constructs the /oauth/authorize URL with all required parameters.
 func buildAuthURL(state string, pkce *tui.PKCEParams) string {
 	params := url.Values{}
-	params.Set("client_id", clientID)
-	params.Set("redirect_uri", redirectURI)
+	params.Set("client_id", cfg.ClientID)
+	params.Set("redirect_uri", sentRedirectURI())
 	params.Set("response_type", "code")
-	params.Set("scope", scope)
+	params.Set("scope", strings.ReplaceAll(cfg.Scope, " ", cfg.ScopeSeparator))
 	params.Set("state", state)
-	params.Set("code_challenge", pkce.Challenge)
-	params.Set("code_challenge_method", pkce.Method)
+	setAudienceParams(params)
+	if pkce.Method != pkceMethodNone {
+		params.Set("code_challenge", pkce.Challenge)
+		params.Set("code_challenge_method", pkce.Method)
+	}
 
-	return serverURL + "/oauth/authorize?" + params.Encode()
+	return endpointURL(activeProvider.authorizePath) + "?" + params.Encode()
 }
 
 // exchangeCode exchanges an authorization code for access + refresh tokens.
-func exchangeCode(ctx context.Context, code, codeVerifier string) (*tui.TokenStorage, error) {
+func exchangeCode(
+	ctx context.Context,
+	code, codeVerifier string,
+) (storage *tui.TokenStorage, err error) {
+	defer func() { auditLog.record("login", "", err) }()
+	ctx, span := startSpan(ctx, "oauth.exchange", spanKindInternal)
+	defer func() { span.end(err) }()
+	span.set("oauth.grant_type", "authorization_code")
+
 	ctx, cancel := context.WithTimeout(ctx, tokenExchangeTimeout)
 	defer cancel()
 
 	data := url.Values{}
 	data.Set("grant_type", "authorization_code")
 	data.Set("code", code)
-	data.Set("redirect_uri", redirectURI)
-	data.Set("client_id", clientID)
-
-	// PKCE is always enabled (defense in depth).
-	data.Set("code_verifier", codeVerifier)
-	if !isPublicClient() {
-		data.Set("client_secret", clientSecret)
+	data.Set("redirect_uri", sentRedirectURI())
+	data.Set("client_id", cfg.ClientID)
+	setAudienceParams(data)
+	setMachineBinding(data)
+
+	// PKCE is enabled unless explicitly disabled with -pkce-method=none
+	// (defense in depth, even for confidential clients).
+	if codeVerifier != "" {
+		data.Set("code_verifier", codeVerifier)
 	}
 
-	req, err := http.NewRequestWithContext(
-		ctx,
-		http.MethodPost,
-		serverURL+"/oauth/token",
-		strings.NewReader(data.Encode()),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	resp, err := retryClient.DoWithContext(ctx, req)
+	resp, endpoint, err := postTokenRequest(ctx, data, tokenKey())
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
@@ -385,25 +1734,39 @@ func exchangeCode(ctx context.Context, code, codeVerifier string) (*tui.TokenSto
 		return nil, parseOAuthError(resp.StatusCode, body, "token exchange")
 	}
 
-	var tokenResp tokenResponse
-	if err := json.Unmarshal(body, &tokenResp); err != nil {
+	tokenResp, err := decodeTokenResponse(resp.Header.Get("Content-Type"), body)
+	if err != nil {
 		return nil, fmt.Errorf("failed to parse token response: %w", err)
 	}
+	if tokenResp.Error != "" {
+		return nil, fmt.Errorf("%s: %s", tokenResp.Error, tokenResp.ErrorDescription)
+	}
 
 	if err := validateTokenResponse(
 		tokenResp.AccessToken,
 		tokenResp.TokenType,
-		tokenResp.ExpiresIn,
+		int(tokenResp.ExpiresIn),
 	); err != nil {
 		return nil, fmt.Errorf("invalid token response: %w", err)
 	}
+	recordGrant(tokenResp)
+	recordStickyEndpoint(tokenKey(), endpoint)
+	recordRefreshExpiry(tokenKey(), tokenResp, clock.Now())
+	if tokenResp.RefreshToken != "" {
+		// An omitted scope means the requested one was granted (RFC 6749 §5.1).
+		granted := tokenResp.Scope
+		if granted == "" {
+			granted = cfg.Scope
+		}
+		recordGrantedScope(tokenKey(), normalizeScopes(granted))
+	}
 
 	return &tui.TokenStorage{
 		AccessToken:  tokenResp.AccessToken,
 		RefreshToken: tokenResp.RefreshToken,
 		TokenType:    tokenResp.TokenType,
-		ExpiresAt:    time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second),
-		ClientID:     clientID,
+		ExpiresAt:    tokenExpiry(int(tokenResp.ExpiresIn)),
+		ClientID:     cfg.ClientID,
 	}, nil
 }
 
@@ -411,32 +1774,42 @@ func exchangeCode(ctx context.Context, code, codeVerifier string) (*tui.TokenSto
 // Token refresh
 // -----------------------------------------------------------------------
 
-func refreshAccessToken(ctx context.Context, refreshToken string) (*tui.TokenStorage, error) {
+func refreshAccessToken(
+	ctx context.Context,
+	refreshToken string,
+) (*tui.TokenStorage, error) {
+	return refreshAccessTokenScope(ctx, tokenKey(), refreshToken, "")
+}
+
+// refreshAccessTokenScope refreshes the access token with the refresh token
+// stored under key, asking for reqScope (a subset of the granted scopes,
+// RFC 6749 §6) when it is not empty. The endpoint, refresh token expiry and
+// granted scope are recorded for key.
+func refreshAccessTokenScope(
+	ctx context.Context,
+	key, refreshToken, reqScope string,
+) (storage *tui.TokenStorage, err error) {
+	defer func() { auditLog.record("refresh", "", err) }()
+	ctx, span := startSpan(ctx, "oauth.refresh", spanKindInternal)
+	defer func() { span.end(err) }()
+	span.set("oauth.grant_type", "refresh_token")
+
 	ctx, cancel := context.WithTimeout(ctx, refreshTokenTimeout)
 	defer cancel()
 
 	data := url.Values{}
 	data.Set("grant_type", "refresh_token")
 	data.Set("refresh_token", refreshToken)
-	data.Set("client_id", clientID)
-	if !isPublicClient() {
-		data.Set("client_secret", clientSecret)
-	}
-
-	req, err := http.NewRequestWithContext(
-		ctx,
-		http.MethodPost,
-		serverURL+"/oauth/token",
-		strings.NewReader(data.Encode()),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	data.Set("client_id", cfg.ClientID)
+	if reqScope != "" {
+		data.Set("scope", strings.ReplaceAll(reqScope, " ", cfg.ScopeSeparator))
 	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	setAudienceParams(data)
+	setMachineBinding(data)
 
-	resp, err := retryClient.DoWithContext(ctx, req)
+	resp, endpoint, err := postTokenRequest(ctx, data, key)
 	if err != nil {
-		return nil, fmt.Errorf("refresh request failed: %w", err)
+		return nil, fmt.Errorf("refresh request failed: %w", serverUnreachable(err))
 	}
 	defer resp.Body.Close()
 
@@ -453,18 +1826,30 @@ func refreshAccessToken(ctx context.Context, refreshToken string) (*tui.TokenSto
 		return nil, parseOAuthError(resp.StatusCode, body, "refresh")
 	}
 
-	var tokenResp tokenResponse
-	if err := json.Unmarshal(body, &tokenResp); err != nil {
+	tokenResp, err := decodeTokenResponse(resp.Header.Get("Content-Type"), body)
+	if err != nil {
 		return nil, fmt.Errorf("failed to parse token response: %w", err)
 	}
+	if tokenResp.Error != "" {
+		if isRefreshTokenErrorCode(tokenResp.Error) {
+			return nil, tui.ErrRefreshTokenExpired
+		}
+		return nil, fmt.Errorf("%s: %s", tokenResp.Error, tokenResp.ErrorDescription)
+	}
 
 	if err := validateTokenResponse(
 		tokenResp.AccessToken,
 		tokenResp.TokenType,
-		tokenResp.ExpiresIn,
+		int(tokenResp.ExpiresIn),
 	); err != nil {
 		return nil, fmt.Errorf("invalid token response: %w", err)
 	}
+	recordGrant(tokenResp)
+	recordStickyEndpoint(key, endpoint)
+	recordRefreshExpiry(key, tokenResp, clock.Now())
+	if tokenResp.Scope != "" && reqScope == "" {
+		recordGrantedScope(key, normalizeScopes(tokenResp.Scope))
+	}
 
 	// Preserve the old refresh token in fixed-mode (server may not return a new one).
 	newRefreshToken := tokenResp.RefreshToken
@@ -472,12 +1857,12 @@ func refreshAccessToken(ctx context.Context, refreshToken string) (*tui.TokenSto
 		newRefreshToken = refreshToken
 	}
 
-	storage := &tui.TokenStorage{
+	storage = &tui.TokenStorage{
 		AccessToken:  tokenResp.AccessToken,
 		RefreshToken: newRefreshToken,
 		TokenType:    tokenResp.TokenType,
-		ExpiresAt:    time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second),
-		ClientID:     clientID,
+		ExpiresAt:    tokenExpiry(int(tokenResp.ExpiresIn)),
+		ClientID:     cfg.ClientID,
 	}
 
 	return storage, nil
@@ -487,19 +1872,29 @@ func refreshAccessToken(ctx context.Context, refreshToken string) (*tui.TokenSto
 // Token verification / API demo
 // -----------------------------------------------------------------------
 
-func verifyToken(ctx context.Context, accessToken string) (string, error) {
+func verifyToken(ctx context.Context, accessToken string) (_ string, err error) {
+	if activeProvider.tokenInfoPath == "" {
+		return "", tui.ErrNotSupported
+	}
+	endpoint := endpointURL(activeProvider.tokenInfoPath)
+	if info, ok := cachedTokenInfo(endpoint, accessToken, clock.Now()); ok {
+		return info, nil
+	}
+	ctx, span := startSpan(ctx, "oauth.introspect", spanKindInternal)
+	defer func() { span.end(err) }()
+
 	ctx, cancel := context.WithTimeout(ctx, tokenVerificationTimeout)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, serverURL+"/oauth/tokeninfo", nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 
-	resp, err := retryClient.DoWithContext(ctx, req)
+	resp, err := cfg.RetryClient.DoWithContext(ctx, req)
 	if err != nil {
-		return "", fmt.Errorf("request failed: %w", err)
+		return "", fmt.Errorf("request failed: %w", serverUnreachable(err))
 	}
 	defer resp.Body.Close()
 
@@ -508,56 +1903,27 @@ func verifyToken(ctx context.Context, accessToken string) (string, error) {
 		return "", fmt.Errorf("failed to read response: %w", err)
 	}
 
+	if resp.StatusCode == http.StatusNotFound && !cfg.StrictChecks {
+		return "", tui.ErrNotSupported
+	}
 	if resp.StatusCode != http.StatusOK {
 		return "", parseOAuthError(resp.StatusCode, body, "token verification")
 	}
 
+	cacheTokenInfo(endpoint, accessToken, string(body), clock.Now())
 	return string(body), nil
 }
 
 // makeAPICallWithAutoRefresh demonstrates the 401 → refresh → retry pattern.
 func makeAPICallWithAutoRefresh(ctx context.Context, storage *tui.TokenStorage) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, serverURL+"/oauth/tokeninfo", nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+	if activeProvider.tokenInfoPath == "" {
+		return tui.ErrNotSupported
 	}
-	req.Header.Set("Authorization", "Bearer "+storage.AccessToken)
 
-	resp, err := retryClient.DoWithContext(ctx, req)
+	resp, err := callAPI(ctx, storage, http.MethodGet,
+		endpointURL(activeProvider.tokenInfoPath), nil, apiCallOptions{})
 	if err != nil {
-		return fmt.Errorf("API request failed: %w", err)
-	}
-
-	if resp.StatusCode == http.StatusUnauthorized {
-		// Drain and close body so the HTTP transport can reuse the connection.
-		_, _ = io.Copy(io.Discard, resp.Body)
-		resp.Body.Close()
-
-		newStorage, err := refreshAccessToken(ctx, storage.RefreshToken)
-		if err != nil {
-			if err == tui.ErrRefreshTokenExpired {
-				return tui.ErrRefreshTokenExpired
-			}
-			return fmt.Errorf("refresh failed: %w", err)
-		}
-
-		*storage = *newStorage
-
-		req, err = http.NewRequestWithContext(
-			ctx,
-			http.MethodGet,
-			serverURL+"/oauth/tokeninfo",
-			nil,
-		)
-		if err != nil {
-			return fmt.Errorf("failed to create retry request: %w", err)
-		}
-		req.Header.Set("Authorization", "Bearer "+storage.AccessToken)
-
-		resp, err = retryClient.DoWithContext(ctx, req)
-		if err != nil {
-			return fmt.Errorf("retry failed: %w", err)
-		}
+		return err
 	}
 	defer resp.Body.Close()
 
@@ -566,6 +1932,9 @@ func makeAPICallWithAutoRefresh(ctx context.Context, storage *tui.TokenStorage)
 		return fmt.Errorf("failed to read response: %w", err)
 	}
 
+	if resp.StatusCode == http.StatusNotFound && !cfg.StrictChecks {
+		return tui.ErrNotSupported
+	}
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("API call failed with status %d: %s", resp.StatusCode, string(body))
 	}
@@ -577,60 +1946,258 @@ func makeAPICallWithAutoRefresh(ctx context.Context, storage *tui.TokenStorage)
 // main
 // -----------------------------------------------------------------------
 
+// subcommands maps an optional leading subcommand to its handler. Each
+// handler returns the process exit code. Without a subcommand the interactive
+// TUI flow (login) runs.
+var subcommands = map[string]func(ctx context.Context) int{
+	"bench":     runBench,
+	"call":      runCall,
+	"federate":  runFederate,
+	"login":     runLogin,
+	"ping":      runPing,
+	"refresh":   runRefresh,
+	"revoke":    runRevoke,
+	"status":    runStatus,
+	"token":     runToken,
+	"tokeninfo": runTokenInfo,
+	"tokens":    runTokens,
+	"whoami":    runWhoami,
+}
+
 func main() {
-	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	var err error
+	if tracer, err = newTracerFromEnv(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: tracing disabled: %v\n", err)
+	}
+
+	name, run := "login", runLogin
+	if len(os.Args) > 1 {
+		if sub, ok := subcommands[os.Args[1]]; ok {
+			name, run = os.Args[1], sub
+			// Drop the subcommand so the remaining flags parse as usual.
+			os.Args = append(os.Args[:1:1], os.Args[2:]...)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(
+		context.Background(),
+		syscall.SIGINT,
+		syscall.SIGTERM,
+	)
+	code := runTraced(ctx, name, run)
+	stop()
+	// login shows the nudge among its warnings.
+	if name != "login" {
+		if nudge := refreshNudge(clock.Now()); nudge != "" {
+			fmt.Fprintln(os.Stderr, "Warning: "+nudge)
+		}
+	}
+	os.Exit(code)
+}
 
+// runTraced runs a command inside the root trace span and exports the trace
+// when tracing is configured.
+func runTraced(ctx context.Context, name string, run func(context.Context) int) int {
+	root := tracer.startRoot("oauth-cli " + name)
+	code := run(ctx)
+	root.set("oauth.command", name)
+	root.set("oauth.client_id", cfg.ClientID)
+	root.set("server.address", serverHost(cfg.ServerURL))
+	root.set("process.exit.code", code)
+	var err error
+	if code != 0 {
+		err = fmt.Errorf("exit code %d", code)
+	}
+	root.end(err)
+	if err := tracer.flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to export traces: %v\n", err)
+	}
+	return code
+}
+
+// runLogin runs the interactive TUI flow and returns the process exit code.
+// With -output=json the TUI renders to stderr and, on success, a single JSON
+// document describing the token is written to stdout.
+func runLogin(ctx context.Context) (code int) {
 	initConfig()
+	defer func() {
+		cfg.Progress.emit(progressEvent{Event: eventFlowFinished, ExitCode: &code})
+	}()
+
+	if err := validateRedirectURI(cfg.RedirectURI, cfg.CallbackPort); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid redirect URI %s: %v\n", cfg.RedirectURI, err)
+		return 1
+	}
+	if cfg.ServerSocket != "" && !isEndpointURL(activeProvider.authorizePath) {
+		fmt.Fprintf(os.Stderr, "Error: the browser cannot reach the server socket %s; "+
+			"set -authorize-path to the server's public authorization URL\n", cfg.ServerSocket)
+		return 1
+	}
+
+	if cfg.ReadOnly {
+		// Only a stored, still-valid token can be used without writing.
+		tok, err := cfg.TokenStore.Load(tokenKey())
+		if err != nil || !tui.TokenValid(&tok, clock.Now()) {
+			fmt.Fprintf(os.Stderr, "Error: no valid stored token and %v\n", errReadOnly)
+			return 1
+		}
+	}
+
+	var (
+		meta    *serverMetadata
+		metaErr error
+	)
+	if cfg.Discovery {
+		meta, metaErr = fetchServerMetadata(ctx)
+		cfg.ExpectedIssuer = responseIssuer(meta)
+		applyServerCapabilities(meta)
+		if meta != nil && cfg.RevokeOnAbort && activeProvider.revokePath == "" {
+			configWarnings = append(configWarnings, "The server advertises no revocation endpoint; "+
+				"-revoke-on-abort will only delete the local copy of the tokens.")
+		}
+	}
+	method, warning := resolvePKCEMethod(meta, metaErr)
+	enforcePolicy(method)
+	if warning != "" {
+		configWarnings = append(configWarnings, warning)
+	}
+	if nudge := refreshNudge(clock.Now()); nudge != "" {
+		configWarnings = append(configWarnings, nudge)
+	}
 
 	clientMode := "public (PKCE)"
+	if method == pkceMethodNone {
+		clientMode = "public"
+	}
 	if !isPublicClient() {
 		clientMode = "confidential"
 	}
 
 	deps := tui.Deps{
 		LoadTokens: func() (*tui.TokenStorage, error) {
-			tok, err := tokenStore.Load(clientID)
+			tok, err := cfg.TokenStore.Load(tokenKey())
 			if err != nil {
 				return nil, err
 			}
 			return &tok, nil
 		},
 		RefreshToken: func(ctx context.Context, refreshToken string) (*tui.TokenStorage, string, error) {
-			storage, err := refreshAccessToken(ctx, refreshToken)
+			storage, err := memTokens.Refresh(ctx, tokenKey(), refreshToken)
+			if errors.Is(err, errRefreshNotSaved) {
+				return storage, fmt.Sprintf("Warning: %v", err), nil
+			}
 			if err != nil {
 				return nil, "", err
 			}
-			saveWarning := ""
-			if saveErr := tokenStore.Save(storage.ClientID, *storage); saveErr != nil {
-				saveWarning = fmt.Sprintf("Warning: Failed to save refreshed tokens: %v", saveErr)
+			return storage, "", nil
+		},
+		GenerateState: func() (string, error) {
+			if cfg.StateKey == nil {
+				return generateState()
 			}
-			return storage, saveWarning, nil
+			return generateSignedState(cfg.StateKey, statePayload{Command: "login"}, clock.Now())
+		},
+		GeneratePKCE: func() (*tui.PKCEParams, error) {
+			return generatePKCE(method, cfg.PKCEBytes)
 		},
-		GenerateState: generateState,
-		GeneratePKCE:  GeneratePKCE,
 		BuildAuthURL:  buildAuthURL,
 		OpenBrowser:   openBrowser,
 		StartCallback: startCallbackServer,
 		ExchangeCode:  exchangeCode,
 		SaveTokens: func(storage *tui.TokenStorage) error {
-			return tokenStore.Save(storage.ClientID, *storage)
+			return cfg.TokenStore.Save(tokenKey(), *storage)
 		},
-		VerifyToken:  verifyToken,
-		MakeAPICall:  makeAPICallWithAutoRefresh,
-		CallbackPort: callbackPort,
+		VerifyToken:   verifyToken,
+		MakeAPICall:   makeAPICallWithAutoRefresh,
+		CallbackPort:  cfg.CallbackPort,
+		CallbackWait:  cfg.CallbackTimeout,
+		ReopenAfter:   cfg.ReopenAfter,
+		RefreshBefore: cfg.RefreshBefore,
+		ShowToken:     cfg.ShowToken,
+		Strict:        cfg.StrictChecks,
+		Now:           clock.Now,
+	}
+	if cfg.ConfirmIdentity {
+		deps.Identity = tokenSubject
+	}
+	if cfg.Timings != nil {
+		deps.Timings = cfg.Timings.Timings
+	}
+
+	opts := []tea.ProgramOption{tea.WithoutSignalHandler()}
+	switch {
+	case cfg.Progress != nil:
+		// The event stream replaces the TUI, which runs headless.
+		cfg.Progress.instrument(&deps)
+		for _, w := range configWarnings {
+			cfg.Progress.emit(progressEvent{Event: eventWarning, Message: w})
+		}
+		opts = append(opts, tea.WithoutRenderer(), tea.WithInput(nil), tea.WithOutput(io.Discard))
+	case cfg.OutputFormat == outputJSON:
+		opts = append(opts, tea.WithOutput(os.Stderr))
 	}
 
+	// Signals also reach the model as InterruptMsg, so an interrupt during the
+	// token exchange can still persist the grant before exiting: the exchange
+	// runs detached from ctx, and the model waits for it.
 	p := tea.NewProgram(
-		tui.NewOAuthModel(ctx, deps, clientMode, serverURL, clientID, configWarnings),
+		tui.NewOAuthModel(
+			ctx,
+			deps,
+			clientMode,
+			cfg.ServerURL,
+			cfg.ClientID,
+			configWarnings,
+		),
+		opts...,
 	)
+	stop := forwardSignals(p)
 	finalRaw, err := p.Run()
+	stop()
 	if err != nil {
-		stop()
 		fmt.Fprintf(os.Stderr, "TUI error: %v\n", err)
-		os.Exit(1)
+		return 1
 	}
-	stop()
-	if m, ok := finalRaw.(tui.OAuthModel); ok && m.ExitCode != 0 {
-		os.Exit(m.ExitCode)
+	m, ok := finalRaw.(tui.OAuthModel)
+	if ok && m.ExitCode != 0 {
+		if m.ExitCode == 130 && cfg.RevokeOnAbort {
+			handleAbortRevocation(m.ObtainedToken())
+		}
+		return m.ExitCode
+	}
+	if ok && cfg.OutputFormat == outputJSON && m.Token() != nil {
+		err := writeLoginJSON(os.Stdout, m.Token())
+		auditLog.record("export", "login -output json", err)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// forwardSignals delivers every SIGINT/SIGTERM to the TUI as tui.InterruptMsg.
+// The model decides whether to stop immediately or to finish an in-flight
+// exchange first; a repeated signal always force-quits. The returned function
+// unregisters the handler.
+func forwardSignals(p *tea.Program) func() {
+	sigCh := make(chan os.Signal, 2)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-sigCh:
+				p.Send(tui.InterruptMsg{})
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigCh)
+		close(done)
 	}
 }
@@ -2,7 +2,11 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -12,6 +16,26 @@ import (
 	"github.com/go-authgate/sdk-go/credstore"
 )
 
+func TestReadSecret(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"s3cret\n", "s3cret", false},
+		{"s3cret\r\nignored\n", "s3cret", false},
+		{"s3cret", "s3cret", false},
+		{"", "", true},
+		{"\n", "", true},
+	}
+	for _, tt := range tests {
+		got, err := readSecret(strings.NewReader(tt.input))
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("readSecret(%q) = %q, %v; want %q, error %v", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
 func TestValidateServerURL(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -68,8 +92,11 @@ func TestValidateTokenResponse(t *testing.T) {
 		{"valid empty type", "a-long-enough-token", "", 3600, false},
 		{"empty access token", "", "Bearer", 3600, true},
 		{"too short token", "short", "Bearer", 3600, true},
-		{"zero expires_in", "a-long-enough-token", "Bearer", 0, true},
+		{"lowercase bearer", "a-long-enough-token", "bearer", 3600, false},
+		{"omitted expires_in", "a-long-enough-token", "Bearer", 0, false},
 		{"negative expires_in", "a-long-enough-token", "Bearer", -1, true},
+		{"one year expires_in", "a-long-enough-token", "Bearer", maxExpiresIn, false},
+		{"absurd expires_in", "a-long-enough-token", "Bearer", 1 << 40, true},
 		{"wrong token type", "a-long-enough-token", "MAC", 3600, true},
 	}
 
@@ -83,6 +110,16 @@ func TestValidateTokenResponse(t *testing.T) {
 	}
 }
 
+func TestErrorBodySnippet(t *testing.T) {
+	if got := errorBodySnippet([]byte("bad gateway\x1b[2J")); got != "bad gateway\uFFFD[2J" {
+		t.Errorf("control characters not replaced: %q", got)
+	}
+	got := errorBodySnippet([]byte(strings.Repeat("x", 2*maxErrorBodyEcho)))
+	if len(got) != maxErrorBodyEcho+len("... (truncated)") || !strings.HasSuffix(got, "(truncated)") {
+		t.Errorf("long body not truncated: length %d", len(got))
+	}
+}
+
 func TestSaveAndLoadTokens(t *testing.T) {
 	// Use a non-existent path so FileStore starts fresh (empty file causes JSON parse error).
 	store := credstore.NewTokenFileStore(filepath.Join(t.TempDir(), "tokens.json"))
@@ -146,21 +183,21 @@ func TestSaveTokens_MultipleClients(t *testing.T) {
 }
 
 func TestBuildAuthURL_ContainsRequiredParams(t *testing.T) {
-	originalServerURL := serverURL
-	originalClientID := clientID
-	originalRedirectURI := redirectURI
-	originalScope := scope
+	originalServerURL := cfg.ServerURL
+	originalClientID := cfg.ClientID
+	originalRedirectURI := cfg.RedirectURI
+	originalScope := cfg.Scope
 	t.Cleanup(func() {
-		serverURL = originalServerURL
-		clientID = originalClientID
-		redirectURI = originalRedirectURI
-		scope = originalScope
+		cfg.ServerURL = originalServerURL
+		cfg.ClientID = originalClientID
+		cfg.RedirectURI = originalRedirectURI
+		cfg.Scope = originalScope
 	})
 
-	serverURL = "http://localhost:8080"
-	clientID = "my-client-id"
-	redirectURI = "http://localhost:8888/callback"
-	scope = "read write"
+	cfg.ServerURL = "http://localhost:8080"
+	cfg.ClientID = "my-client-id"
+	cfg.RedirectURI = "http://localhost:8888/callback"
+	cfg.Scope = "read write"
 
 	pkce := &tui.PKCEParams{
 		Verifier:  "test-verifier",
@@ -187,15 +224,15 @@ func TestBuildAuthURL_ContainsRequiredParams(t *testing.T) {
 }
 
 func TestIsPublicClient(t *testing.T) {
-	orig := clientSecret
-	t.Cleanup(func() { clientSecret = orig })
+	orig := cfg.ClientSecret
+	t.Cleanup(func() { cfg.ClientSecret = orig })
 
-	clientSecret = ""
+	cfg.ClientSecret = ""
 	if !isPublicClient() {
 		t.Error("expected public client when secret is empty")
 	}
 
-	clientSecret = "secret"
+	cfg.ClientSecret = "secret"
 	if isPublicClient() {
 		t.Error("expected confidential client when secret is set")
 	}
@@ -235,6 +272,23 @@ func TestInitTokenStore_Keyring(t *testing.T) {
 	}
 }
 
+func TestInitTokenStore_Memory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	store, _, err := initTokenStore("memory", path, "test-service")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := store.Save("cid", credstore.Token{AccessToken: "at"}); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	if tok, err := store.Load("cid"); err != nil || tok.AccessToken != "at" {
+		t.Errorf("Load() = %+v, %v", tok, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("memory store touched the token file: %v", err)
+	}
+}
+
 func TestInitTokenStore_Auto(t *testing.T) {
 	store, warnings, err := initTokenStore(
 		"auto",
@@ -310,3 +364,110 @@ func TestReadResponseBody(t *testing.T) {
 		}
 	})
 }
+
+func TestBuildAuthURL_PKCEMethodNone(t *testing.T) {
+	originalServerURL := cfg.ServerURL
+	t.Cleanup(func() { cfg.ServerURL = originalServerURL })
+	cfg.ServerURL = "http://localhost:8080"
+
+	u := buildAuthURL("random-state", &tui.PKCEParams{Method: pkceMethodNone})
+
+	for _, unwanted := range []string{"code_challenge=", "code_challenge_method="} {
+		if strings.Contains(u, unwanted) {
+			t.Errorf("auth URL should not contain %q when PKCE is disabled\nURL: %s", unwanted, u)
+		}
+	}
+}
+
+// TestExchangeCode_OfflineTokenWithoutRefreshExpiry verifies that a Keycloak
+// offline token response (refresh_expires_in of 0) is accepted.
+func TestExchangeCode_OfflineTokenWithoutRefreshExpiry(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"offline-access-token","expires_in":300,` +
+			`"refresh_expires_in":0,"refresh_token":"offline-refresh","token_type":"Bearer",` +
+			`"scope":"openid offline_access"}`))
+	}))
+	defer srv.Close()
+	setTestServer(t, srv)
+
+	storage, err := exchangeCode(context.Background(), "code", "verifier")
+	if err != nil {
+		t.Fatalf("exchangeCode() error: %v", err)
+	}
+	if storage.RefreshToken != "offline-refresh" {
+		t.Errorf("RefreshToken = %q, want offline-refresh", storage.RefreshToken)
+	}
+}
+
+// TestExchangeCode_FormEncodedResponse verifies GitHub-style token responses:
+// form-encoded, lowercase token_type and no expires_in.
+func TestExchangeCode_FormEncodedResponse(t *testing.T) {
+	var gotAccept string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAccept = r.Header.Get("Accept")
+		w.Header().Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+		_, _ = w.Write([]byte("access_token=gho_form-access-token&scope=read%3Auser&token_type=bearer"))
+	}))
+	defer srv.Close()
+	setTestServer(t, srv)
+
+	storage, err := exchangeCode(context.Background(), "code", "verifier")
+	if err != nil {
+		t.Fatalf("exchangeCode() error: %v", err)
+	}
+	if !strings.HasPrefix(gotAccept, "application/json") {
+		t.Errorf("Accept = %q, want application/json first", gotAccept)
+	}
+	if storage.AccessToken != "gho_form-access-token" {
+		t.Errorf("AccessToken = %q, want gho_form-access-token", storage.AccessToken)
+	}
+	if !storage.ExpiresAt.IsZero() {
+		t.Errorf("ExpiresAt = %v, want zero for a token without expires_in", storage.ExpiresAt)
+	}
+	if !tui.TokenValid(storage, time.Now()) {
+		t.Error("token without expiry should be valid")
+	}
+}
+
+func TestDecodeTokenResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantToken   string
+		wantExpires int
+		wantError   string
+	}{
+		{"json", "application/json", `{"access_token":"a","expires_in":60}`, "a", 60, ""},
+		{"form", "application/x-www-form-urlencoded", "access_token=a&expires_in=60", "a", 60, ""},
+		{
+			"form error with 200",
+			"application/x-www-form-urlencoded",
+			"error=bad_verification_code&error_description=The+code+is+incorrect",
+			"", 0, "bad_verification_code",
+		},
+		{"json error", "application/json", `{"error":"invalid_grant"}`, "", 0, "invalid_grant"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := decodeTokenResponse(tc.contentType, []byte(tc.body))
+			if err != nil {
+				t.Fatalf("decodeTokenResponse() error = %v", err)
+			}
+			if resp.AccessToken != tc.wantToken || int(resp.ExpiresIn) != tc.wantExpires {
+				t.Errorf("got token %q expires_in %d, want %q %d",
+					resp.AccessToken, resp.ExpiresIn, tc.wantToken, tc.wantExpires)
+			}
+			if resp.Error != tc.wantError {
+				t.Errorf("Error = %q, want %q", resp.Error, tc.wantError)
+			}
+		})
+	}
+
+	if _, err := decodeTokenResponse(
+		"application/x-www-form-urlencoded", []byte("expires_in=soon"),
+	); err == nil {
+		t.Error("expected error for non-numeric expires_in")
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/go-authgate/sdk-go/credstore"
+)
+
+// memoryStore keeps tokens only in process memory; nothing is written to
+// disk, a keyring or an external tool, and every token is gone when the
+// process exits. Each run therefore starts with a fresh login, which suits CI
+// jobs and security-sensitive runs that pass the token on with -output json.
+type memoryStore struct {
+	mu     sync.Mutex
+	tokens map[string]credstore.Token
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{tokens: make(map[string]credstore.Token)}
+}
+
+func (s *memoryStore) Load(id string) (credstore.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tok, ok := s.tokens[id]
+	if !ok {
+		return credstore.Token{}, fmt.Errorf("no token in memory for %s", id)
+	}
+	return tok, nil
+}
+
+func (s *memoryStore) Save(id string, tok credstore.Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[id] = tok
+	return nil
+}
+
+func (s *memoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, id)
+	return nil
+}
+
+func (s *memoryStore) String() string {
+	return "memory (not persisted)"
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// defaultNudgeDays is how close to expiry a refresh token must be before
+// commands warn about it.
+const defaultNudgeDays = 7
+
+// refreshExpiryState records when each stored refresh token expires, from
+// the refresh_expires_in field some servers (Keycloak) return. The file maps
+// "authgate:<host>/<token key>" to the expiry time; it holds no secrets.
+var refreshExpiryState struct {
+	sync.Mutex
+	path string // "" disables recording
+}
+
+func loadRefreshExpiryState() map[string]time.Time {
+	state := make(map[string]time.Time)
+	if data, err := os.ReadFile(refreshExpiryState.path); err == nil {
+		_ = json.Unmarshal(data, &state)
+	}
+	return state
+}
+
+// recordRefreshExpiry remembers when the refresh token in resp expires. A new
+// refresh token without refresh_expires_in (offline tokens) clears the old
+// entry; a response without a refresh token leaves it alone. Failures are
+// ignored: the record only feeds the expiry warning.
+func recordRefreshExpiry(key string, resp *tokenResponse, now time.Time) {
+	refreshExpiryState.Lock()
+	defer refreshExpiryState.Unlock()
+	if refreshExpiryState.path == "" || resp.RefreshToken == "" {
+		return
+	}
+	state := loadRefreshExpiryState()
+	id := stickyEndpointKey(key)
+	if n := int(resp.RefreshExpiresIn); n > 0 && n <= maxExpiresIn {
+		state[id] = now.Add(time.Duration(n) * time.Second).UTC()
+	} else if _, ok := state[id]; ok {
+		delete(state, id)
+	} else {
+		return
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return
+	}
+	if os.MkdirAll(filepath.Dir(refreshExpiryState.path), 0o700) != nil {
+		return
+	}
+	_ = writeFileSync(refreshExpiryState.path, data)
+}
+
+// grantedScopeState records the scope granted with each stored refresh
+// token, so `status` can tell offline from online sessions by what the grant
+// got rather than by the current -scope. The file maps
+// "authgate:<host>/<token key>" to the space-separated scope.
+var grantedScopeState struct {
+	sync.Mutex
+	path string // "" disables recording
+}
+
+func loadGrantedScopeState() map[string]string {
+	state := make(map[string]string)
+	if data, err := os.ReadFile(grantedScopeState.path); err == nil {
+		_ = json.Unmarshal(data, &state)
+	}
+	return state
+}
+
+// recordGrantedScope remembers granted as the scope of the refresh token
+// stored under key. Failures are ignored, as with recordRefreshExpiry.
+func recordGrantedScope(key, granted string) {
+	grantedScopeState.Lock()
+	defer grantedScopeState.Unlock()
+	if grantedScopeState.path == "" {
+		return
+	}
+	state := loadGrantedScopeState()
+	id := stickyEndpointKey(key)
+	if cur, ok := state[id]; ok && cur == granted {
+		return
+	}
+	state[id] = granted
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return
+	}
+	if os.MkdirAll(filepath.Dir(grantedScopeState.path), 0o700) != nil {
+		return
+	}
+	_ = writeFileSync(grantedScopeState.path, data)
+}
+
+// grantedScope returns the recorded scope of the refresh token stored under
+// key; ok is false when none was recorded (tokens from older versions).
+func grantedScope(key string) (granted string, ok bool) {
+	grantedScopeState.Lock()
+	defer grantedScopeState.Unlock()
+	if grantedScopeState.path == "" {
+		return "", false
+	}
+	granted, ok = loadGrantedScopeState()[stickyEndpointKey(key)]
+	return granted, ok
+}
+
+// refreshTokenExpiry returns when refreshToken, stored under key, expires:
+// the recorded refresh_expires_in, else the exp claim when the refresh token
+// is a JWT. The zero time means the expiry is unknown.
+func refreshTokenExpiry(key, refreshToken string) time.Time {
+	refreshExpiryState.Lock()
+	if refreshExpiryState.path != "" {
+		if expiresAt, ok := loadRefreshExpiryState()[stickyEndpointKey(key)]; ok {
+			refreshExpiryState.Unlock()
+			return expiresAt
+		}
+	}
+	refreshExpiryState.Unlock()
+
+	claims, err := decodeJWTClaims(refreshToken)
+	if err != nil {
+		return time.Time{}
+	}
+	if exp, ok := claims["exp"].(float64); ok && exp > 0 {
+		return time.Unix(int64(exp), 0)
+	}
+	return time.Time{}
+}
+
+// refreshNudge returns a warning when the stored refresh token for the
+// current client expires within cfg.NudgeWindow, or "" when it does not (or its
+// expiry is unknown).
+func refreshNudge(now time.Time) string {
+	if cfg.NudgeWindow <= 0 || cfg.ClientID == "" || cfg.TokenStore == nil {
+		return ""
+	}
+	tok, err := cfg.TokenStore.Load(tokenKey())
+	if err != nil || tok.RefreshToken == "" {
+		return ""
+	}
+	expiresAt := refreshTokenExpiry(tokenKey(), tok.RefreshToken)
+	switch {
+	case expiresAt.IsZero() || expiresAt.Sub(now) > cfg.NudgeWindow:
+		return ""
+	case !now.Before(expiresAt):
+		return fmt.Sprintf("The refresh token for %s has expired; run oauth-cli to log in again.",
+			cfg.ClientID)
+	default:
+		return fmt.Sprintf(
+			"The refresh token for %s expires in %s (%s); run oauth-cli to log in again before then.",
+			cfg.ClientID, expiresAt.Sub(now).Round(time.Minute),
+			expiresAt.Local().Format(time.RFC1123))
+	}
+}
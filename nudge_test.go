@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/base64"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-authgate/oauth-cli/tui"
+)
+
+func TestRefreshNudge(t *testing.T) {
+	setTokenTestConfig(t, "")
+	origPath, origWindow := refreshExpiryState.path, cfg.NudgeWindow
+	t.Cleanup(func() { refreshExpiryState.path, cfg.NudgeWindow = origPath, origWindow })
+	refreshExpiryState.path = filepath.Join(t.TempDir(), "refresh-expiry.json")
+	cfg.NudgeWindow = defaultNudgeDays * 24 * time.Hour
+
+	if err := cfg.TokenStore.Save(tokenKey(), tui.TokenStorage{
+		AccessToken:  "stored-access-token",
+		RefreshToken: "opaque-refresh-token",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	if got := refreshNudge(now); got != "" {
+		t.Errorf("unknown expiry: refreshNudge() = %q, want none", got)
+	}
+
+	recordRefreshExpiry(tokenKey(), &tokenResponse{
+		RefreshToken:     "opaque-refresh-token",
+		RefreshExpiresIn: 3 * 24 * 60 * 60,
+	}, now)
+	if got := refreshNudge(now); !strings.Contains(got, "expires in 72h0m0s") {
+		t.Errorf("refreshNudge() = %q, want a 72h warning", got)
+	}
+	if got := refreshNudge(now.Add(4 * 24 * time.Hour)); !strings.Contains(got, "has expired") {
+		t.Errorf("refreshNudge() after expiry = %q", got)
+	}
+
+	// A new offline refresh token (no refresh_expires_in) clears the record.
+	recordRefreshExpiry(tokenKey(), &tokenResponse{RefreshToken: "offline-refresh"}, now)
+	if got := refreshNudge(now); got != "" {
+		t.Errorf("after offline refresh: refreshNudge() = %q, want none", got)
+	}
+
+	cfg.NudgeWindow = 0
+	recordRefreshExpiry(tokenKey(), &tokenResponse{
+		RefreshToken:     "opaque-refresh-token",
+		RefreshExpiresIn: 60,
+	}, now)
+	if got := refreshNudge(now); got != "" {
+		t.Errorf("-no-nudge: refreshNudge() = %q, want none", got)
+	}
+}
+
+func TestRefreshTokenExpiry_JWT(t *testing.T) {
+	origPath := refreshExpiryState.path
+	t.Cleanup(func() { refreshExpiryState.path = origPath })
+	refreshExpiryState.path = ""
+
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"exp":1900000000}`))
+	got := refreshTokenExpiry("client", "header."+payload+".sig")
+	if !got.Equal(time.Unix(1900000000, 0)) {
+		t.Errorf("refreshTokenExpiry() = %v, want the exp claim", got)
+	}
+	if got := refreshTokenExpiry("client", "opaque"); !got.IsZero() {
+		t.Errorf("opaque token expiry = %v, want zero", got)
+	}
+}
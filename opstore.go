@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-authgate/sdk-go/credstore"
+)
+
+// opPasswordField is the field of the 1Password item that holds the token JSON.
+const opPasswordField = "password"
+
+// opStore stores each token as a Password item in a 1Password vault through
+// the 1Password CLI (op). Items are titled like wincred targets,
+// authgate:<server host>/<token key>. Token JSON is passed to op on stdin,
+// never on the command line.
+type opStore struct {
+	vault  string
+	prefix string
+
+	// run executes op with args and stdin and returns its stdout.
+	run func(stdin []byte, args ...string) ([]byte, error)
+}
+
+// opItem is the subset of `op item list/get --format json` output used here.
+type opItem struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Fields    []struct {
+		ID    string `json:"id"`
+		Value string `json:"value"`
+	} `json:"fields"`
+}
+
+// newOPStore returns a 1Password store for tokens issued by serverURL.
+func newOPStore(serverURL, vault string) *opStore {
+	return &opStore{vault: vault, prefix: credentialTargetPrefix(serverURL), run: commandRunner("op")}
+}
+
+// commandRunner returns a run function that executes bin, returning its
+// stderr as the error on failure.
+func commandRunner(bin string) func(stdin []byte, args ...string) ([]byte, error) {
+	return func(stdin []byte, args ...string) ([]byte, error) {
+		cmd := exec.Command(bin, args...)
+		if stdin != nil {
+			cmd.Stdin = bytes.NewReader(stdin)
+		}
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			name := strings.Join(append([]string{bin}, args[:min(len(args), 2)]...), " ")
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return nil, fmt.Errorf("%s: %s", name, msg)
+			}
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return out, nil
+	}
+}
+
+// items returns the vault items titled for id, newest first. There is
+// normally one; Save creates the replacement before deleting the old item,
+// so an interrupted Save can leave two.
+func (s *opStore) items(id string) ([]opItem, error) {
+	out, err := s.run(nil, "item", "list", "--vault", s.vault, "--format", "json")
+	if err != nil {
+		return nil, err
+	}
+	var all []opItem
+	if err := json.Unmarshal(out, &all); err != nil {
+		return nil, fmt.Errorf("op item list: invalid output: %w", err)
+	}
+	var matches []opItem
+	for _, item := range all {
+		if item.Title == s.prefix+id {
+			matches = append(matches, item)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].UpdatedAt.After(matches[j].UpdatedAt)
+	})
+	return matches, nil
+}
+
+func (s *opStore) Load(id string) (credstore.Token, error) {
+	var tok credstore.Token
+	items, err := s.items(id)
+	if err != nil {
+		return tok, err
+	}
+	if len(items) == 0 {
+		return tok, fmt.Errorf("no token stored in 1Password vault %s for %s", s.vault, s.prefix+id)
+	}
+
+	out, err := s.run(nil, "item", "get", items[0].ID,
+		"--vault", s.vault, "--format", "json", "--reveal")
+	if err != nil {
+		return tok, err
+	}
+	var item opItem
+	if err := json.Unmarshal(out, &item); err != nil {
+		return tok, fmt.Errorf("op item get: invalid output: %w", err)
+	}
+	for _, f := range item.Fields {
+		if f.ID == opPasswordField {
+			if err := json.Unmarshal([]byte(f.Value), &tok); err != nil {
+				return tok, fmt.Errorf("invalid token data in %s: %w", item.Title, err)
+			}
+			return tok, nil
+		}
+	}
+	return tok, fmt.Errorf("1Password item %s has no %s field", item.Title, opPasswordField)
+}
+
+func (s *opStore) Save(id string, tok credstore.Token) error {
+	old, err := s.items(id)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(tok)
+	if err != nil {
+		return err
+	}
+	template, err := json.Marshal(map[string]any{
+		"title":    s.prefix + id,
+		"category": "PASSWORD",
+		"fields": []map[string]string{{
+			"id":      opPasswordField,
+			"type":    "CONCEALED",
+			"purpose": "PASSWORD",
+			"label":   opPasswordField,
+			"value":   string(data),
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := s.run(template, "item", "create", "--vault", s.vault, "--format", "json"); err != nil {
+		return err
+	}
+
+	// The new item exists, so removing the old ones cannot lose the token.
+	return s.deleteItems(old)
+}
+
+func (s *opStore) Delete(id string) error {
+	items, err := s.items(id)
+	if err != nil {
+		return err
+	}
+	return s.deleteItems(items)
+}
+
+func (s *opStore) deleteItems(items []opItem) error {
+	var errs []error
+	for _, item := range items {
+		if _, err := s.run(nil, "item", "delete", item.ID, "--vault", s.vault); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *opStore) String() string {
+	return "op: vault " + s.vault
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-authgate/sdk-go/credstore"
+)
+
+// fakeOP emulates the op item list/get/create/delete commands on an
+// in-memory vault.
+type fakeOP struct {
+	t     *testing.T
+	items map[string]map[string]any
+	next  int
+}
+
+func (f *fakeOP) run(stdin []byte, args ...string) ([]byte, error) {
+	for _, arg := range args {
+		if strings.Contains(arg, "secret-access-token") {
+			f.t.Errorf("token passed on the op command line: %v", args)
+		}
+	}
+	switch args[1] {
+	case "list":
+		list := make([]map[string]any, 0, len(f.items))
+		for _, item := range f.items {
+			list = append(list, item)
+		}
+		return json.Marshal(list)
+	case "get":
+		item, ok := f.items[args[2]]
+		if !ok {
+			return nil, fmt.Errorf("item %s not found", args[2])
+		}
+		return json.Marshal(item)
+	case "create":
+		var item map[string]any
+		if err := json.Unmarshal(stdin, &item); err != nil {
+			return nil, err
+		}
+		f.next++
+		id := fmt.Sprintf("item-%d", f.next)
+		item["id"] = id
+		item["updated_at"] = time.Now().Add(time.Duration(f.next) * time.Second)
+		f.items[id] = item
+		return json.Marshal(item)
+	case "delete":
+		delete(f.items, args[2])
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unexpected op command %v", args)
+}
+
+func TestOPStore_SaveLoadDelete(t *testing.T) {
+	fake := &fakeOP{t: t, items: map[string]map[string]any{}}
+	store := newOPStore("https://auth.example.com", "Engineering")
+	store.run = fake.run
+
+	if _, err := store.Load("cid"); err == nil {
+		t.Error("expected error loading from an empty vault")
+	}
+
+	for _, access := range []string{"first-access-token", "secret-access-token"} {
+		if err := store.Save("cid", credstore.Token{AccessToken: access, ClientID: "cid"}); err != nil {
+			t.Fatalf("Save() error: %v", err)
+		}
+	}
+	if len(fake.items) != 1 {
+		t.Errorf("vault holds %d items, want 1 after replacing the token", len(fake.items))
+	}
+	for _, item := range fake.items {
+		if item["title"] != "authgate:auth.example.com/cid" {
+			t.Errorf("item title = %v", item["title"])
+		}
+	}
+
+	tok, err := store.Load("cid")
+	if err != nil || tok.AccessToken != "secret-access-token" {
+		t.Errorf("Load() = %+v, %v", tok, err)
+	}
+
+	if err := store.Delete("cid"); err != nil {
+		t.Fatalf("Delete() error: %v", err)
+	}
+	if len(fake.items) != 0 {
+		t.Errorf("vault holds %d items after Delete, want 0", len(fake.items))
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"strconv"
+)
+
+// Field numbers of the OTLP trace messages (opentelemetry-proto
+// collector/trace/v1, trace/v1, resource/v1 and common/v1).
+const (
+	pbExportResourceSpans = 1 // ExportTraceServiceRequest.resource_spans
+
+	pbResourceSpansResource   = 1
+	pbResourceSpansScopeSpans = 2
+	pbResourceAttributes      = 1
+	pbScopeSpansScope         = 1
+	pbScopeSpansSpans         = 2
+	pbScopeName               = 1
+
+	pbSpanTraceID      = 1
+	pbSpanSpanID       = 2
+	pbSpanParentSpanID = 4
+	pbSpanName         = 5
+	pbSpanKind         = 6
+	pbSpanStartTime    = 7
+	pbSpanEndTime      = 8
+	pbSpanAttributes   = 9
+	pbSpanStatus       = 15
+	pbStatusMessage    = 2
+	pbStatusCode       = 3
+
+	pbKeyValueKey    = 1
+	pbKeyValueValue  = 2
+	pbAnyValueString = 1
+	pbAnyValueBool   = 2
+	pbAnyValueInt    = 3
+)
+
+// Protobuf wire types.
+const (
+	pbVarint  = 0
+	pbFixed64 = 1
+	pbBytes   = 2
+)
+
+// protoBuf appends protobuf fields to a byte slice. It covers the few field
+// types the OTLP trace export request needs, so the CLI does not depend on a
+// protobuf runtime. Zero values are skipped, as proto3 does.
+type protoBuf []byte
+
+func (b *protoBuf) tag(field, wireType int) {
+	*b = binary.AppendUvarint(*b, uint64(field<<3|wireType))
+}
+
+func (b *protoBuf) varint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.tag(field, pbVarint)
+	*b = binary.AppendUvarint(*b, v)
+}
+
+func (b *protoBuf) fixed64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.tag(field, pbFixed64)
+	*b = binary.LittleEndian.AppendUint64(*b, v)
+}
+
+func (b *protoBuf) bytes(field int, v []byte) {
+	if len(v) == 0 {
+		return
+	}
+	b.tag(field, pbBytes)
+	*b = binary.AppendUvarint(*b, uint64(len(v)))
+	*b = append(*b, v...)
+}
+
+func (b *protoBuf) string(field int, v string) {
+	b.bytes(field, []byte(v))
+}
+
+// message appends an embedded message, even an empty one.
+func (b *protoBuf) message(field int, m protoBuf) {
+	b.tag(field, pbBytes)
+	*b = binary.AppendUvarint(*b, uint64(len(m)))
+	*b = append(*b, m...)
+}
+
+// marshalOTLPProto encodes req as an OTLP ExportTraceServiceRequest in the
+// protobuf encoding used by the http/protobuf protocol.
+func marshalOTLPProto(req otlpTraces) []byte {
+	var out protoBuf
+	for _, rs := range req.ResourceSpans {
+		var resource protoBuf
+		for _, kv := range rs.Resource.Attributes {
+			resource.message(pbResourceAttributes, encodeKeyValue(kv))
+		}
+		var rsBuf protoBuf
+		rsBuf.message(pbResourceSpansResource, resource)
+		for _, ss := range rs.ScopeSpans {
+			var scope protoBuf
+			scope.string(pbScopeName, ss.Scope.Name)
+			var ssBuf protoBuf
+			ssBuf.message(pbScopeSpansScope, scope)
+			for _, s := range ss.Spans {
+				ssBuf.message(pbScopeSpansSpans, encodeSpan(s))
+			}
+			rsBuf.message(pbResourceSpansScopeSpans, ssBuf)
+		}
+		out.message(pbExportResourceSpans, rsBuf)
+	}
+	return out
+}
+
+func encodeSpan(s otlpSpan) protoBuf {
+	var b protoBuf
+	b.bytes(pbSpanTraceID, hexBytes(s.TraceID))
+	b.bytes(pbSpanSpanID, hexBytes(s.SpanID))
+	b.bytes(pbSpanParentSpanID, hexBytes(s.ParentSpanID))
+	b.string(pbSpanName, s.Name)
+	b.varint(pbSpanKind, uint64(s.Kind))
+	b.fixed64(pbSpanStartTime, parseUnixNano(s.StartTime))
+	b.fixed64(pbSpanEndTime, parseUnixNano(s.EndTime))
+	for _, kv := range s.Attributes {
+		b.message(pbSpanAttributes, encodeKeyValue(kv))
+	}
+	if s.Status != nil {
+		var status protoBuf
+		status.string(pbStatusMessage, s.Status.Message)
+		status.varint(pbStatusCode, uint64(s.Status.Code))
+		b.message(pbSpanStatus, status)
+	}
+	return b
+}
+
+func encodeKeyValue(kv otlpKeyValue) protoBuf {
+	var value protoBuf
+	switch v := kv.Value; {
+	case v.StringValue != nil:
+		// An empty string must still be sent to select the string case.
+		value.tag(pbAnyValueString, pbBytes)
+		value = binary.AppendUvarint(value, uint64(len(*v.StringValue)))
+		value = append(value, *v.StringValue...)
+	case v.BoolValue != nil:
+		value.tag(pbAnyValueBool, pbVarint)
+		value = binary.AppendUvarint(value, boolVarint(*v.BoolValue))
+	case v.IntValue != "":
+		n, _ := strconv.ParseInt(v.IntValue, 10, 64)
+		value.tag(pbAnyValueInt, pbVarint)
+		value = binary.AppendUvarint(value, uint64(n))
+	}
+	var b protoBuf
+	b.string(pbKeyValueKey, kv.Key)
+	b.message(pbKeyValueValue, value)
+	return b
+}
+
+func boolVarint(v bool) uint64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+// hexBytes decodes the hex IDs of the JSON encoding; "" gives nil.
+func hexBytes(s string) []byte {
+	b, _ := hex.DecodeString(s)
+	return b
+}
+
+func parseUnixNano(s string) uint64 {
+	n, _ := strconv.ParseUint(s, 10, 64)
+	return n
+}
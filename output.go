@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-authgate/oauth-cli/tui"
+)
+
+// Values accepted by -output.
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// lastGrant keeps the response fields that TokenStorage does not persist
+// (granted scope, ID token) from the most recent exchange or refresh. The
+// exchange runs in the callback server goroutine, hence the mutex.
+var lastGrant struct {
+	sync.Mutex
+	accessToken string
+	scope       string
+	idToken     string
+}
+
+// recordGrant remembers the scope and ID token of a successful token response.
+func recordGrant(resp *tokenResponse) {
+	lastGrant.Lock()
+	defer lastGrant.Unlock()
+	lastGrant.accessToken = resp.AccessToken
+	lastGrant.scope = resp.Scope
+	lastGrant.idToken = resp.IDToken
+}
+
+// loginResult is the document written by -output=json after a successful login.
+type loginResult struct {
+	AccessToken string         `json:"access_token"`
+	TokenType   string         `json:"token_type"`
+	ExpiresAt   *time.Time     `json:"expires_at,omitempty"`
+	Scopes      []string       `json:"scopes"`
+	IDClaims    map[string]any `json:"id_claims,omitempty"`
+}
+
+// writeLoginJSON writes the login result for storage as a single JSON document.
+// Scopes and ID token claims come from the token response when storage was
+// issued during this run; a reused stored token reports the configured scopes.
+func writeLoginJSON(w io.Writer, storage *tui.TokenStorage) error {
+	result := loginResult{
+		AccessToken: storage.AccessToken,
+		TokenType:   storage.TokenType,
+		Scopes:      splitScopes(cfg.Scope),
+	}
+	if !storage.ExpiresAt.IsZero() {
+		expiresAt := storage.ExpiresAt.UTC()
+		result.ExpiresAt = &expiresAt
+	}
+
+	lastGrant.Lock()
+	grantScope, idToken := lastGrant.scope, lastGrant.idToken
+	issuedNow := lastGrant.accessToken == storage.AccessToken
+	lastGrant.Unlock()
+	if issuedNow {
+		if grantScope != "" {
+			result.Scopes = splitScopes(grantScope)
+		}
+		if idToken != "" {
+			claims, err := decodeJWTClaims(idToken)
+			if err != nil {
+				return fmt.Errorf("failed to decode ID token: %w", err)
+			}
+			result.IDClaims = claims
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result)
+}
+
+// tokenSubject describes the account storage was issued to, from the ID token
+// of the grant that produced it: the email or username with the sub claim,
+// e.g. "user@example.com (sub user-1)". -confirm-identity shows it before the
+// tokens are saved.
+func tokenSubject(storage *tui.TokenStorage) string {
+	lastGrant.Lock()
+	idToken := lastGrant.idToken
+	issuedNow := lastGrant.accessToken == storage.AccessToken
+	lastGrant.Unlock()
+	if !issuedNow || idToken == "" {
+		return "unknown account (no ID token; request the openid scope)"
+	}
+	claims, err := decodeJWTClaims(idToken)
+	if err != nil {
+		return "unknown account (" + err.Error() + ")"
+	}
+
+	sub, _ := claims["sub"].(string)
+	for _, claim := range []string{"email", "preferred_username", "name"} {
+		if name, _ := claims[claim].(string); name != "" {
+			if sub == "" || sub == name {
+				return name
+			}
+			return name + " (sub " + sub + ")"
+		}
+	}
+	if sub != "" {
+		return sub
+	}
+	return "unknown account (ID token has no sub claim)"
+}
+
+// decodeJWTClaims returns the payload of a JWT without verifying its
+// signature. The ID token came straight from the token endpoint over TLS, so
+// its claims are only reported, never used for authorization decisions.
+func decodeJWTClaims(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload encoding: %w", err)
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+	return claims, nil
+}
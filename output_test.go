@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-authgate/oauth-cli/tui"
+)
+
+func TestWriteLoginJSON(t *testing.T) {
+	origScope := cfg.Scope
+	t.Cleanup(func() { cfg.Scope = origScope })
+	cfg.Scope = "openid read write"
+
+	payload := base64.RawURLEncoding.EncodeToString(
+		[]byte(`{"sub":"user-1","email":"user@example.com"}`))
+	recordGrant(&tokenResponse{
+		AccessToken: "issued-access-token",
+		Scope:       "openid read",
+		IDToken:     "eyJhbGciOiJSUzI1NiJ9." + payload + ".sig",
+	})
+
+	expiresAt := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	if err := writeLoginJSON(&buf, &tui.TokenStorage{
+		AccessToken: "issued-access-token",
+		TokenType:   "Bearer",
+		ExpiresAt:   expiresAt,
+	}); err != nil {
+		t.Fatalf("writeLoginJSON() error = %v", err)
+	}
+
+	var got loginResult
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("output is not a single JSON document: %v\n%s", err, buf.String())
+	}
+	if got.ExpiresAt == nil || !got.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("ExpiresAt = %v, want %v", got.ExpiresAt, expiresAt)
+	}
+	if len(got.Scopes) != 2 || got.Scopes[1] != "read" {
+		t.Errorf("Scopes = %v, want granted scopes [openid read]", got.Scopes)
+	}
+	if got.IDClaims["sub"] != "user-1" {
+		t.Errorf("IDClaims = %v, want sub user-1", got.IDClaims)
+	}
+
+	// A stored token reused without a new grant reports the configured scopes.
+	buf.Reset()
+	if err := writeLoginJSON(&buf, &tui.TokenStorage{AccessToken: "stored-token"}); err != nil {
+		t.Fatalf("writeLoginJSON() error = %v", err)
+	}
+	got = loginResult{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if len(got.Scopes) != 3 || got.IDClaims != nil || got.ExpiresAt != nil {
+		t.Errorf("unexpected result for stored token: %+v", got)
+	}
+}
+
+func TestDecodeJWTClaims_Invalid(t *testing.T) {
+	for _, token := range []string{"opaque-token", "a.!!!.c", "a." +
+		base64.RawURLEncoding.EncodeToString([]byte("not json")) + ".c"} {
+		if _, err := decodeJWTClaims(token); err == nil {
+			t.Errorf("decodeJWTClaims(%q) expected error", token)
+		}
+	}
+}
+
+func TestTokenSubject(t *testing.T) {
+	grant := func(claims string) {
+		idToken := ""
+		if claims != "" {
+			idToken = "eyJhbGciOiJSUzI1NiJ9." +
+				base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".sig"
+		}
+		recordGrant(&tokenResponse{AccessToken: "issued", IDToken: idToken})
+	}
+	issued := &tui.TokenStorage{AccessToken: "issued"}
+
+	tests := []struct {
+		name   string
+		claims string
+		want   string
+	}{
+		{
+			"email and sub",
+			`{"sub":"user-1","email":"user@example.com"}`,
+			"user@example.com (sub user-1)",
+		},
+		{"username", `{"sub":"user-1","preferred_username":"alice"}`, "alice (sub user-1)"},
+		{"sub only", `{"sub":"user-1"}`, "user-1"},
+		{"no ID token", "", "unknown account (no ID token; request the openid scope)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grant(tt.claims)
+			if got := tokenSubject(issued); got != tt.want {
+				t.Errorf("tokenSubject() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	grant(`{"sub":"user-1"}`)
+	got := tokenSubject(&tui.TokenStorage{AccessToken: "other"})
+	if !strings.HasPrefix(got, "unknown account") {
+		t.Errorf("tokenSubject() for a token from another grant = %q, want unknown account", got)
+	}
+}
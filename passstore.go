@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/go-authgate/sdk-go/credstore"
+)
+
+// passStore stores each token as a GPG-encrypted entry in the standard unix
+// password store, through pass or the compatible gopass. Entries live at
+// <dir>/<server host>/<token key>, so each client ID (and audience) gets its
+// own entry, as in the token file's map. Token JSON is written on one line
+// and passed on stdin, never on the command line.
+type passStore struct {
+	bin string
+	dir string
+
+	// run executes bin with args and stdin and returns its stdout.
+	run func(stdin []byte, args ...string) ([]byte, error)
+}
+
+// newPassStore returns a store that runs bin ("pass" or "gopass") for tokens
+// issued by serverURL, under dir in the password store.
+func newPassStore(bin, dir, serverURL string) *passStore {
+	return &passStore{
+		bin: bin,
+		dir: path.Join(strings.Trim(dir, "/"), url.PathEscape(serverHost(serverURL))),
+		run: commandRunner(bin),
+	}
+}
+
+// entry returns the password store name for id. Audience keys contain
+// slashes, which pass would treat as directories, so the key is escaped.
+func (s *passStore) entry(id string) string {
+	return s.dir + "/" + url.PathEscape(id)
+}
+
+// isPassNotFound reports whether err is pass/gopass reporting a missing entry.
+func isPassNotFound(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "not in the password store")
+}
+
+func (s *passStore) Load(id string) (credstore.Token, error) {
+	var tok credstore.Token
+	out, err := s.run(nil, "show", s.entry(id))
+	if err != nil {
+		return tok, err
+	}
+	// pass show returns the entry as written; the token is its first line.
+	line, _, _ := strings.Cut(string(out), "\n")
+	if err := json.Unmarshal([]byte(line), &tok); err != nil {
+		return tok, fmt.Errorf("invalid token data in %s: %w", s.entry(id), err)
+	}
+	return tok, nil
+}
+
+func (s *passStore) Save(id string, tok credstore.Token) error {
+	data, err := json.Marshal(tok)
+	if err != nil {
+		return err
+	}
+	_, err = s.run(append(data, '\n'), "insert", "--multiline", "--force", s.entry(id))
+	return err
+}
+
+func (s *passStore) Delete(id string) error {
+	if _, err := s.run(nil, "rm", "--force", s.entry(id)); err != nil && !isPassNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *passStore) String() string {
+	return s.bin + ": " + s.dir
+}
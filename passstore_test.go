@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-authgate/sdk-go/credstore"
+)
+
+// fakePass emulates pass show/insert/rm on an in-memory password store.
+type fakePass struct {
+	t       *testing.T
+	entries map[string][]byte
+}
+
+func (f *fakePass) run(stdin []byte, args ...string) ([]byte, error) {
+	for _, arg := range args {
+		if strings.Contains(arg, "secret-access-token") {
+			f.t.Errorf("token passed on the pass command line: %v", args)
+		}
+	}
+	name := args[len(args)-1]
+	switch args[0] {
+	case "show":
+		data, ok := f.entries[name]
+		if !ok {
+			return nil, errors.New("pass show: Error: " + name + " is not in the password store.")
+		}
+		return data, nil
+	case "insert":
+		f.entries[name] = stdin
+		return nil, nil
+	case "rm":
+		if _, ok := f.entries[name]; !ok {
+			return nil, errors.New("pass rm: Error: " + name + " is not in the password store.")
+		}
+		delete(f.entries, name)
+		return nil, nil
+	}
+	return nil, errors.New("unexpected pass command")
+}
+
+func TestPassStore_SaveLoadDelete(t *testing.T) {
+	fake := &fakePass{t: t, entries: map[string][]byte{}}
+	store := newPassStore("pass", "/tokens/", "https://auth.example.com:8443")
+	store.run = fake.run
+
+	keys := []string{"cid", "cid#aud=api://orders"}
+	for _, key := range keys {
+		if err := store.Save(key, credstore.Token{AccessToken: "secret-access-token", ClientID: key}); err != nil {
+			t.Fatalf("Save(%q) error: %v", key, err)
+		}
+	}
+	for _, want := range []string{"tokens/auth.example.com:8443/cid", "tokens/auth.example.com:8443/cid%23aud=api:%2F%2Forders"} {
+		if _, ok := fake.entries[want]; !ok {
+			t.Errorf("missing entry %q; have %v", want, fake.entries)
+		}
+	}
+
+	for _, key := range keys {
+		tok, err := store.Load(key)
+		if err != nil || tok.ClientID != key {
+			t.Errorf("Load(%q) = %+v, %v", key, tok, err)
+		}
+	}
+
+	if err := store.Delete("cid"); err != nil {
+		t.Fatalf("Delete() error: %v", err)
+	}
+	if _, err := store.Load("cid"); err == nil {
+		t.Error("expected error loading a deleted token")
+	}
+	if err := store.Delete("cid"); err != nil {
+		t.Errorf("Delete() of a missing entry error = %v, want nil", err)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// pingTimeout bounds each individual health check.
+	pingTimeout = 5 * time.Second
+
+	// certExpiryWarning is how close to expiry a server certificate must be
+	// before ping reports it as a failure.
+	certExpiryWarning = 14 * 24 * time.Hour
+)
+
+// pingResult is the outcome of a single health check.
+type pingResult struct {
+	Name    string
+	Target  string
+	Status  int
+	Latency time.Duration
+	Detail  string
+	Err     error
+}
+
+// runPing implements `oauth-cli ping`: it probes the authorize endpoint,
+// token endpoint, JWKS document and TLS certificate of the configured server
+// and prints one line per check. It exits non-zero if any check fails.
+func runPing(ctx context.Context) int {
+	cfg.ClientIDOptional = true
+	initConfig()
+
+	fmt.Printf("PING %s\n", cfg.ServerURL)
+	results := pingServer(ctx)
+
+	failed := 0
+	for _, r := range results {
+		mark := "ok  "
+		if r.Err != nil {
+			mark = "FAIL"
+			failed++
+		}
+		status := "-"
+		if r.Status != 0 {
+			status = strconv.Itoa(r.Status)
+		}
+		detail := r.Detail
+		if r.Err != nil {
+			detail = r.Err.Error()
+		}
+		fmt.Printf("  %s %-10s %-32s %4s %8s  %s\n",
+			mark, r.Name, r.Target, status, r.Latency.Round(time.Millisecond), detail)
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d checks failed\n", failed, len(results))
+		return 1
+	}
+	return 0
+}
+
+// pingServer runs all health checks against cfg.ServerURL. Checks use the plain
+// HTTP client rather than the retry client so reported latencies reflect a
+// single round-trip.
+func pingServer(ctx context.Context) []pingResult {
+	authorize, tlsState := pingEndpoint(
+		ctx, "authorize", http.MethodHead, activeProvider.authorizePath, nil)
+	token, _ := pingEndpoint(
+		ctx, "token", http.MethodPost, activeProvider.tokenPath, url.Values{})
+	results := []pingResult{authorize, token}
+	if activeProvider.jwksPath != "" {
+		results = append(results, pingJWKS(ctx))
+	}
+
+	if strings.HasPrefix(strings.ToLower(cfg.ServerURL), "https://") {
+		results = append(results, checkCertExpiry(tlsState, clock.Now()))
+	}
+	if cfg.Discovery {
+		results = append(results, pingCapabilities(ctx)...)
+	}
+	return results
+}
+
+// pingCapabilities reports which optional endpoints the server's metadata
+// advertises. A missing endpoint is not a failure; the features using it are
+// disabled.
+func pingCapabilities(ctx context.Context) []pingResult {
+	start := time.Now()
+	meta, err := fetchServerMetadata(ctx)
+	latency := time.Since(start)
+	if err != nil {
+		return []pingResult{{Name: "metadata", Target: "GET /.well-known", Latency: latency, Err: err}}
+	}
+	var results []pingResult
+	for _, c := range serverCapabilities(meta) {
+		result := pingResult{Name: c.name, Target: "metadata", Detail: c.endpoint}
+		if c.endpoint == "" {
+			result.Detail = "not advertised"
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// pingEndpoint sends a single request to path and reports reachability.
+// Any response below 500 counts as reachable: the probes carry no valid
+// parameters, so 4xx answers are expected from a healthy server.
+func pingEndpoint(
+	ctx context.Context,
+	name, method, path string,
+	form url.Values,
+) (pingResult, *tls.ConnectionState) {
+	result := pingResult{Name: name, Target: method + " " + path}
+
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpointURL(path), body)
+	if err != nil {
+		result.Err = fmt.Errorf("failed to create request: %w", err)
+		return result, nil
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	start := time.Now()
+	resp, err := cfg.HTTPClient.Do(req)
+	result.Latency = time.Since(start)
+	if err != nil {
+		result.Err = fmt.Errorf("unreachable: %w", err)
+		return result, nil
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseSize))
+
+	result.Status = resp.StatusCode
+	if resp.StatusCode >= http.StatusInternalServerError {
+		result.Err = fmt.Errorf("server error: %s", resp.Status)
+		return result, resp.TLS
+	}
+	result.Detail = "reachable"
+	return result, resp.TLS
+}
+
+// pingJWKS fetches the JWKS document and checks that it contains at least one key.
+func pingJWKS(ctx context.Context) pingResult {
+	result := pingResult{Name: "jwks", Target: http.MethodGet + " " + activeProvider.jwksPath}
+
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpointURL(activeProvider.jwksPath), nil)
+	if err != nil {
+		result.Err = fmt.Errorf("failed to create request: %w", err)
+		return result
+	}
+
+	start := time.Now()
+	resp, err := cfg.HTTPClient.Do(req)
+	result.Latency = time.Since(start)
+	if err != nil {
+		result.Err = fmt.Errorf("unreachable: %w", err)
+		return result
+	}
+	defer resp.Body.Close()
+
+	result.Status = resp.StatusCode
+	body, err := readResponseBody(resp.Body)
+	if err != nil {
+		result.Err = fmt.Errorf("failed to read response: %w", err)
+		return result
+	}
+	if resp.StatusCode != http.StatusOK {
+		result.Err = fmt.Errorf("unexpected status: %s", resp.Status)
+		return result
+	}
+
+	var jwks struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &jwks); err != nil {
+		result.Err = fmt.Errorf("invalid JWKS document: %w", err)
+		return result
+	}
+	if len(jwks.Keys) == 0 {
+		result.Err = errors.New("JWKS document contains no keys")
+		return result
+	}
+	result.Detail = fmt.Sprintf("%d key(s)", len(jwks.Keys))
+	return result
+}
+
+// checkCertExpiry reports the expiry of the server's leaf certificate and
+// fails when it is already expired or expires within certExpiryWarning.
+func checkCertExpiry(state *tls.ConnectionState, now time.Time) pingResult {
+	result := pingResult{Name: "tls", Target: "certificate"}
+	if state == nil || len(state.PeerCertificates) == 0 {
+		result.Err = errors.New("no TLS certificate observed")
+		return result
+	}
+
+	notAfter := state.PeerCertificates[0].NotAfter
+	remaining := notAfter.Sub(now)
+	days := int(remaining.Hours() / 24)
+	switch {
+	case remaining <= 0:
+		result.Err = fmt.Errorf("certificate expired on %s", notAfter.Format(time.DateOnly))
+	case remaining < certExpiryWarning:
+		result.Err = fmt.Errorf("certificate expires on %s (%d days)",
+			notAfter.Format(time.DateOnly), days)
+	default:
+		result.Detail = fmt.Sprintf("expires %s (%d days)", notAfter.Format(time.DateOnly), days)
+	}
+	return result
+}
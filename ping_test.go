@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newPingTestServer(t *testing.T, jwks string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/authorize", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	})
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_request"}`))
+	})
+	mux.HandleFunc(activeProvider.jwksPath, func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(jwks))
+	})
+	return httptest.NewServer(mux)
+}
+
+func setPingTarget(t *testing.T, srv *httptest.Server) {
+	t.Helper()
+	origServerURL, origHTTPClient := cfg.ServerURL, cfg.HTTPClient
+	t.Cleanup(func() {
+		cfg.ServerURL, cfg.HTTPClient = origServerURL, origHTTPClient
+	})
+	cfg.ServerURL = srv.URL
+	cfg.HTTPClient = srv.Client()
+}
+
+func TestPingServer_Healthy(t *testing.T) {
+	srv := newPingTestServer(t, `{"keys":[{"kty":"RSA"},{"kty":"EC"}]}`)
+	defer srv.Close()
+	setPingTarget(t, srv)
+
+	results := pingServer(context.Background())
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results for plain HTTP server, got %d", len(results))
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			t.Errorf("%s: unexpected error: %v", r.Name, r.Err)
+		}
+	}
+	if results[2].Detail != "2 key(s)" {
+		t.Errorf("jwks detail = %q, want %q", results[2].Detail, "2 key(s)")
+	}
+}
+
+func TestPingServer_Failures(t *testing.T) {
+	tests := []struct {
+		name string
+		jwks string
+		want string
+	}{
+		{"empty key set", `{"keys":[]}`, "no keys"},
+		{"invalid json", `not-json`, "invalid JWKS"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newPingTestServer(t, tc.jwks)
+			defer srv.Close()
+			setPingTarget(t, srv)
+
+			r := pingJWKS(context.Background())
+			if r.Err == nil || !strings.Contains(r.Err.Error(), tc.want) {
+				t.Errorf("pingJWKS() error = %v, want containing %q", r.Err, tc.want)
+			}
+		})
+	}
+
+	t.Run("server error", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer srv.Close()
+		setPingTarget(t, srv)
+
+		r, _ := pingEndpoint(context.Background(), "authorize", http.MethodHead, "/oauth/authorize", nil)
+		if r.Err == nil || r.Status != http.StatusBadGateway {
+			t.Errorf("expected 502 failure, got status %d err %v", r.Status, r.Err)
+		}
+	})
+}
+
+func TestPingServer_TLSCertificate(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"keys":[{"kty":"RSA"}]}`))
+	}))
+	defer srv.Close()
+	setPingTarget(t, srv)
+
+	results := pingServer(context.Background())
+	if len(results) != 4 {
+		t.Fatalf("expected 4 results for HTTPS server, got %d", len(results))
+	}
+	if tlsResult := results[3]; tlsResult.Name != "tls" || tlsResult.Err != nil {
+		t.Errorf("unexpected tls result: %+v", tlsResult)
+	}
+}
+
+func TestPingServer_TLSCertificateUsesClock(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"keys":[{"kty":"RSA"}]}`))
+	}))
+	defer srv.Close()
+	setPingTarget(t, srv)
+	setFakeClock(t, srv.Certificate().NotAfter.Add(-24*time.Hour))
+
+	results := pingServer(context.Background())
+	if tlsResult := results[len(results)-1]; tlsResult.Name != "tls" || tlsResult.Err == nil {
+		t.Errorf("tls result a day before the certificate expires on the clock: %+v", tlsResult)
+	}
+}
+
+func TestCheckCertExpiry(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	state := func(notAfter time.Time) *tls.ConnectionState {
+		return &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{{NotAfter: notAfter}},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		state   *tls.ConnectionState
+		wantErr bool
+	}{
+		{"valid", state(now.Add(90 * 24 * time.Hour)), false},
+		{"expiring soon", state(now.Add(3 * 24 * time.Hour)), true},
+		{"expired", state(now.Add(-time.Hour)), true},
+		{"no certificate", nil, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := checkCertExpiry(tc.state, now)
+			if (r.Err != nil) != tc.wantErr {
+				t.Errorf("checkCertExpiry() error = %v, wantErr %v", r.Err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestPingServer_Capabilities(t *testing.T) {
+	srv := newPingTestServer(t, `{"keys":[{"kty":"RSA"}]}`)
+	defer srv.Close()
+	setPingTarget(t, srv)
+	setTestServer(t, srv)
+
+	mux := srv.Config.Handler.(*http.ServeMux)
+	mux.HandleFunc("/.well-known/oauth-authorization-server", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"issuer":"https://issuer",` +
+			`"revocation_endpoint":"https://issuer/revoke"}`))
+	})
+	origDiscovery, origDir := cfg.Discovery, cfg.DiscoveryCacheDir
+	t.Cleanup(func() { cfg.Discovery, cfg.DiscoveryCacheDir = origDiscovery, origDir })
+	cfg.Discovery, cfg.DiscoveryCacheDir = true, ""
+
+	details := map[string]string{}
+	for _, r := range pingServer(context.Background()) {
+		if r.Err != nil {
+			t.Errorf("%s: unexpected error: %v", r.Name, r.Err)
+		}
+		details[r.Name] = r.Detail
+	}
+	if details["revocation"] != "https://issuer/revoke" || details["device"] != "not advertised" {
+		t.Errorf("capability details = %v", details)
+	}
+}
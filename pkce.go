@@ -5,33 +5,102 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
+	"slices"
 
 	"github.com/go-authgate/oauth-cli/tui"
 )
 
+// PKCE code_challenge_method values accepted by -pkce-method. pkceMethodNone
+// disables PKCE entirely for servers that reject unknown parameters.
+const (
+	pkceMethodS256  = "S256"
+	pkceMethodPlain = "plain"
+	pkceMethodNone  = "none"
+)
+
+// Bounds for the number of random bytes in a code_verifier. 32 bytes encode
+// to the RFC 7636 minimum of 43 characters; 96 bytes encode to the maximum
+// of 128 characters.
+const (
+	MinPKCEVerifierBytes     = 32
+	MaxPKCEVerifierBytes     = 96
+	DefaultPKCEVerifierBytes = MinPKCEVerifierBytes
+)
+
 // GeneratePKCE generates a cryptographically random code_verifier and computes
 // the S256 code_challenge as defined in RFC 7636 §4.1 and §4.2.
 //
 // The verifier is a 32-byte random value base64url-encoded (43 chars, no padding).
 // The challenge is BASE64URL(SHA256(ASCII(verifier))).
 func GeneratePKCE() (*tui.PKCEParams, error) {
-	b := make([]byte, 32)
+	return generatePKCE(pkceMethodS256, DefaultPKCEVerifierBytes)
+}
+
+// GeneratePKCEWithLength is like GeneratePKCE but draws verifierBytes random
+// bytes for the verifier, which must be within [MinPKCEVerifierBytes,
+// MaxPKCEVerifierBytes]. Use MaxPKCEVerifierBytes for a 128-character verifier.
+func GeneratePKCEWithLength(verifierBytes int) (*tui.PKCEParams, error) {
+	return generatePKCE(pkceMethodS256, verifierBytes)
+}
+
+// validatePKCEVerifierBytes reports whether n is an allowed verifier length.
+func validatePKCEVerifierBytes(n int) error {
+	if n < MinPKCEVerifierBytes || n > MaxPKCEVerifierBytes {
+		return fmt.Errorf("PKCE verifier length must be between %d and %d bytes, got: %d",
+			MinPKCEVerifierBytes, MaxPKCEVerifierBytes, n)
+	}
+	return nil
+}
+
+// generatePKCE generates PKCE parameters for the given code_challenge_method
+// using a verifier of verifierBytes random bytes. For "plain" the challenge
+// equals the verifier (RFC 7636 §4.2); for "none" the returned params carry no
+// verifier or challenge and PKCE is omitted from the authorization and token
+// requests.
+func generatePKCE(method string, verifierBytes int) (*tui.PKCEParams, error) {
+	if method == pkceMethodNone {
+		return &tui.PKCEParams{Method: pkceMethodNone}, nil
+	}
+	if err := validatePKCEVerifierBytes(verifierBytes); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, verifierBytes)
 	if _, err := rand.Read(b); err != nil {
 		return nil, fmt.Errorf("failed to generate random bytes: %w", err)
 	}
 
 	verifier := base64.RawURLEncoding.EncodeToString(b)
 
-	sum := sha256.Sum256([]byte(verifier))
-	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	var challenge string
+	switch method {
+	case pkceMethodS256:
+		sum := sha256.Sum256([]byte(verifier))
+		challenge = base64.RawURLEncoding.EncodeToString(sum[:])
+	case pkceMethodPlain:
+		challenge = verifier
+	default:
+		return nil, fmt.Errorf("unsupported PKCE method: %s", method)
+	}
 
 	return &tui.PKCEParams{
 		Verifier:  verifier,
 		Challenge: challenge,
-		Method:    "S256",
+		Method:    method,
 	}, nil
 }
 
+// selectPKCEMethod picks the strongest PKCE method the server advertises in
+// code_challenge_methods_supported: S256, then plain. When the field is
+// missing or lists no method the CLI knows, S256 is used; PKCE is never
+// turned off by discovery.
+func selectPKCEMethod(supported []string) string {
+	if !slices.Contains(supported, pkceMethodS256) && slices.Contains(supported, pkceMethodPlain) {
+		return pkceMethodPlain
+	}
+	return pkceMethodS256
+}
+
 // generateState generates a cryptographically random state value for CSRF protection.
 // Returns a 16-byte base64url-encoded string.
 func generateState() (string, error) {
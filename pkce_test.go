@@ -120,3 +120,86 @@ func TestGenerateState_Uniqueness(t *testing.T) {
 		seen[s] = true
 	}
 }
+
+func TestGeneratePKCE_Methods(t *testing.T) {
+	t.Run("plain", func(t *testing.T) {
+		p, err := generatePKCE(pkceMethodPlain, DefaultPKCEVerifierBytes)
+		if err != nil {
+			t.Fatalf("generatePKCE(plain) error: %v", err)
+		}
+		if p.Method != "plain" || p.Challenge != p.Verifier {
+			t.Errorf("plain challenge must equal verifier, got %+v", p)
+		}
+	})
+
+	t.Run("none", func(t *testing.T) {
+		p, err := generatePKCE(pkceMethodNone, DefaultPKCEVerifierBytes)
+		if err != nil {
+			t.Fatalf("generatePKCE(none) error: %v", err)
+		}
+		if p.Verifier != "" || p.Challenge != "" {
+			t.Errorf("none must not produce verifier or challenge, got %+v", p)
+		}
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		if _, err := generatePKCE("S512", DefaultPKCEVerifierBytes); err == nil {
+			t.Error("expected error for unsupported method")
+		}
+	})
+}
+
+func TestSelectPKCEMethod(t *testing.T) {
+	tests := []struct {
+		name      string
+		supported []string
+		want      string
+	}{
+		{"not advertised", nil, "S256"},
+		{"S256 and plain", []string{"plain", "S256"}, "S256"},
+		{"plain only", []string{"plain"}, "plain"},
+		{"unknown only", []string{"S512"}, "S256"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := selectPKCEMethod(tc.supported); got != tc.want {
+				t.Errorf("selectPKCEMethod(%v) = %q, want %q", tc.supported, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGeneratePKCEWithLength(t *testing.T) {
+	tests := []struct {
+		name    string
+		bytes   int
+		wantLen int
+		wantErr bool
+	}{
+		{"minimum", MinPKCEVerifierBytes, 43, false},
+		{"intermediate", 64, 86, false},
+		{"maximum", MaxPKCEVerifierBytes, 128, false},
+		{"too short", MinPKCEVerifierBytes - 1, 0, true},
+		{"too long", MaxPKCEVerifierBytes + 1, 0, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := GeneratePKCEWithLength(tc.bytes)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("GeneratePKCEWithLength(%d) error = %v, wantErr %v", tc.bytes, err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if len(p.Verifier) != tc.wantLen {
+				t.Errorf("verifier length = %d, want %d", len(p.Verifier), tc.wantLen)
+			}
+			sum := sha256.Sum256([]byte(p.Verifier))
+			if p.Challenge != base64.RawURLEncoding.EncodeToString(sum[:]) {
+				t.Error("challenge does not match S256 of verifier")
+			}
+		})
+	}
+}
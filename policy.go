@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// policyPath is the admin-managed policy file. It lives outside the user's
+// reach (root- or administrator-owned), and there is deliberately no flag or
+// environment variable to point elsewhere, so a policy cannot be bypassed.
+var policyPath = defaultPolicyPath()
+
+func defaultPolicyPath() string {
+	if runtime.GOOS == "windows" {
+		dir := os.Getenv("ProgramData")
+		if dir == "" {
+			dir = `C:\ProgramData`
+		}
+		return filepath.Join(dir, "authgate", "policy.json")
+	}
+	return "/etc/authgate/policy.json"
+}
+
+// policy restricts what the CLI may be configured to do. Empty lists and
+// false values impose no restriction.
+type policy struct {
+	// AllowedServers are the server (issuer) URLs the CLI may talk to. A
+	// server matches an entry with the same scheme and host whose path is a
+	// prefix of its own; unix:// servers must match exactly. Absolute
+	// endpoint overrides, endpoints advertised through -discovery and
+	// -token-fallback-urls are checked too.
+	AllowedServers []string `json:"allowed_servers"`
+
+	// AllowedScopes is the most that may be requested; asking for any other
+	// scope is refused.
+	AllowedScopes []string `json:"allowed_scopes"`
+
+	// RequireHTTPS refuses plain http:// servers and endpoints.
+	RequireHTTPS bool `json:"require_https"`
+
+	// RequirePKCES256 refuses -pkce-method=plain and none.
+	RequirePKCES256 bool `json:"require_pkce_s256"`
+}
+
+// policyTarget is the configuration a policy is checked against.
+type policyTarget struct {
+	server     string // cfg.ServerURL, or unix:///path for socket servers
+	endpoints  []string
+	scopes     []string
+	pkceMethod string // "" when not yet resolved
+}
+
+// loadPolicy reads the policy at path. A missing file means no policy; an
+// unreadable or malformed one is an error, so a broken policy fails closed.
+func loadPolicy(path string) (*policy, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy %s: %w", path, err)
+	}
+	var p policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %w", path, err)
+	}
+	return &p, nil
+}
+
+// check returns an error naming the first way target violates p.
+func (p *policy) check(target policyTarget) error {
+	if p == nil {
+		return nil
+	}
+	for _, u := range append([]string{target.server}, target.endpoints...) {
+		if p.RequireHTTPS && strings.HasPrefix(strings.ToLower(u), "http://") {
+			return fmt.Errorf("%s does not use HTTPS", u)
+		}
+		if len(p.AllowedServers) > 0 && !slices.ContainsFunc(p.AllowedServers, func(a string) bool {
+			return serverAllowed(a, u)
+		}) {
+			return fmt.Errorf("server %s is not in allowed_servers", u)
+		}
+	}
+	if len(p.AllowedScopes) > 0 {
+		for _, s := range target.scopes {
+			if !slices.Contains(p.AllowedScopes, s) {
+				return fmt.Errorf("scope %q is not in allowed_scopes", s)
+			}
+		}
+	}
+	if p.RequirePKCES256 && target.pkceMethod != "" && target.pkceMethod != pkceMethodS256 {
+		return fmt.Errorf("PKCE method %s is not allowed (require_pkce_s256)", target.pkceMethod)
+	}
+	return nil
+}
+
+// serverAllowed reports whether target is covered by the allowed URL.
+func serverAllowed(allowed, target string) bool {
+	if strings.HasPrefix(allowed, "unix:") || strings.HasPrefix(target, "unix:") {
+		return allowed == target
+	}
+	a, err := url.Parse(allowed)
+	if err != nil {
+		return false
+	}
+	t, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+	if !strings.EqualFold(a.Scheme, t.Scheme) || !strings.EqualFold(a.Host, t.Host) {
+		return false
+	}
+	prefix := strings.TrimSuffix(a.Path, "/")
+	return prefix == "" || t.Path == prefix || strings.HasPrefix(t.Path, prefix+"/")
+}
+
+// currentPolicyTarget describes the active configuration for a policy check.
+func currentPolicyTarget(pkceMethod string) policyTarget {
+	target := policyTarget{
+		server:     cfg.ServerURL,
+		scopes:     splitScopes(cfg.Scope),
+		pkceMethod: pkceMethod,
+	}
+	if cfg.ServerSocket != "" {
+		target.server = "unix://" + cfg.ServerSocket
+	}
+	for _, path := range []string{
+		activeProvider.authorizePath,
+		activeProvider.tokenPath,
+		activeProvider.tokenInfoPath,
+		activeProvider.revokePath,
+		activeProvider.userinfoPath,
+	} {
+		if isEndpointURL(path) {
+			target.endpoints = append(target.endpoints, path)
+		}
+	}
+	target.endpoints = append(target.endpoints, cfg.TokenFallbackURLs...)
+	return target
+}
+
+// enforcePolicy exits when the configuration violates the policy file.
+func enforcePolicy(pkceMethod string) {
+	p, err := loadPolicy(policyPath)
+	if err == nil {
+		err = p.check(currentPolicyTarget(pkceMethod))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: blocked by policy %s: %v\n", policyPath, err)
+		os.Exit(1)
+	}
+}
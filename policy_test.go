@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	p := &policy{
+		AllowedServers:  []string{"https://auth.example.com", "https://login.example.net/contoso/"},
+		AllowedScopes:   []string{"openid", "read"},
+		RequireHTTPS:    true,
+		RequirePKCES256: true,
+	}
+	tests := []struct {
+		name    string
+		target  policyTarget
+		wantErr bool
+	}{
+		{"allowed", policyTarget{server: "https://auth.example.com", scopes: []string{"read"}}, false},
+		{"path prefix", policyTarget{server: "https://login.example.net/contoso/v2"}, false},
+		{"other tenant", policyTarget{server: "https://login.example.net/contosoevil"}, true},
+		{"rogue server", policyTarget{server: "https://auth.example.com.evil.io"}, true},
+		{"plain http", policyTarget{server: "http://auth.example.com"}, true},
+		{"rogue fallback", policyTarget{
+			server:    "https://auth.example.com",
+			endpoints: []string{"https://replica.evil.io/token"},
+		}, true},
+		{"extra scope", policyTarget{
+			server: "https://auth.example.com",
+			scopes: []string{"admin"},
+		}, true},
+		{"pkce plain", policyTarget{server: "https://auth.example.com", pkceMethod: "plain"}, true},
+		{"pkce unresolved", policyTarget{server: "https://auth.example.com"}, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := p.check(tc.target); (err != nil) != tc.wantErr {
+				t.Errorf("check() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+
+	var none *policy
+	if err := none.check(policyTarget{server: "http://anything"}); err != nil {
+		t.Errorf("nil policy check() error = %v", err)
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	dir := t.TempDir()
+	if p, err := loadPolicy(filepath.Join(dir, "missing.json")); p != nil || err != nil {
+		t.Errorf("missing policy = %v, %v; want nil, nil", p, err)
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(bad, []byte("allowed_servers: [x]"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadPolicy(bad); err == nil {
+		t.Error("malformed policy must fail closed")
+	}
+}
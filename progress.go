@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/go-authgate/oauth-cli/tui"
+)
+
+// Values accepted by -progress.
+const (
+	progressTUI  = "tui"
+	progressJSON = "json"
+)
+
+// Events written by -progress=json, in the order a login produces them.
+const (
+	eventWarning           = "warning"
+	eventFlowStarted       = "flow_started"
+	eventBrowserOpened     = "browser_opened"
+	eventCallbackReceived  = "callback_received"
+	eventExchangeSucceeded = "exchange_succeeded"
+	eventExchangeFailed    = "exchange_failed"
+	eventTokenSaved        = "token_saved"
+	eventFlowFinished      = "flow_finished"
+)
+
+// progressEvent is one line of the -progress=json stream. It never carries
+// token values.
+type progressEvent struct {
+	Time     time.Time `json:"time"`
+	Event    string    `json:"event"`
+	Message  string    `json:"message,omitempty"`
+	AuthURL  string    `json:"auth_url,omitempty"`
+	Store    string    `json:"store,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	ExitCode *int      `json:"exit_code,omitempty"`
+}
+
+// progressWriter writes login progress as newline-delimited JSON, so GUI
+// wrappers and editor plugins can follow the flow without parsing the TUI.
+type progressWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newProgressWriter(w io.Writer) *progressWriter {
+	return &progressWriter{enc: json.NewEncoder(w)}
+}
+
+// emit writes ev stamped with the current time. Safe to call on a nil writer.
+func (p *progressWriter) emit(ev progressEvent) {
+	if p == nil {
+		return
+	}
+	ev.Time = time.Now().UTC()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_ = p.enc.Encode(ev)
+}
+
+// errorString returns err's message, or "" for nil.
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// instrument wraps the flow callbacks in deps to emit progress events.
+func (p *progressWriter) instrument(deps *tui.Deps) {
+	buildAuthURL := deps.BuildAuthURL
+	deps.BuildAuthURL = func(state string, pkce *tui.PKCEParams) string {
+		authURL := buildAuthURL(state, pkce)
+		p.emit(progressEvent{Event: eventFlowStarted, AuthURL: authURL})
+		return authURL
+	}
+
+	openBrowser := deps.OpenBrowser
+	deps.OpenBrowser = func(ctx context.Context, url string) error {
+		err := openBrowser(ctx, url)
+		p.emit(progressEvent{Event: eventBrowserOpened, Error: errorString(err)})
+		return err
+	}
+
+	exchangeCode := deps.ExchangeCode
+	deps.ExchangeCode = func(ctx context.Context, code, verifier string) (*tui.TokenStorage, error) {
+		p.emit(progressEvent{Event: eventCallbackReceived})
+		storage, err := exchangeCode(ctx, code, verifier)
+		if err != nil {
+			p.emit(progressEvent{Event: eventExchangeFailed, Error: err.Error()})
+			return nil, err
+		}
+		p.emit(progressEvent{Event: eventExchangeSucceeded})
+		return storage, nil
+	}
+
+	saveTokens := deps.SaveTokens
+	deps.SaveTokens = func(storage *tui.TokenStorage) error {
+		err := saveTokens(storage)
+		p.emit(progressEvent{
+			Event: eventTokenSaved,
+			Store: cfg.TokenStoreMode,
+			Error: errorString(err),
+		})
+		return err
+	}
+}
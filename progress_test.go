@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-authgate/oauth-cli/tui"
+)
+
+func TestProgressWriter_Instrument(t *testing.T) {
+	origMode := cfg.TokenStoreMode
+	t.Cleanup(func() { cfg.TokenStoreMode = origMode })
+	cfg.TokenStoreMode = "memory"
+
+	var buf bytes.Buffer
+	p := newProgressWriter(&buf)
+	deps := tui.Deps{
+		BuildAuthURL: func(string, *tui.PKCEParams) string {
+			return "https://auth.example.com/authorize"
+		},
+		OpenBrowser: func(context.Context, string) error { return errors.New("no browser") },
+		ExchangeCode: func(_ context.Context, code, _ string) (*tui.TokenStorage, error) {
+			if code == "bad" {
+				return nil, errors.New("invalid_grant")
+			}
+			return &tui.TokenStorage{AccessToken: "secret-access-token"}, nil
+		},
+		SaveTokens: func(*tui.TokenStorage) error { return nil },
+	}
+	p.instrument(&deps)
+
+	deps.BuildAuthURL("state", nil)
+	_ = deps.OpenBrowser(context.Background(), "https://auth.example.com/authorize")
+	_, _ = deps.ExchangeCode(context.Background(), "bad", "verifier")
+	storage, _ := deps.ExchangeCode(context.Background(), "code", "verifier")
+	_ = deps.SaveTokens(storage)
+	code := 0
+	p.emit(progressEvent{Event: eventFlowFinished, ExitCode: &code})
+
+	if strings.Contains(buf.String(), "secret-access-token") {
+		t.Fatalf("progress stream leaks the access token:\n%s", buf.String())
+	}
+
+	var got []progressEvent
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var ev progressEvent
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			t.Fatalf("line is not JSON: %v\n%s", err, sc.Text())
+		}
+		got = append(got, ev)
+	}
+
+	want := []string{
+		eventFlowStarted, eventBrowserOpened,
+		eventCallbackReceived, eventExchangeFailed,
+		eventCallbackReceived, eventExchangeSucceeded,
+		eventTokenSaved, eventFlowFinished,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d events, want %d:\n%s", len(got), len(want), buf.String())
+	}
+	for i, ev := range got {
+		if ev.Event != want[i] {
+			t.Errorf("event %d = %q, want %q", i, ev.Event, want[i])
+		}
+		if ev.Time.IsZero() {
+			t.Errorf("event %d has no time", i)
+		}
+	}
+	if got[0].AuthURL != "https://auth.example.com/authorize" {
+		t.Errorf("flow_started auth_url = %q", got[0].AuthURL)
+	}
+	if got[1].Error != "no browser" || got[3].Error != "invalid_grant" {
+		t.Errorf("errors not reported: %+v, %+v", got[1], got[3])
+	}
+	if got[6].Store != "memory" || got[6].Error != "" {
+		t.Errorf("token_saved = %+v, want store memory and no error", got[6])
+	}
+	if got[7].ExitCode == nil || *got[7].ExitCode != 0 {
+		t.Errorf("flow_finished exit_code = %v, want 0", got[7].ExitCode)
+	}
+}
+
+func TestProgressWriter_Nil(t *testing.T) {
+	var p *progressWriter
+	p.emit(progressEvent{Event: eventFlowStarted}) // must not panic
+}
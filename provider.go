@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// providerPreset describes the endpoint layout and quirks of a server type.
+// Paths are relative to cfg.ServerURL; "{tenant}" is replaced with the
+// configured tenant. An empty path means the server has no such endpoint. A
+// path may also be an absolute URL (set with -token-path and friends), which
+// endpointURL uses as is.
+type providerPreset struct {
+	authorizePath string
+	tokenPath     string
+	tokenInfoPath string
+	revokePath    string
+	jwksPath      string
+	userinfoPath  string // only set from discovery metadata
+
+	defaultServerURL string
+	defaultScope     string
+
+	// audienceAsScope requests tokens for an audience through the
+	// "<audience>/.default" scope instead of audience/resource parameters.
+	audienceAsScope bool
+}
+
+const defaultProvider = "authgate"
+
+var providerPresets = map[string]providerPreset{
+	"authgate": {
+		authorizePath:    "/oauth/authorize",
+		tokenPath:        "/oauth/token",
+		tokenInfoPath:    "/oauth/tokeninfo",
+		revokePath:       "/oauth/revoke",
+		jwksPath:         "/.well-known/jwks.json",
+		defaultServerURL: "http://localhost:8080",
+		defaultScope:     "read write",
+	},
+	// Microsoft Entra ID (Azure AD) v2.0 endpoints. There is no token
+	// introspection or revocation endpoint, and client IDs are app IDs
+	// rather than AuthGate UUIDs.
+	"azure": {
+		authorizePath:    "/{tenant}/oauth2/v2.0/authorize",
+		tokenPath:        "/{tenant}/oauth2/v2.0/token",
+		jwksPath:         "/{tenant}/discovery/v2.0/keys",
+		defaultServerURL: "https://login.microsoftonline.com",
+		defaultScope:     "openid profile offline_access",
+		audienceAsScope:  true,
+	},
+	// GitHub OAuth apps. Token responses are form-encoded unless JSON is
+	// requested and carry no expires_in; there is no JWKS, introspection or
+	// standard revocation endpoint.
+	"github": {
+		authorizePath:    "/login/oauth/authorize",
+		tokenPath:        "/login/oauth/access_token",
+		defaultServerURL: "https://github.com",
+		defaultScope:     "read:user",
+	},
+}
+
+// activeProvider is the preset selected by -provider, with the tenant applied.
+var activeProvider = providerPresets[defaultProvider]
+
+// providerNames returns the sorted preset names for help and error messages.
+func providerNames() string {
+	names := make([]string, 0, len(providerPresets))
+	for name := range providerPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// resolveProvider returns the named preset with "{tenant}" substituted.
+func resolveProvider(name, tenant string) (providerPreset, error) {
+	p, ok := providerPresets[name]
+	if !ok {
+		return providerPreset{}, fmt.Errorf(
+			"invalid provider value: %s (must be one of: %s)", name, providerNames())
+	}
+	replace := func(path string) string {
+		return strings.ReplaceAll(path, "{tenant}", tenant)
+	}
+	p.authorizePath = replace(p.authorizePath)
+	p.tokenPath = replace(p.tokenPath)
+	p.tokenInfoPath = replace(p.tokenInfoPath)
+	p.revokePath = replace(p.revokePath)
+	p.jwksPath = replace(p.jwksPath)
+	return p, nil
+}
+
+// overrideEndpoint validates a -authorize-path, -token-path or -tokeninfo-path
+// value: a path on cfg.ServerURL such as "/connect/token", or an absolute
+// http(s) URL for an endpoint on another host.
+func overrideEndpoint(name, value string) (string, error) {
+	if strings.HasPrefix(value, "/") {
+		return value, nil
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf(
+			"invalid %s value: %s (must be a path starting with / or an http(s) URL)", name, value)
+	}
+	return value, nil
+}
+
+// isEndpointURL reports whether an endpoint path is an absolute URL.
+func isEndpointURL(path string) bool {
+	return strings.HasPrefix(path, "https://") || strings.HasPrefix(path, "http://")
+}
+
+// endpointURL returns the URL of an endpoint path of activeProvider.
+func endpointURL(path string) string {
+	if isEndpointURL(path) {
+		return path
+	}
+	return cfg.ServerURL + path
+}
+
+// defaultScopeFor builds the .default scope Azure AD v2 expects for an
+// audience (e.g. "api://my-api/.default"), keeping any OpenID scopes.
+func defaultScopeFor(scopes, audience string) string {
+	return withScope(scopes, strings.TrimSuffix(audience, "/")+"/.default")
+}
+
+// flexInt decodes a JSON number that some servers (Azure AD v1, older ADFS)
+// send as a string, e.g. "expires_in": "3599".
+type flexInt int
+
+func (f *flexInt) UnmarshalJSON(b []byte) error {
+	b = bytes.Trim(b, `"`)
+	if len(b) == 0 || string(b) == "null" {
+		*f = 0
+		return nil
+	}
+	n, err := strconv.Atoi(string(b))
+	if err != nil {
+		return fmt.Errorf("invalid integer %q: %w", b, err)
+	}
+	*f = flexInt(n)
+	return nil
+}
+
+var _ json.Unmarshaler = (*flexInt)(nil)
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+)
+
+func TestResolveProvider(t *testing.T) {
+	p, err := resolveProvider("azure", "contoso.onmicrosoft.com")
+	if err != nil {
+		t.Fatalf("resolveProvider() error = %v", err)
+	}
+	if want := "/contoso.onmicrosoft.com/oauth2/v2.0/token"; p.tokenPath != want {
+		t.Errorf("tokenPath = %q, want %q", p.tokenPath, want)
+	}
+	if p.tokenInfoPath != "" || p.revokePath != "" {
+		t.Errorf("azure preset should have no tokeninfo/revoke endpoints: %+v", p)
+	}
+
+	if _, err := resolveProvider("okta", "common"); err == nil {
+		t.Error("expected error for unknown provider")
+	}
+}
+
+func TestOverrideEndpoint(t *testing.T) {
+	origServer := cfg.ServerURL
+	t.Cleanup(func() { cfg.ServerURL = origServer })
+	cfg.ServerURL = "https://auth.example.com"
+
+	tests := []struct {
+		value   string
+		wantURL string
+		wantErr bool
+	}{
+		{"/connect/token", "https://auth.example.com/connect/token", false},
+		{"https://sts.example.net/token", "https://sts.example.net/token", false},
+		{"connect/token", "", true},
+		{"ftp://sts.example.net/token", "", true},
+		{"https:///token", "", true},
+	}
+	for _, tc := range tests {
+		path, err := overrideEndpoint("token-path", tc.value)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("overrideEndpoint(%q) error = %v, wantErr %v", tc.value, err, tc.wantErr)
+			continue
+		}
+		if err == nil && endpointURL(path) != tc.wantURL {
+			t.Errorf("endpointURL(%q) = %q, want %q", path, endpointURL(path), tc.wantURL)
+		}
+	}
+}
+
+func TestDefaultScopeFor(t *testing.T) {
+	tests := []struct {
+		scopes, audience, want string
+	}{
+		{"openid profile", "api://my-api", "openid profile api://my-api/.default"},
+		{"openid", "https://graph.microsoft.com/", "openid https://graph.microsoft.com/.default"},
+		{"api://my-api/.default", "api://my-api", "api://my-api/.default"},
+	}
+	for _, tc := range tests {
+		if got := defaultScopeFor(tc.scopes, tc.audience); got != tc.want {
+			t.Errorf("defaultScopeFor(%q, %q) = %q, want %q", tc.scopes, tc.audience, got, tc.want)
+		}
+	}
+}
+
+func TestSetAudienceParams_AudienceAsScope(t *testing.T) {
+	origProvider, origAudience := activeProvider, cfg.Audience
+	t.Cleanup(func() { activeProvider, cfg.Audience = origProvider, origAudience })
+
+	activeProvider = providerPresets["azure"]
+	cfg.Audience = "api://my-api"
+
+	params := url.Values{}
+	setAudienceParams(params)
+	if params.Has("audience") {
+		t.Errorf("azure preset should not send audience param, got %v", params)
+	}
+}
+
+func TestTokenResponse_ExpiresIn(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"number", `{"expires_in":3599}`, 3599},
+		{"string", `{"expires_in":"3599","ext_expires_in":"7199"}`, 3599},
+		{"missing", `{}`, 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var resp tokenResponse
+			if err := json.Unmarshal([]byte(tc.body), &resp); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if int(resp.ExpiresIn) != tc.want {
+				t.Errorf("ExpiresIn = %d, want %d", resp.ExpiresIn, tc.want)
+			}
+		})
+	}
+
+	var resp tokenResponse
+	if err := json.Unmarshal([]byte(`{"expires_in":"soon"}`), &resp); err == nil {
+		t.Error("expected error for non-numeric expires_in")
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Reserve(t *testing.T) {
+	l := newRateLimiter(2, 3)
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// The burst goes out at once; then one request every 500ms, queued.
+	for i := range 3 {
+		if d := l.reserve(at); d != 0 {
+			t.Fatalf("request %d within burst waits %v, want 0", i, d)
+		}
+	}
+	if d := l.reserve(at); d != 500*time.Millisecond {
+		t.Errorf("4th request waits %v, want 500ms", d)
+	}
+	if d := l.reserve(at); d != time.Second {
+		t.Errorf("5th request waits %v, want 1s", d)
+	}
+
+	// After the queue drains the bucket refills, but never beyond burst.
+	at = at.Add(time.Minute)
+	for i := range 3 {
+		if d := l.reserve(at); d != 0 {
+			t.Fatalf("request %d after refill waits %v, want 0", i, d)
+		}
+	}
+	if d := l.reserve(at); d == 0 {
+		t.Error("request beyond burst after refill did not wait")
+	}
+}
+
+func TestRateLimitTransport(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &rateLimitTransport{
+		base:    srv.Client().Transport,
+		limiter: newRateLimiter(0.001, 1),
+	}}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+	resp.Body.Close()
+
+	// The second request would wait about 1000s; cancelling gives up.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if _, err := client.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("rate-limited request error = %v, want DeadlineExceeded", err)
+	}
+	if requests != 1 {
+		t.Errorf("server saw %d requests, want 1", requests)
+	}
+}
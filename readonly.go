@@ -0,0 +1,26 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/go-authgate/sdk-go/credstore"
+)
+
+// errReadOnly is returned when -read-only is set and an operation would have
+// to write to the token store (refresh, login, revocation cleanup).
+var errReadOnly = errors.New("token store is read-only (-read-only); a token update is required")
+
+// readOnlyStore rejects every write to the wrapped store. Callers check
+// cfg.ReadOnly before contacting the server, so a refresh is never performed
+// whose rotated token could not be saved; the wrapper is a backstop.
+type readOnlyStore struct {
+	credstore.Store[credstore.Token]
+}
+
+func (readOnlyStore) Save(string, credstore.Token) error {
+	return errReadOnly
+}
+
+func (readOnlyStore) Delete(string) error {
+	return errReadOnly
+}
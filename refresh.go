@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/go-authgate/oauth-cli/tui"
+)
+
+// runRefresh implements `oauth-cli refresh`: it refreshes the stored token for
+// the configured audience/resource, even if it is still valid, and prints the
+// new access token to stdout. With -scope, it prints a down-scoped access
+// token instead (RFC 6749 §6), which is cached under its own key and reused
+// while valid; the stored token and its refresh token are kept.
+func runRefresh(ctx context.Context) int {
+	initConfig()
+
+	var reqScope string
+	if isFlagSet("scope") {
+		reqScope = normalizeScopes(*flagScope)
+	}
+	var storage *tui.TokenStorage
+	var err error
+	if reqScope != "" {
+		storage, err = scopedToken(ctx, tokenKey(), reqScope)
+	} else {
+		storage, err = forceRefresh(ctx, tokenKey(), "")
+	}
+	if err != nil {
+		auditLog.record("export", "refresh command", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Println(storage.AccessToken)
+	auditLog.record("export", "refresh command", nil)
+	return 0
+}
+
+// scopedTokenKey returns the token store key of a token for key down-scoped
+// to reqScope.
+func scopedTokenKey(key, reqScope string) string {
+	return key + "#scope=" + reqScope
+}
+
+// scopedToken returns the cached token for key down-scoped to reqScope while
+// it is valid, and otherwise refreshes a new one with forceRefresh.
+func scopedToken(ctx context.Context, key, reqScope string) (*tui.TokenStorage, error) {
+	if tok, err := cfg.TokenStore.Load(scopedTokenKey(key, reqScope)); err == nil &&
+		tui.TokenValid(&tok, clock.Now().Add(cfg.RefreshBefore)) {
+		return &tok, nil
+	}
+	return forceRefresh(ctx, key, reqScope)
+}
+
+// forceRefresh refreshes the token stored under key with its refresh token.
+// Without reqScope the result replaces the stored token. With reqScope the
+// access token is saved under scopedTokenKey without a refresh token, so the
+// stored entry remains the only holder of it; a rotated refresh token is
+// written back to that entry.
+func forceRefresh(ctx context.Context, key, reqScope string) (*tui.TokenStorage, error) {
+	tok, err := cfg.TokenStore.Load(key)
+	if err != nil || tok.RefreshToken == "" {
+		return nil, errors.New("no refresh token available; run oauth-cli to log in first")
+	}
+	if reqScope == "" {
+		storage, err := refreshAndSave(ctx, key, tok.RefreshToken)
+		return storage, refreshError(err)
+	}
+
+	if cfg.ReadOnly {
+		return nil, errReadOnly
+	}
+	storage, err := refreshAccessTokenScope(ctx, key, tok.RefreshToken, reqScope)
+	if err != nil {
+		return nil, refreshError(err)
+	}
+	if storage.RefreshToken != tok.RefreshToken {
+		tok.RefreshToken = storage.RefreshToken
+		if err := cfg.TokenStore.Save(key, tok); err != nil {
+			return nil, fmt.Errorf("failed to save rotated refresh token: %w", err)
+		}
+	}
+	storage.RefreshToken = ""
+	if err := cfg.TokenStore.Save(scopedTokenKey(key, reqScope), *storage); err != nil {
+		return nil, fmt.Errorf("failed to save token: %w", err)
+	}
+	return storage, nil
+}
+
+// refreshError adds a login hint to an expired refresh token error.
+func refreshError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, tui.ErrRefreshTokenExpired):
+		return errors.New("refresh token expired; run oauth-cli to log in again")
+	default:
+		return fmt.Errorf("refresh failed: %w", err)
+	}
+}
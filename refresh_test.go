@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-authgate/sdk-go/credstore"
+)
+
+func TestForceRefresh_DownScoped(t *testing.T) {
+	var gotScope, gotRefresh string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		gotScope = r.PostForm.Get("scope")
+		gotRefresh = r.PostForm.Get("refresh_token")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"read-access-token","refresh_token":"rotated-refresh",` +
+			`"token_type":"Bearer","expires_in":3600,"scope":"read"}`))
+	}))
+	defer srv.Close()
+	setTestServer(t, srv)
+	setTokenTestConfig(t, "")
+
+	if err := cfg.TokenStore.Save("test-client", credstore.Token{
+		AccessToken:  "base-access-token",
+		RefreshToken: "base-refresh",
+		TokenType:    "Bearer",
+		ExpiresAt:    time.Now().Add(time.Hour),
+		ClientID:     "test-client",
+	}); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	storage, err := forceRefresh(context.Background(), "test-client", "read")
+	if err != nil {
+		t.Fatalf("forceRefresh() error: %v", err)
+	}
+	if storage.AccessToken != "read-access-token" {
+		t.Errorf("AccessToken = %q", storage.AccessToken)
+	}
+	if gotScope != "read" || gotRefresh != "base-refresh" {
+		t.Errorf("refresh request scope=%q refresh_token=%q", gotScope, gotRefresh)
+	}
+
+	scoped, err := cfg.TokenStore.Load("test-client#scope=read")
+	if err != nil || scoped.AccessToken != "read-access-token" || scoped.RefreshToken != "" {
+		t.Errorf("down-scoped token cached as %+v, %v", scoped, err)
+	}
+	base, _ := cfg.TokenStore.Load("test-client")
+	if base.AccessToken != "base-access-token" || base.RefreshToken != "rotated-refresh" {
+		t.Errorf("base token = %+v, want the original access token and the rotated refresh token",
+			base)
+	}
+}
+
+func TestScopedToken_ReusesCachedToken(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"read-access-token","token_type":"Bearer",` +
+			`"expires_in":3600,"scope":"read"}`))
+	}))
+	defer srv.Close()
+	setTestServer(t, srv)
+	setTokenTestConfig(t, "")
+
+	if err := cfg.TokenStore.Save("test-client", credstore.Token{
+		AccessToken:  "base-access-token",
+		RefreshToken: "base-refresh",
+		TokenType:    "Bearer",
+		ExpiresAt:    time.Now().Add(time.Hour),
+		ClientID:     "test-client",
+	}); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	for range 2 {
+		storage, err := scopedToken(context.Background(), "test-client", "read")
+		if err != nil {
+			t.Fatalf("scopedToken() error: %v", err)
+		}
+		if storage.AccessToken != "read-access-token" {
+			t.Errorf("AccessToken = %q", storage.AccessToken)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("token requests = %d, want 1 (second call served from the cache)", requests)
+	}
+}
+
+func TestForceRefresh_ReplacesValidToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.PostForm.Has("scope") {
+			t.Errorf("scope = %q, want none", r.PostForm.Get("scope"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"new-access-token","token_type":"Bearer",` +
+			`"expires_in":3600}`))
+	}))
+	defer srv.Close()
+	setTestServer(t, srv)
+	setTokenTestConfig(t, "")
+
+	if err := cfg.TokenStore.Save("test-client", credstore.Token{
+		AccessToken:  "valid-access-token",
+		RefreshToken: "base-refresh",
+		TokenType:    "Bearer",
+		ExpiresAt:    time.Now().Add(time.Hour),
+		ClientID:     "test-client",
+	}); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	if _, err := forceRefresh(context.Background(), "test-client", ""); err != nil {
+		t.Fatalf("forceRefresh() error: %v", err)
+	}
+	base, _ := cfg.TokenStore.Load("test-client")
+	if base.AccessToken != "new-access-token" || base.RefreshToken != "base-refresh" {
+		t.Errorf("stored token = %+v", base)
+	}
+}
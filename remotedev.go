@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// publicRedirectOff disables remote development detection in
+// -public-redirect-uri.
+const publicRedirectOff = "off"
+
+// remoteDevRedirect returns the public URL under which a remote development
+// environment forwards the callback port, and the environment's name, or ""
+// when none is detected. The callback server keeps listening on loopback;
+// the environment's proxy forwards the browser's request to it.
+//
+// VS Code Remote (SSH, containers, WSL) is not listed: it forwards
+// localhost:<port> on the client machine, so the loopback redirect URI
+// already works there.
+func remoteDevRedirect(getenv func(string) string, port int) (redirect, env string) {
+	p := strconv.Itoa(port)
+	if name := getenv("CODESPACE_NAME"); getenv("CODESPACES") == "true" && name != "" {
+		domain := getenv("GITHUB_CODESPACES_PORT_FORWARDING_DOMAIN")
+		if domain == "" {
+			domain = "app.github.dev"
+		}
+		return "https://" + name + "-" + p + "." + domain + callbackPath, "GitHub Codespaces"
+	}
+	if ws := getenv("GITPOD_WORKSPACE_URL"); ws != "" {
+		if u, err := url.Parse(ws); err == nil && u.Host != "" {
+			return "https://" + p + "-" + u.Host + callbackPath, "Gitpod"
+		}
+	}
+	return "", ""
+}
+
+// resolvePublicRedirect turns the -public-redirect-uri setting into the
+// redirect URI sent to the server ("" means cfg.RedirectURI) and a notice for
+// the user when it was detected rather than configured. Detection only runs
+// when redirectSet is false: an explicit -redirect-uri is sent as is.
+func resolvePublicRedirect(
+	setting string,
+	redirectSet bool,
+	getenv func(string) string,
+	port int,
+) (redirect, notice string, err error) {
+	switch setting {
+	case publicRedirectOff:
+		return "", "", nil
+	case "":
+		if redirectSet {
+			return "", "", nil
+		}
+		redirect, env := remoteDevRedirect(getenv, port)
+		if redirect == "" {
+			return "", "", nil
+		}
+		return redirect, fmt.Sprintf("%s detected: the server will redirect to %s, which forwards "+
+			"to the callback server on port %d. Register it for the client, or set "+
+			"-public-redirect-uri=off.", env, redirect, port), nil
+	}
+	u, err := url.Parse(setting)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return "", "", fmt.Errorf("invalid public-redirect-uri value: %s (must be an http(s) URL or off)",
+			setting)
+	}
+	return setting, "", nil
+}
+
+// sentRedirectURI is the redirect_uri of authorization and token requests:
+// the public URL when the callback is reached through a forward, otherwise
+// the local redirect URI.
+func sentRedirectURI() string {
+	if cfg.PublicRedirectURI != "" {
+		return cfg.PublicRedirectURI
+	}
+	return cfg.RedirectURI
+}
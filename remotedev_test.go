@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestResolvePublicRedirect(t *testing.T) {
+	env := func(vars map[string]string) func(string) string {
+		return func(k string) string { return vars[k] }
+	}
+	codespaces := env(map[string]string{
+		"CODESPACES":     "true",
+		"CODESPACE_NAME": "octo-space-x7q",
+		"GITHUB_CODESPACES_PORT_FORWARDING_DOMAIN": "app.github.dev",
+	})
+	gitpod := env(map[string]string{
+		"GITPOD_WORKSPACE_URL": "https://acme-repo-abc123.ws-eu110.gitpod.io",
+	})
+
+	tests := []struct {
+		name, setting string
+		redirectSet   bool
+		getenv        func(string) string
+		want          string
+		wantNotice    bool
+		wantErr       bool
+	}{
+		{name: "codespaces", getenv: codespaces,
+			want: "https://octo-space-x7q-8888.app.github.dev/callback", wantNotice: true},
+		{name: "gitpod", getenv: gitpod,
+			want: "https://8888-acme-repo-abc123.ws-eu110.gitpod.io/callback", wantNotice: true},
+		{name: "local", getenv: env(nil)},
+		{name: "redirect-uri set", redirectSet: true, getenv: codespaces},
+		{name: "off", setting: "off", getenv: codespaces},
+		{name: "explicit", setting: "https://tunnel.example.com/callback", getenv: codespaces,
+			want: "https://tunnel.example.com/callback"},
+		{name: "invalid", setting: "tunnel.example.com", getenv: env(nil), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, notice, err := resolvePublicRedirect(tt.setting, tt.redirectSet, tt.getenv, 8888)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want || (notice != "") != tt.wantNotice {
+				t.Errorf("resolvePublicRedirect() = %q, notice %q; want %q", got, notice, tt.want)
+			}
+		})
+	}
+}
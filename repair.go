@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-authgate/sdk-go/credstore"
+)
+
+// runTokens implements `oauth-cli tokens <action>`. The only action is repair.
+func runTokens(_ context.Context) int {
+	if len(os.Args) < 2 || os.Args[1] != "repair" {
+		fmt.Fprintln(os.Stderr, "Usage: oauth-cli tokens repair [flags]")
+		return 2
+	}
+	// Drop the action so the remaining flags parse as usual.
+	os.Args = append(os.Args[:1:1], os.Args[2:]...)
+	cfg.ClientIDOptional = true
+	initConfig()
+
+	if cfg.TokenStoreMode != "file" && cfg.TokenStoreMode != "auto" {
+		fmt.Fprintln(os.Stderr, "Error: tokens repair only applies to file-based token storage")
+		return 1
+	}
+
+	source, restored, skipped, err := repairTokenFile(cfg.TokenFile, cfg.TokenStore, clock.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if source == "" {
+		fmt.Printf("Token file %s is intact; nothing to repair\n", cfg.TokenFile)
+		return 0
+	}
+	fmt.Printf("Recovered %d token(s) from %s", restored, source)
+	if skipped > 0 {
+		fmt.Printf(" (%d already present, kept)", skipped)
+	}
+	fmt.Println()
+	return 0
+}
+
+// repairTokenFile salvages intact entries from a corrupt token file into
+// store. The source is path itself when it is corrupt (it is quarantined
+// first), otherwise the most recently quarantined copy. Entries already in
+// store are kept. An empty source means there was nothing to repair.
+func repairTokenFile(
+	path string,
+	store credstore.Store[credstore.Token],
+	now time.Time,
+) (source string, restored, skipped int, err error) {
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil && !json.Valid(data):
+		if source, err = quarantineTokenFile(path, now); err != nil {
+			return "", 0, 0, fmt.Errorf("failed to move corrupt token file aside: %w", err)
+		}
+	case err == nil || errors.Is(err, fs.ErrNotExist):
+		if source, err = latestQuarantinedFile(path); err != nil || source == "" {
+			return "", 0, 0, err
+		}
+		if data, err = os.ReadFile(source); err != nil {
+			return "", 0, 0, err
+		}
+	default:
+		return "", 0, 0, err
+	}
+
+	for id, tok := range salvageTokenEntries(data) {
+		if _, err := store.Load(id); err == nil {
+			skipped++
+			continue
+		}
+		if err := store.Save(id, tok); err != nil {
+			return source, restored, skipped, fmt.Errorf("failed to save %s: %w", id, err)
+		}
+		restored++
+	}
+	return source, restored, skipped, nil
+}
+
+// latestQuarantinedFile returns the newest <path>.corrupt-* file, or "".
+// The UTC timestamp suffix sorts chronologically.
+func latestQuarantinedFile(path string) (string, error) {
+	matches, err := filepath.Glob(path + quarantineSuffix + "*")
+	if err != nil || len(matches) == 0 {
+		return "", err
+	}
+	sort.Strings(matches)
+	return matches[len(matches)-1], nil
+}
+
+// salvageTokenEntries returns every token file entry that decoded completely
+// before the first malformed or truncated one.
+func salvageTokenEntries(data []byte) map[string]credstore.Token {
+	entries := make(map[string]credstore.Token)
+	_ = walkTokenEntries(bytes.NewReader(data), func(id string, tok credstore.Token) bool {
+		entries[id] = tok
+		return true
+	})
+	return entries
+}
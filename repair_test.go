@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-authgate/sdk-go/credstore"
+)
+
+// truncatedTokenFile holds two complete entries followed by a torn third one.
+const truncatedTokenFile = `{"tokens":{` +
+	`"client-a":{"access_token":"access-a","refresh_token":"refresh-a","client_id":"client-a"},` +
+	`"client-b":{"access_token":"access-b","client_id":"client-b"},` +
+	`"client-c":{"access_token":"acc`
+
+func TestSalvageTokenEntries(t *testing.T) {
+	entries := salvageTokenEntries([]byte(truncatedTokenFile))
+	if len(entries) != 2 {
+		t.Fatalf("salvaged %d entries, want 2: %v", len(entries), entries)
+	}
+	if entries["client-a"].RefreshToken != "refresh-a" {
+		t.Errorf("client-a = %+v", entries["client-a"])
+	}
+
+	if got := salvageTokenEntries([]byte("garbage")); len(got) != 0 {
+		t.Errorf("expected no entries from garbage, got %v", got)
+	}
+}
+
+func TestRepairTokenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	if err := os.WriteFile(path, []byte(truncatedTokenFile), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	store := credstore.NewTokenFileStore(path)
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+
+	source, restored, skipped, err := repairTokenFile(path, store, now)
+	if err != nil {
+		t.Fatalf("repairTokenFile() error: %v", err)
+	}
+	if want := path + ".corrupt-20261015T120000Z"; source != want {
+		t.Errorf("source = %q, want %q", source, want)
+	}
+	if restored != 2 || skipped != 0 {
+		t.Errorf("restored=%d skipped=%d, want 2 and 0", restored, skipped)
+	}
+	if tok, err := store.Load("client-b"); err != nil || tok.AccessToken != "access-b" {
+		t.Errorf("client-b not recovered: %+v, %v", tok, err)
+	}
+
+	// A second run repairs from the quarantined copy and keeps existing entries.
+	_, restored, skipped, err = repairTokenFile(path, store, now)
+	if err != nil {
+		t.Fatalf("second repairTokenFile() error: %v", err)
+	}
+	if restored != 0 || skipped != 2 {
+		t.Errorf("second run restored=%d skipped=%d, want 0 and 2", restored, skipped)
+	}
+}
+
+func TestRepairTokenFile_NothingToRepair(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	source, _, _, err := repairTokenFile(path, credstore.NewTokenFileStore(path), time.Now())
+	if err != nil || source != "" {
+		t.Errorf("repairTokenFile() = %q, %v; want nothing to repair", source, err)
+	}
+}
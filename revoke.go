@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-authgate/oauth-cli/tui"
+	"github.com/go-authgate/sdk-go/credstore"
+)
+
+const revocationTimeout = 10 * time.Second
+
+// Values of the token_type_hint revocation parameter (RFC 7009 §2.1).
+const (
+	hintAccessToken  = "access_token"
+	hintRefreshToken = "refresh_token"
+)
+
+// runRevoke implements `oauth-cli revoke`: it revokes the stored tokens of
+// the current client and removes them from the token store. `revoke -` and
+// `revoke @file` revoke a token read from stdin or a file instead, such as a
+// leaked one, sending -token-type-hint with it; the token store is left alone.
+// `revoke sha256:...` revokes the stored token with that fingerprint.
+// With -all-for-client, every stored entry of the client is revoked and
+// removed.
+func runRevoke(ctx context.Context) int {
+	flagArgs, positional := splitPositional(os.Args[1:])
+	os.Args = append(os.Args[:1:1], flagArgs...)
+	initConfig()
+	if len(positional) > 1 || (cfg.RevokeAll && len(positional) > 0) {
+		fmt.Fprintln(os.Stderr, "Usage: oauth-cli revoke [flags] [- | @file]\n"+
+			"       oauth-cli revoke -all-for-client [flags]")
+		return 2
+	}
+
+	discoverCapabilities(ctx)
+	if activeProvider.revokePath == "" {
+		fmt.Fprintln(os.Stderr, "Error: the server has no revocation endpoint")
+		return 1
+	}
+
+	if len(positional) == 1 {
+		token, hint, err := readTokenArg(positional[0], os.Stdin)
+		if cfg.TokenTypeHint != "" {
+			hint = cfg.TokenTypeHint
+		}
+		if err == nil {
+			err = revokeToken(ctx, token, hint)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		fmt.Fprintln(os.Stderr, "Token revoked.")
+		return 0
+	}
+
+	if cfg.ReadOnly {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", errReadOnly)
+		return 1
+	}
+	if cfg.RevokeAll {
+		n, err := revokeClientTokens(ctx, cfg.ClientID)
+		fmt.Fprintf(os.Stderr, "Revoked and removed %d stored token(s) of client %s.\n", n, cfg.ClientID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	tok, err := cfg.TokenStore.Load(tokenKey())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: no stored token for client %s\n", cfg.ClientID)
+		return 1
+	}
+	if err := revokeStoredToken(ctx, tokenKey(), &tok); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Fprintln(os.Stderr, "Stored tokens revoked and removed.")
+	return 0
+}
+
+// revokeClientTokens revokes the tokens of every stored entry of client cid
+// (see clientTokenKeys) and deletes the entries, for offboarding. A token
+// shared by several entries, such as the refresh token audience tokens are
+// minted from, is revoked once. It returns the number of entries removed;
+// failures are collected and do not stop the others.
+func revokeClientTokens(ctx context.Context, cid string) (int, error) {
+	var (
+		errs    []string
+		removed int
+	)
+	revoked := make(map[string]bool)
+	for _, key := range clientTokenKeys(cid) {
+		tok, err := cfg.TokenStore.Load(key)
+		if err != nil {
+			continue
+		}
+		for _, t := range []struct{ value, hint string }{
+			{tok.RefreshToken, hintRefreshToken},
+			{tok.AccessToken, hintAccessToken},
+		} {
+			if t.value == "" || revoked[t.value] {
+				continue
+			}
+			revoked[t.value] = true
+			if err := revokeToken(ctx, t.value, t.hint); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %s: %v", key, t.hint, err))
+			}
+		}
+		if err := cfg.TokenStore.Delete(key); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: token store: %v", key, err))
+			continue
+		}
+		removed++
+	}
+	if len(errs) > 0 {
+		return removed, errors.New(strings.Join(errs, "; "))
+	}
+	return removed, nil
+}
+
+// clientTokenKeys returns the token store keys that may hold tokens of client
+// cid: its base entry, the configured tokenKey(), and every per-audience,
+// per-resource or down-scoped entry ("<cid>#...") found in the token file.
+// Stores that cannot be listed, like the OS keyring, only contribute the
+// first two.
+func clientTokenKeys(cid string) []string {
+	keys := []string{cid, tokenKey()}
+	if f, err := os.Open(cfg.TokenFile); err == nil {
+		_ = walkTokenEntries(bufio.NewReader(f), func(id string, _ credstore.Token) bool {
+			if strings.HasPrefix(id, cid+"#") {
+				keys = append(keys, id)
+			}
+			return true
+		})
+		f.Close()
+	}
+	slices.Sort(keys)
+	return slices.Compact(keys)
+}
+
+// validateTokenTypeHint checks a -token-type-hint value; "" sends no hint.
+func validateTokenTypeHint(hint string) error {
+	switch hint {
+	case "", hintAccessToken, hintRefreshToken:
+		return nil
+	default:
+		return fmt.Errorf("invalid token-type-hint value: %s (must be %s or %s)",
+			hint, hintAccessToken, hintRefreshToken)
+	}
+}
+
+// revokeToken revokes a single token at /oauth/revoke (RFC 7009).
+// tokenTypeHint is "access_token", "refresh_token" or "" for none.
+func revokeToken(ctx context.Context, token, tokenTypeHint string) (err error) {
+	defer func() { auditLog.record("revoke", tokenTypeHint, err) }()
+
+	if activeProvider.revokePath == "" {
+		return tui.ErrNotSupported
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, revocationTimeout)
+	defer cancel()
+
+	data := url.Values{}
+	data.Set("token", token)
+	if tokenTypeHint != "" {
+		data.Set("token_type_hint", tokenTypeHint)
+	}
+	data.Set("client_id", cfg.ClientID)
+	data, header, err := authenticateClient(ctx, data, endpointURL(activeProvider.tokenPath))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		endpointURL(activeProvider.revokePath),
+		strings.NewReader(data.Encode()),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := cfg.RetryClient.DoWithContext(ctx, req)
+	if err != nil {
+		return fmt.Errorf("revocation request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := readResponseBody(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	// RFC 7009 §2.2: the server responds 200 whether or not the token was valid.
+	if resp.StatusCode != http.StatusOK {
+		return parseOAuthError(resp.StatusCode, body, "revocation")
+	}
+	return nil
+}
+
+// revokeObtainedToken revokes a token issued during an interrupted run
+// (-revoke-on-abort) and removes it from the token store, so the aborted login
+// leaves no live grant behind.
+func revokeObtainedToken(ctx context.Context, storage *tui.TokenStorage) error {
+	if activeProvider.revokePath == "" {
+		// Nothing to revoke server-side; still drop the local copy.
+		if err := cfg.TokenStore.Delete(tokenKey()); err != nil {
+			return fmt.Errorf("revoke on abort: token store: %w", err)
+		}
+		return nil
+	}
+	if err := revokeStoredToken(ctx, tokenKey(), storage); err != nil {
+		return fmt.Errorf("revoke on abort: %w", err)
+	}
+	return nil
+}
+
+// revokeStoredToken revokes the tokens in storage and deletes key from the
+// token store. The refresh token is revoked first because servers typically
+// cascade its revocation to the access tokens it minted. The store entry is
+// deleted even if a revocation fails.
+func revokeStoredToken(ctx context.Context, key string, storage *tui.TokenStorage) error {
+	var errs []string
+	if storage.RefreshToken != "" {
+		if err := revokeToken(ctx, storage.RefreshToken, hintRefreshToken); err != nil {
+			errs = append(errs, "refresh token: "+err.Error())
+		}
+	}
+	if err := revokeToken(ctx, storage.AccessToken, hintAccessToken); err != nil {
+		errs = append(errs, "access token: "+err.Error())
+	}
+	if err := cfg.TokenStore.Delete(key); err != nil {
+		errs = append(errs, "token store: "+err.Error())
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// handleAbortRevocation runs -revoke-on-abort after an interrupted TUI run and
+// reports the outcome on stderr.
+func handleAbortRevocation(storage *tui.TokenStorage) {
+	if storage == nil {
+		return
+	}
+	if err := revokeObtainedToken(context.Background(), storage); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return
+	}
+	fmt.Fprintln(os.Stderr, "Interrupted: tokens obtained during this run were revoked.")
+}
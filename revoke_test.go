@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-authgate/oauth-cli/tui"
+	"github.com/go-authgate/sdk-go/credstore"
+)
+
+func TestRevokeObtainedToken(t *testing.T) {
+	var revoked []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/oauth/revoke" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		_ = r.ParseForm()
+		revoked = append(revoked, r.PostForm.Get("token_type_hint")+"="+r.PostForm.Get("token"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	setTestServer(t, srv)
+	setTokenTestConfig(t, "")
+
+	storage := &tui.TokenStorage{
+		AccessToken:  "new-access-token",
+		RefreshToken: "new-refresh-token",
+		ExpiresAt:    time.Now().Add(time.Hour),
+	}
+	if err := cfg.TokenStore.Save(tokenKey(), *storage); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	if err := revokeObtainedToken(context.Background(), storage); err != nil {
+		t.Fatalf("revokeObtainedToken() error: %v", err)
+	}
+
+	want := []string{"refresh_token=new-refresh-token", "access_token=new-access-token"}
+	if strings.Join(revoked, ",") != strings.Join(want, ",") {
+		t.Errorf("revoked = %v, want %v", revoked, want)
+	}
+	if _, err := cfg.TokenStore.Load(tokenKey()); !errors.Is(err, credstore.ErrNotFound) {
+		t.Errorf("expected token to be removed from store, got err = %v", err)
+	}
+}
+
+func TestRevokeToken_ServerError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"unsupported_token_type","error_description":"nope"}`))
+	}))
+	defer srv.Close()
+	setTestServer(t, srv)
+
+	err := revokeToken(context.Background(), "tok", "access_token")
+	if err == nil || !strings.Contains(err.Error(), "unsupported_token_type") {
+		t.Errorf("expected OAuth error, got: %v", err)
+	}
+}
+
+func TestRevokeToken_WithoutHint(t *testing.T) {
+	var form map[string][]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		form = r.PostForm
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	setTestServer(t, srv)
+	setTokenTestConfig(t, "")
+
+	if err := revokeToken(context.Background(), "leaked-token", ""); err != nil {
+		t.Fatalf("revokeToken() error: %v", err)
+	}
+	if _, ok := form["token_type_hint"]; ok || form["token"][0] != "leaked-token" {
+		t.Errorf("revocation form = %v, want the token without a hint", form)
+	}
+}
+
+func TestValidateTokenTypeHint(t *testing.T) {
+	for _, hint := range []string{"", hintAccessToken, hintRefreshToken} {
+		if err := validateTokenTypeHint(hint); err != nil {
+			t.Errorf("validateTokenTypeHint(%q) error = %v", hint, err)
+		}
+	}
+	if err := validateTokenTypeHint("id_token"); err == nil {
+		t.Error("validateTokenTypeHint(\"id_token\") succeeded")
+	}
+}
+
+func TestRevokeClientTokens(t *testing.T) {
+	var revoked []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		revoked = append(revoked, r.PostForm.Get("token"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	setTestServer(t, srv)
+	setTokenTestConfig(t, "")
+	origFile := cfg.TokenFile
+	t.Cleanup(func() { cfg.TokenFile = origFile })
+	cfg.TokenFile = filepath.Join(t.TempDir(), "tokens.json")
+	cfg.TokenStore = credstore.NewTokenFileStore(cfg.TokenFile)
+
+	entries := map[string]credstore.Token{
+		"test-client":                  {AccessToken: "base-access", RefreshToken: "shared-refresh"},
+		"test-client#aud=api://orders": {AccessToken: "orders-access", RefreshToken: "shared-refresh"},
+		"test-client#scope=read":       {AccessToken: "read-access"},
+		"other-client":                 {AccessToken: "other-access", RefreshToken: "other-refresh"},
+	}
+	for key, tok := range entries {
+		if err := cfg.TokenStore.Save(key, tok); err != nil {
+			t.Fatalf("Save(%q) error: %v", key, err)
+		}
+	}
+
+	n, err := revokeClientTokens(context.Background(), "test-client")
+	if err != nil || n != 3 {
+		t.Fatalf("revokeClientTokens() = %d, %v; want 3 entries removed", n, err)
+	}
+	slices.Sort(revoked)
+	want := []string{"base-access", "orders-access", "read-access", "shared-refresh"}
+	if !slices.Equal(revoked, want) {
+		t.Errorf("revoked = %v, want %v", revoked, want)
+	}
+	for key := range entries {
+		_, err := cfg.TokenStore.Load(key)
+		if kept := err == nil; kept != (key == "other-client") {
+			t.Errorf("entry %q kept = %v after revoking test-client", key, kept)
+		}
+	}
+}
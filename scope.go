@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// offlineAccessScope is the OpenID Connect scope that requests an offline
+// refresh token (Keycloak and others), which outlives the SSO session.
+const offlineAccessScope = "offline_access"
+
+// splitScopes splits a scope list on whitespace and commas, so lists written
+// for providers that use either separator are understood.
+func splitScopes(scopes string) []string {
+	return strings.FieldsFunc(scopes, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
+
+// normalizeScopes returns scopes trimmed, deduplicated, sorted and joined with
+// single spaces, so the same set of scopes always yields the same string
+// however it was written.
+func normalizeScopes(scopes string) string {
+	list := splitScopes(scopes)
+	slices.Sort(list)
+	return strings.Join(slices.Compact(list), " ")
+}
+
+// parseScopeSeparator maps the -scope-separator value to the separator used
+// when sending scopes to the server.
+func parseScopeSeparator(v string) (string, error) {
+	switch v {
+	case "space", " ":
+		return " ", nil
+	case "comma", ",":
+		return ",", nil
+	default:
+		return "", fmt.Errorf("invalid scope-separator value: %q (must be space or comma)", v)
+	}
+}
+
+// hasScope reports whether the space-separated scope list contains s.
+func hasScope(scopes, s string) bool {
+	return slices.Contains(strings.Fields(scopes), s)
+}
+
+// withScope returns scopes with s appended unless it is already present.
+func withScope(scopes, s string) string {
+	if hasScope(scopes, s) {
+		return scopes
+	}
+	return strings.TrimSpace(scopes + " " + s)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/go-authgate/oauth-cli/tui"
+)
+
+func TestNormalizeScopes(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"write read", "read write"},
+		{"  read,write  read ", "read write"},
+		{"openid,profile, email", "email openid profile"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeScopes(tt.in); got != tt.want {
+			t.Errorf("normalizeScopes(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestBuildAuthURL_ScopeSeparator(t *testing.T) {
+	origScope, origSep := cfg.Scope, cfg.ScopeSeparator
+	t.Cleanup(func() { cfg.Scope, cfg.ScopeSeparator = origScope, origSep })
+	cfg.Scope = normalizeScopes("user:email repo repo")
+
+	for _, tt := range []struct {
+		separator, want string
+	}{
+		{"space", "repo user:email"},
+		{"comma", "repo,user:email"},
+	} {
+		var err error
+		if cfg.ScopeSeparator, err = parseScopeSeparator(tt.separator); err != nil {
+			t.Fatal(err)
+		}
+		u, err := url.Parse(buildAuthURL("state", &tui.PKCEParams{Method: pkceMethodNone}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := u.Query().Get("scope"); got != tt.want {
+			t.Errorf("separator %s: scope = %q, want %q", tt.separator, got, tt.want)
+		}
+	}
+
+	if _, err := parseScopeSeparator("semicolon"); err == nil {
+		t.Error("expected error for unsupported separator")
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/go-authgate/oauth-cli/tui"
+	"github.com/go-authgate/sdk-go/credstore"
+)
+
+// runStatusSnapshot implements `status -diff` and `status -snapshot` for
+// drift detection: it compares every entry of the token file with the
+// snapshot given to -diff, printing a tokenDiff as JSON, and saves the current
+// state to the -snapshot file. Like diff(1), it exits 0 when nothing changed,
+// 1 when something did, and 2 on trouble.
+func runStatusSnapshot() int {
+	if cfg.TokenStoreMode != "file" && cfg.TokenStoreMode != "auto" {
+		fmt.Fprintln(os.Stderr, "Error: status -diff and -snapshot need file-based token storage")
+		return 2
+	}
+	current, err := readSnapshot(cfg.TokenFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	var diff tokenDiff
+	if cfg.StatusDiff != "" {
+		before, err := readSnapshot(cfg.StatusDiff)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+		diff = diffSnapshots(before, current)
+	}
+	// Written after reading -diff, so both may name the same file.
+	if cfg.StatusSnapshot != "" {
+		if err := writeSnapshot(cfg.StatusSnapshot, current); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to write snapshot: %v\n", err)
+			return 2
+		}
+	}
+	if cfg.StatusDiff == "" {
+		return 0
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(diff); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	if diff.empty() {
+		return 0
+	}
+	return 1
+}
+
+// snapshotEntry records the tokens of one token file entry by fingerprint.
+type snapshotEntry struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// tokenSnapshot is the document `status -snapshot` writes. It uses the token
+// file layout with fingerprints in place of tokens, so `status -diff` reads a
+// snapshot and a plain copy of the token file alike.
+type tokenSnapshot struct {
+	Tokens map[string]snapshotEntry `json:"tokens"`
+}
+
+// tokenDiff is the result of `status -diff`: the keys of entries added,
+// removed, and rotated (either token replaced) since the snapshot.
+type tokenDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Rotated []string `json:"rotated"`
+}
+
+func (d tokenDiff) empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Rotated) == 0
+}
+
+// readSnapshot reads a snapshot or token file at path. A missing file is an
+// empty map, as a token file that was never written holds no tokens.
+func readSnapshot(path string) (map[string]snapshotEntry, error) {
+	entries := make(map[string]snapshotEntry)
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	err = walkTokenEntries(bufio.NewReader(f), func(id string, tok credstore.Token) bool {
+		entries[id] = snapshotEntry{
+			AccessToken:  snapshotFingerprint(tok.AccessToken),
+			RefreshToken: snapshotFingerprint(tok.RefreshToken),
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// snapshotFingerprint returns the fingerprint of a token, or the value itself
+// when it already is one; "" stays "".
+func snapshotFingerprint(v string) string {
+	if v == "" || strings.HasPrefix(v, fingerprintPrefix) {
+		return v
+	}
+	return tui.TokenFingerprint(v)
+}
+
+// writeSnapshot writes entries to path as a tokenSnapshot.
+func writeSnapshot(path string, entries map[string]snapshotEntry) error {
+	data, err := json.MarshalIndent(tokenSnapshot{Tokens: entries}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileSync(path, append(data, '\n'))
+}
+
+// diffSnapshots compares the entries of an earlier snapshot with the current
+// ones. Keys are sorted.
+func diffSnapshots(before, after map[string]snapshotEntry) tokenDiff {
+	d := tokenDiff{Added: []string{}, Removed: []string{}, Rotated: []string{}}
+	for key, cur := range after {
+		prev, ok := before[key]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, key)
+		case prev != cur:
+			d.Rotated = append(d.Rotated, key)
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			d.Removed = append(d.Removed, key)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Strings(d.Rotated)
+	return d
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/go-authgate/oauth-cli/tui"
+	"github.com/go-authgate/sdk-go/credstore"
+)
+
+func TestReadSnapshot_TokenFileAndSnapshotAgree(t *testing.T) {
+	dir := t.TempDir()
+	tokenPath := filepath.Join(dir, "tokens.json")
+	store := credstore.NewTokenFileStore(tokenPath)
+	tok := credstore.Token{AccessToken: "a1", RefreshToken: "r1"}
+	if err := store.Save("client", tok); err != nil {
+		t.Fatal(err)
+	}
+
+	fromFile, err := readSnapshot(tokenPath)
+	if err != nil {
+		t.Fatalf("readSnapshot(token file) error: %v", err)
+	}
+	want := snapshotEntry{
+		AccessToken:  tui.TokenFingerprint("a1"),
+		RefreshToken: tui.TokenFingerprint("r1"),
+	}
+	if fromFile["client"] != want {
+		t.Errorf("entry = %+v, want %+v", fromFile["client"], want)
+	}
+
+	snapPath := filepath.Join(dir, "snapshot.json")
+	if err := writeSnapshot(snapPath, fromFile); err != nil {
+		t.Fatalf("writeSnapshot() error: %v", err)
+	}
+	fromSnapshot, err := readSnapshot(snapPath)
+	if err != nil {
+		t.Fatalf("readSnapshot(snapshot) error: %v", err)
+	}
+	if d := diffSnapshots(fromSnapshot, fromFile); !d.empty() {
+		t.Errorf("diff of a snapshot and its token file = %+v, want none", d)
+	}
+
+	missing, err := readSnapshot(filepath.Join(dir, "missing.json"))
+	if err != nil || len(missing) != 0 {
+		t.Errorf("readSnapshot(missing) = %v, %v; want an empty map", missing, err)
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	before := map[string]snapshotEntry{
+		"kept":    {AccessToken: "sha256:aaa", RefreshToken: "sha256:bbb"},
+		"rotated": {AccessToken: "sha256:ccc", RefreshToken: "sha256:ddd"},
+		"removed": {AccessToken: "sha256:eee"},
+	}
+	after := map[string]snapshotEntry{
+		"kept":    {AccessToken: "sha256:aaa", RefreshToken: "sha256:bbb"},
+		"rotated": {AccessToken: "sha256:ccc", RefreshToken: "sha256:fff"},
+		"added":   {AccessToken: "sha256:ggg"},
+	}
+	d := diffSnapshots(before, after)
+	if !slices.Equal(d.Added, []string{"added"}) || !slices.Equal(d.Removed, []string{"removed"}) ||
+		!slices.Equal(d.Rotated, []string{"rotated"}) {
+		t.Errorf("diffSnapshots() = %+v", d)
+	}
+}
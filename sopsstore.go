@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/go-authgate/sdk-go/credstore"
+)
+
+// sopsStore keeps the token file as a SOPS-encrypted JSON document, so it can
+// be committed to or synced through a dotfile repository. The sops binary
+// does the cryptography: recipients (age, KMS, PGP, ...) come from the
+// creation rules in .sops.yaml matching the token file path, or from the
+// SOPS_* environment variables. Saves and deletes hold the token file's
+// cross-process lock across their read-modify-write, so concurrent runs do
+// not drop each other's entries.
+type sopsStore struct {
+	path string
+
+	mu sync.Mutex
+
+	// run executes sops with args and stdin and returns its stdout.
+	run func(stdin []byte, args ...string) ([]byte, error)
+}
+
+// sopsTokenFile is the decrypted document, the same layout as the plain
+// token file.
+type sopsTokenFile struct {
+	Tokens map[string]credstore.Token `json:"tokens"`
+}
+
+func newSOPSStore(path string) *sopsStore {
+	return &sopsStore{path: path, run: commandRunner("sops")}
+}
+
+// read decrypts the token file. A missing file is an empty document.
+func (s *sopsStore) read() (sopsTokenFile, error) {
+	doc := sopsTokenFile{Tokens: make(map[string]credstore.Token)}
+	if _, err := os.Stat(s.path); errors.Is(err, fs.ErrNotExist) {
+		return doc, nil
+	}
+	out, err := s.run(nil, "decrypt", "--input-type", "json", "--output-type", "json", s.path)
+	if err != nil {
+		return doc, err
+	}
+	if err := json.Unmarshal(out, &doc); err != nil {
+		return doc, fmt.Errorf("invalid decrypted token file %s: %w", s.path, err)
+	}
+	if doc.Tokens == nil {
+		doc.Tokens = make(map[string]credstore.Token)
+	}
+	return doc, nil
+}
+
+// write encrypts doc and atomically replaces the token file. The plaintext is
+// handed to sops in a mode 0600 temporary file next to the token file, which
+// is removed once sops has read it; --filename-override selects the
+// .sops.yaml creation rule for the real path.
+func (s *sopsStore) write(doc sopsTokenFile) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.plain")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	out, err := s.run(nil, "encrypt", "--input-type", "json", "--output-type", "json",
+		"--filename-override", s.path, tmp.Name())
+	if err != nil {
+		return err
+	}
+	return writeFileSync(s.path, out)
+}
+
+// update applies fn to the decrypted document under the token file lock and
+// writes the result back. fn reports whether the document changed.
+func (s *sopsStore) update(fn func(doc *sopsTokenFile) bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	release, err := acquireFileLock(s.path)
+	if err != nil {
+		return err
+	}
+	defer release()
+	doc, err := s.read()
+	if err != nil {
+		return err
+	}
+	if !fn(&doc) {
+		return nil
+	}
+	return s.write(doc)
+}
+
+func (s *sopsStore) Load(id string) (credstore.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	doc, err := s.read()
+	if err != nil {
+		return credstore.Token{}, err
+	}
+	tok, ok := doc.Tokens[id]
+	if !ok {
+		return credstore.Token{}, fmt.Errorf("no token for %s in %s", id, s.path)
+	}
+	return tok, nil
+}
+
+func (s *sopsStore) Save(id string, tok credstore.Token) error {
+	return s.update(func(doc *sopsTokenFile) bool {
+		doc.Tokens[id] = tok
+		return true
+	})
+}
+
+func (s *sopsStore) Delete(id string) error {
+	return s.update(func(doc *sopsTokenFile) bool {
+		if _, ok := doc.Tokens[id]; !ok {
+			return false
+		}
+		delete(doc.Tokens, id)
+		return true
+	})
+}
+
+func (s *sopsStore) String() string {
+	return "sops: " + s.path
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-authgate/sdk-go/credstore"
+)
+
+// fakeSOPS "encrypts" by base64-encoding the plaintext file it is given.
+func fakeSOPS(t *testing.T, path string) func(stdin []byte, args ...string) ([]byte, error) {
+	return func(stdin []byte, args ...string) ([]byte, error) {
+		switch args[0] {
+		case "encrypt":
+			if !slices.Contains(args, "--filename-override") || !slices.Contains(args, path) {
+				t.Errorf("encrypt args %v do not select the token file's creation rule", args)
+			}
+			data, err := os.ReadFile(args[len(args)-1])
+			if err != nil {
+				return nil, err
+			}
+			return []byte(base64.StdEncoding.EncodeToString(data)), nil
+		case "decrypt":
+			data, err := os.ReadFile(args[len(args)-1])
+			if err != nil {
+				return nil, err
+			}
+			return base64.StdEncoding.DecodeString(string(data))
+		}
+		return nil, errors.New("unexpected sops command")
+	}
+}
+
+func TestSOPSStore_SaveLoadDelete(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.sops.json")
+	store := newSOPSStore(path)
+	store.run = fakeSOPS(t, path)
+
+	if _, err := store.Load("cid"); err == nil {
+		t.Error("expected error loading from a missing file")
+	}
+	for _, id := range []string{"cid", "other"} {
+		if err := store.Save(id, credstore.Token{AccessToken: "secret-" + id}); err != nil {
+			t.Fatalf("Save(%q) error: %v", id, err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("secret-")) {
+		t.Errorf("token file contains plaintext: %s", data)
+	}
+	if leftover, _ := filepath.Glob(path + ".*"); len(leftover) > 0 {
+		t.Errorf("temporary or lock files left behind: %v", leftover)
+	}
+
+	if err := store.Delete("cid"); err != nil {
+		t.Fatalf("Delete() error: %v", err)
+	}
+	if _, err := store.Load("cid"); err == nil {
+		t.Error("expected error loading a deleted token")
+	}
+	tok, err := store.Load("other")
+	if err != nil || !strings.HasSuffix(tok.AccessToken, "other") {
+		t.Errorf("Load(other) = %+v, %v", tok, err)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// defaultStateMaxAge is how long a signed state remains acceptable.
+const defaultStateMaxAge = 10 * time.Minute
+
+var (
+	errStateMalformed = errors.New("state is malformed")
+	errStateSignature = errors.New("state signature is invalid")
+	errStateExpired   = errors.New("state has expired")
+)
+
+// statePayload is the return context embedded in a signed state. It lets the
+// callback handler check freshness and tell concurrent logins apart.
+type statePayload struct {
+	Profile  string `json:"p,omitempty"`
+	Command  string `json:"c,omitempty"`
+	IssuedAt int64  `json:"iat"`
+	Nonce    string `json:"n"`
+}
+
+// newStateKey returns a random HMAC key for signing states. The key lives only
+// in memory: states are verified by the same process that issued them.
+func newStateKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate state key: %w", err)
+	}
+	return key, nil
+}
+
+// generateSignedState returns a state of the form
+// BASE64URL(JSON(payload)) "." BASE64URL(HMAC-SHA256(key, encoded payload)).
+// A random nonce is added so the state stays unguessable, and IssuedAt is set
+// from now.
+func generateSignedState(key []byte, payload statePayload, now time.Time) (string, error) {
+	nonce, err := generateState()
+	if err != nil {
+		return "", err
+	}
+	payload.Nonce = nonce
+	payload.IssuedAt = now.Unix()
+
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode state payload: %w", err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(raw)
+	return encoded + "." + signState(key, encoded), nil
+}
+
+// verifySignedState checks the signature and age of a state produced by
+// generateSignedState and returns its payload. maxAge <= 0 disables the age check.
+func verifySignedState(
+	key []byte,
+	state string,
+	maxAge time.Duration,
+	now time.Time,
+) (*statePayload, error) {
+	encoded, sig, ok := strings.Cut(state, ".")
+	if !ok || encoded == "" || sig == "" {
+		return nil, errStateMalformed
+	}
+	if !hmac.Equal([]byte(sig), []byte(signState(key, encoded))) {
+		return nil, errStateSignature
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errStateMalformed
+	}
+	var payload statePayload
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return nil, errStateMalformed
+	}
+
+	if maxAge > 0 && now.Sub(time.Unix(payload.IssuedAt, 0)) > maxAge {
+		return nil, fmt.Errorf("%w (issued %s ago, limit %s)", errStateExpired,
+			now.Sub(time.Unix(payload.IssuedAt, 0)).Round(time.Second), maxAge)
+	}
+	return &payload, nil
+}
+
+func signState(key []byte, encoded string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
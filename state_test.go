@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignedState_RoundTrip(t *testing.T) {
+	key, err := newStateKey()
+	if err != nil {
+		t.Fatalf("newStateKey() error: %v", err)
+	}
+	now := time.Now()
+
+	state, err := generateSignedState(key, statePayload{Profile: "prod", Command: "login"}, now)
+	if err != nil {
+		t.Fatalf("generateSignedState() error: %v", err)
+	}
+	if strings.ContainsAny(state, "+/=") {
+		t.Errorf("state must be URL-safe, got: %s", state)
+	}
+
+	payload, err := verifySignedState(key, state, time.Minute, now.Add(30*time.Second))
+	if err != nil {
+		t.Fatalf("verifySignedState() error: %v", err)
+	}
+	if payload.Profile != "prod" || payload.Command != "login" {
+		t.Errorf("unexpected payload: %+v", payload)
+	}
+	if payload.Nonce == "" {
+		t.Error("expected a random nonce in the payload")
+	}
+}
+
+func TestSignedState_Rejections(t *testing.T) {
+	key, _ := newStateKey()
+	otherKey, _ := newStateKey()
+	now := time.Now()
+	state, err := generateSignedState(key, statePayload{Command: "login"}, now)
+	if err != nil {
+		t.Fatalf("generateSignedState() error: %v", err)
+	}
+	encoded, sig, _ := strings.Cut(state, ".")
+
+	tests := []struct {
+		name    string
+		key     []byte
+		state   string
+		now     time.Time
+		wantErr error
+	}{
+		{"expired", key, state, now.Add(11 * time.Minute), errStateExpired},
+		{"wrong key", otherKey, state, now, errStateSignature},
+		{"tampered payload", key, "e30." + sig, now, errStateSignature},
+		{"missing signature", key, encoded, now, errStateMalformed},
+		{"unsigned random state", key, "abcdefghijklmnop", now, errStateMalformed},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := verifySignedState(tc.key, tc.state, defaultStateMaxAge, tc.now)
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("verifySignedState() error = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
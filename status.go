@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/go-authgate/oauth-cli/tui"
+)
+
+// runStatus implements `oauth-cli status`: it reports the stored token for the
+// current client without contacting the server, rendered with -format if set.
+// It exits 0 when a usable token (valid, or refreshable) is stored and 1
+// otherwise. -diff and -snapshot report on the whole token file instead (see
+// runStatusSnapshot).
+func runStatus(_ context.Context) int {
+	initConfig()
+	if cfg.StatusDiff != "" || cfg.StatusSnapshot != "" {
+		return runStatusSnapshot()
+	}
+
+	tok, err := cfg.TokenStore.Load(tokenKey())
+	if err != nil {
+		fmt.Printf("Not logged in (client %s)\n", cfg.ClientID)
+		return 1
+	}
+
+	if cfg.FormatTemplate != nil {
+		if err := writeFormat(os.Stdout, cfg.FormatTemplate, newStatusView(&tok, clock.Now())); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	} else {
+		writeStatus(os.Stdout, &tok, clock.Now())
+	}
+	if tui.TokenValid(&tok, clock.Now()) || tok.RefreshToken != "" {
+		return 0
+	}
+	return 1
+}
+
+// writeStatus prints a human-readable summary of a stored token. Tokens are
+// identified by their fingerprints, which tokeninfo and revoke accept.
+func writeStatus(w io.Writer, tok *tui.TokenStorage, now time.Time) {
+	fmt.Fprintf(w, "Client:        %s\n", cfg.ClientID)
+	fmt.Fprintf(w, "Server:        %s\n", cfg.ServerURL)
+	if cfg.ReadOnly {
+		fmt.Fprintf(w, "Token store:   %s (read-only)\n", cfg.TokenStoreMode)
+	} else {
+		fmt.Fprintf(w, "Token store:   %s\n", cfg.TokenStoreMode)
+	}
+
+	accessFP := tui.TokenFingerprint(tok.AccessToken)
+	switch {
+	case tok.ExpiresAt.IsZero():
+		fmt.Fprintf(w, "Access token:  valid, does not expire (%s)\n", accessFP)
+	case now.Before(tok.ExpiresAt):
+		fmt.Fprintf(w, "Access token:  valid, expires in %s (%s)\n",
+			tok.ExpiresAt.Sub(now).Round(time.Second), accessFP)
+	default:
+		fmt.Fprintf(w, "Access token:  expired %s ago (%s)\n",
+			now.Sub(tok.ExpiresAt).Round(time.Second), accessFP)
+	}
+
+	if tok.RefreshToken == "" {
+		fmt.Fprintln(w, "Refresh token: none (log in again when the access token expires)")
+		return
+	}
+	fmt.Fprintf(w, "Refresh token: present (%s)\n", tui.TokenFingerprint(tok.RefreshToken))
+	switch sessionKind(tokenKey(), tok) {
+	case "offline":
+		// Offline tokens are not tied to the SSO session and usually carry no
+		// expiry of their own, so a missing refresh expiry is expected here.
+		fmt.Fprintln(w, "Session:       offline (offline_access; survives SSO logout)")
+	case "online":
+		fmt.Fprintln(w, "Session:       online (ends with the SSO session)")
+	default:
+		fmt.Fprintln(w, "Session:       unknown (granted scope not recorded; log in again)")
+	}
+}
+
+// sessionKind classifies the refresh token of tok, stored under key, by what
+// its grant actually got: "offline" when the granted scope includes
+// offline_access, "online" when it does not, and "" when there is no refresh
+// token or the grant is unknown. Without a recorded scope, a Keycloak refresh
+// token's typ claim ("Offline" or "Refresh") decides.
+func sessionKind(key string, tok *tui.TokenStorage) string {
+	if tok.RefreshToken == "" {
+		return ""
+	}
+	if granted, ok := grantedScope(key); ok {
+		if hasScope(granted, offlineAccessScope) {
+			return "offline"
+		}
+		return "online"
+	}
+	if claims, err := decodeJWTClaims(tok.RefreshToken); err == nil {
+		switch claims["typ"] {
+		case "Offline":
+			return "offline"
+		case "Refresh":
+			return "online"
+		}
+	}
+	return ""
+}
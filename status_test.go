@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-authgate/oauth-cli/tui"
+)
+
+func TestWriteStatus(t *testing.T) {
+	setTokenTestConfig(t, "")
+	origScope, origPath := cfg.Scope, grantedScopeState.path
+	t.Cleanup(func() { cfg.Scope, grantedScopeState.path = origScope, origPath })
+	grantedScopeState.path = filepath.Join(t.TempDir(), "granted-scopes.json")
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		granted string // "-" records nothing
+		scope   string
+		tok     tui.TokenStorage
+		want    []string
+	}{
+		{
+			name:    "offline session",
+			granted: "openid offline_access",
+			scope:   "read",
+			tok: tui.TokenStorage{
+				AccessToken: "a", RefreshToken: "r", ExpiresAt: now.Add(time.Hour),
+			},
+			want: []string{
+				"valid, expires in 1h0m0s (sha256:zklycewkdo64)",
+				"Refresh token: present (sha256:ivbutzbc6bjj)",
+				"Session:       offline",
+			},
+		},
+		{
+			// -offline on the status command does not change the grant.
+			name:    "online session",
+			granted: "read write",
+			scope:   "read write offline_access",
+			tok:     tui.TokenStorage{RefreshToken: "r", ExpiresAt: now.Add(-time.Minute)},
+			want:    []string{"expired 1m0s ago", "Session:       online"},
+		},
+		{
+			name:    "unrecorded grant",
+			granted: "-",
+			scope:   "openid offline_access",
+			tok:     tui.TokenStorage{RefreshToken: "r", ExpiresAt: now.Add(time.Minute)},
+			want:    []string{"Session:       unknown"},
+		},
+		{
+			name:    "no refresh token",
+			granted: "-",
+			scope:   "read",
+			tok:     tui.TokenStorage{ExpiresAt: now.Add(time.Minute)},
+			want:    []string{"Refresh token: none"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg.Scope = tc.scope
+			_ = os.Remove(grantedScopeState.path)
+			if tc.granted != "-" {
+				recordGrantedScope(tokenKey(), tc.granted)
+			}
+			var buf bytes.Buffer
+			writeStatus(&buf, &tc.tok, now)
+			for _, want := range tc.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("status output missing %q:\n%s", want, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestWithScope(t *testing.T) {
+	tests := []struct {
+		scopes, add, want string
+	}{
+		{"read write", "offline_access", "read write offline_access"},
+		{"offline_access read", "offline_access", "offline_access read"},
+		{"", "offline_access", "offline_access"},
+	}
+	for _, tc := range tests {
+		if got := withScope(tc.scopes, tc.add); got != tc.want {
+			t.Errorf("withScope(%q, %q) = %q, want %q", tc.scopes, tc.add, got, tc.want)
+		}
+	}
+}
+
+func TestExchangeCode_RecordsGrantedScope(t *testing.T) {
+	grantedResp := `"scope":"openid",`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"granted-access-token",` + grantedResp +
+			`"refresh_token":"refresh","token_type":"Bearer","expires_in":300}`))
+	}))
+	defer srv.Close()
+	setTestServer(t, srv)
+	setTokenTestConfig(t, "")
+	origScope, origPath := cfg.Scope, grantedScopeState.path
+	t.Cleanup(func() { cfg.Scope, grantedScopeState.path = origScope, origPath })
+	grantedScopeState.path = filepath.Join(t.TempDir(), "granted-scopes.json")
+	cfg.Scope = "openid offline_access"
+
+	// The server declined offline_access.
+	storage, err := exchangeCode(context.Background(), "code", "verifier")
+	if err != nil {
+		t.Fatalf("exchangeCode() error: %v", err)
+	}
+	if got := sessionKind(tokenKey(), storage); got != "online" {
+		t.Errorf("sessionKind() = %q, want online", got)
+	}
+
+	// An omitted scope means the requested one was granted.
+	grantedResp = ""
+	if storage, err = exchangeCode(context.Background(), "code", "verifier"); err != nil {
+		t.Fatalf("exchangeCode() error: %v", err)
+	}
+	if got := sessionKind(tokenKey(), storage); got != "offline" {
+		t.Errorf("sessionKind() = %q, want offline", got)
+	}
+}
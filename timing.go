@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/go-authgate/oauth-cli/tui"
+)
+
+// timingRecorder collects per-request HTTP timings when -timing is enabled.
+type timingRecorder struct {
+	mu      sync.Mutex
+	timings []tui.HTTPTiming
+}
+
+func (r *timingRecorder) add(t tui.HTTPTiming) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.timings = append(r.timings, t)
+}
+
+// Timings returns a snapshot of all recorded timings in completion order.
+func (r *timingRecorder) Timings() []tui.HTTPTiming {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]tui.HTTPTiming(nil), r.timings...)
+}
+
+// timingTransport wraps an http.RoundTripper and records DNS, connect, TLS,
+// time-to-first-byte and total durations for every request via httptrace.
+// Each retry attempt is recorded separately.
+type timingTransport struct {
+	base     http.RoundTripper
+	recorder *timingRecorder
+}
+
+func (t *timingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var (
+		mu                            sync.Mutex
+		dnsStart, connStart, tlsStart time.Time
+		dnsDur, connDur, tlsDur, ttfb time.Duration
+		reused                        bool
+	)
+	start := time.Now()
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			mu.Lock()
+			dnsStart = time.Now()
+			mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			mu.Lock()
+			dnsDur = time.Since(dnsStart)
+			mu.Unlock()
+		},
+		ConnectStart: func(string, string) {
+			mu.Lock()
+			connStart = time.Now()
+			mu.Unlock()
+		},
+		ConnectDone: func(string, string, error) {
+			mu.Lock()
+			connDur = time.Since(connStart)
+			mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			mu.Lock()
+			tlsStart = time.Now()
+			mu.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			mu.Lock()
+			tlsDur = time.Since(tlsStart)
+			mu.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			mu.Lock()
+			reused = info.Reused
+			mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			mu.Lock()
+			ttfb = time.Since(start)
+			mu.Unlock()
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	record := func(status int) {
+		mu.Lock()
+		defer mu.Unlock()
+		t.recorder.add(tui.HTTPTiming{
+			Label:   req.Method + " " + req.URL.Path,
+			Status:  status,
+			Reused:  reused,
+			DNS:     dnsDur,
+			Connect: connDur,
+			TLS:     tlsDur,
+			TTFB:    ttfb,
+			Total:   time.Since(start),
+		})
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		record(0)
+		return nil, err
+	}
+	// Total includes reading the body, so finalize when the caller closes it.
+	resp.Body = &timedBody{ReadCloser: resp.Body, done: func() { record(resp.StatusCode) }}
+	return resp, nil
+}
+
+// timedBody invokes done exactly once when the response body is closed.
+type timedBody struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (b *timedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+	return err
+}
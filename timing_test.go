@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTimingTransport_RecordsRequests(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	recorder := &timingRecorder{}
+	client := &http.Client{
+		Transport: &timingTransport{base: http.DefaultTransport, recorder: recorder},
+	}
+
+	for range 2 {
+		resp, err := client.Get(srv.URL + "/oauth/tokeninfo")
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	timings := recorder.Timings()
+	if len(timings) != 2 {
+		t.Fatalf("expected 2 timings, got %d", len(timings))
+	}
+	for i, tm := range timings {
+		if tm.Label != "GET /oauth/tokeninfo" {
+			t.Errorf("timing %d: label = %q", i, tm.Label)
+		}
+		if tm.Status != http.StatusOK {
+			t.Errorf("timing %d: status = %d, want 200", i, tm.Status)
+		}
+		if tm.Total <= 0 || tm.TTFB <= 0 || tm.TTFB > tm.Total {
+			t.Errorf("timing %d: implausible durations %+v", i, tm)
+		}
+	}
+	if timings[0].Reused {
+		t.Error("first request should not reuse a connection")
+	}
+	if !timings[1].Reused {
+		t.Error("second request should reuse the keep-alive connection")
+	}
+}
+
+func TestTimingTransport_RecordsFailures(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close() // closed server: connection refused
+
+	recorder := &timingRecorder{}
+	client := &http.Client{
+		Transport: &timingTransport{base: http.DefaultTransport, recorder: recorder},
+	}
+	if _, err := client.Get(srv.URL); err == nil {
+		t.Fatal("expected connection error")
+	}
+
+	timings := recorder.Timings()
+	if len(timings) != 1 || timings[0].Status != 0 {
+		t.Errorf("expected one failed timing, got %+v", timings)
+	}
+}
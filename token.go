@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-authgate/oauth-cli/tui"
+)
+
+// tokenKey returns the token store key for the current configuration. Tokens
+// requested for a specific audience or resource (RFC 8707) are cached in
+// separate entries next to the client's base token, so each downstream API
+// keeps its own access token.
+func tokenKey() string {
+	return audienceTokenKey(cfg.ClientID, cfg.Audience, cfg.Resource)
+}
+
+func audienceTokenKey(cid, aud, res string) string {
+	key := cid
+	if aud != "" {
+		key += "#aud=" + aud
+	}
+	if res != "" {
+		key += "#res=" + res
+	}
+	return key
+}
+
+// credentialTargetPrefix returns the "authgate:<server host>/" prefix that
+// external credential stores put in front of token keys, so tokens for the
+// same client on different servers do not collide.
+func credentialTargetPrefix(serverURL string) string {
+	return "authgate:" + serverHost(serverURL) + "/"
+}
+
+// serverHost returns the host[:port] of serverURL, or serverURL itself when
+// it has none. For a unix:// server it is "unix" followed by the socket path,
+// so servers on different sockets get different keys.
+func serverHost(serverURL string) string {
+	if u, err := url.Parse(serverURL); err == nil && u.Host != "" {
+		if u.Host == unixSocketHost && cfg.ServerSocket != "" {
+			return "unix" + cfg.ServerSocket
+		}
+		return u.Host
+	}
+	return serverURL
+}
+
+// setAudienceParams adds the audience and resource (RFC 8707) parameters to
+// an authorization or token request when they are configured. Providers that
+// express the audience through the scope (Azure AD) get no extra parameters.
+func setAudienceParams(params url.Values) {
+	if activeProvider.audienceAsScope {
+		return
+	}
+	if cfg.Audience != "" {
+		params.Set("audience", cfg.Audience)
+	}
+	if cfg.Resource != "" {
+		params.Set("resource", cfg.Resource)
+	}
+}
+
+// runToken implements `oauth-cli token`: it prints a valid access token for the
+// configured audience/resource to stdout, or the token rendered with -format.
+// A cached token is refreshed when expired; if no token exists for the
+// audience yet, one is minted from the client's base refresh token without
+// opening the browser.
+func runToken(ctx context.Context) int {
+	initConfig()
+
+	storage, err := tokenForAudience(ctx)
+	if err != nil {
+		auditLog.record("export", "token command", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if cfg.FormatTemplate != nil {
+		err = writeFormat(os.Stdout, cfg.FormatTemplate, storage)
+	} else {
+		fmt.Println(storage.AccessToken)
+	}
+	auditLog.record("export", "token command", err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// tokenForAudience returns a valid token for tokenKey(), refreshing or minting
+// it as needed and persisting the result. Valid tokens are served from the
+// in-process cache after the first call.
+func tokenForAudience(ctx context.Context) (*tui.TokenStorage, error) {
+	key := tokenKey()
+	return memTokens.Token(ctx, key, func(ctx context.Context) (*tui.TokenStorage, error) {
+		return loadTokenForAudience(ctx, key)
+	})
+}
+
+// loadTokenForAudience reads the token for key from the store, refreshing or
+// minting it when it is no longer valid. A token within cfg.RefreshBefore of
+// expiry is refreshed proactively; if that fails while it is still valid, it
+// is returned anyway and the next refresh is deferred with backoff.
+func loadTokenForAudience(ctx context.Context, key string) (*tui.TokenStorage, error) {
+	if tok, err := cfg.TokenStore.Load(key); err == nil {
+		now := clock.Now()
+		if tui.TokenValid(&tok, now.Add(cfg.RefreshBefore)) {
+			return &tok, nil
+		}
+		stillValid := tui.TokenValid(&tok, now)
+		if stillValid && (tok.RefreshToken == "" || !refreshBackoff.due(key, now)) {
+			return &tok, nil
+		}
+		if tok.RefreshToken != "" {
+			storage, err := refreshAndSave(ctx, key, tok.RefreshToken)
+			if err == nil {
+				refreshBackoff.succeeded(key)
+				return storage, nil
+			}
+			if stillValid && ctx.Err() == nil {
+				retryIn := refreshBackoff.failed(key, clock.Now())
+				fmt.Fprintf(os.Stderr,
+					"Warning: refresh failed (%v); using the current token, which expires in %s "+
+						"(next refresh attempt in %s)\n",
+					err, tok.ExpiresAt.Sub(now).Round(time.Second), retryIn)
+				return &tok, nil
+			}
+			if !errors.Is(err, tui.ErrRefreshTokenExpired) {
+				return nil, fmt.Errorf("refresh failed: %w", err)
+			}
+		}
+	}
+
+	if key == cfg.ClientID {
+		return nil, errors.New("no valid token found; run oauth-cli to log in first")
+	}
+	return mintAudienceToken(ctx, key)
+}
+
+// Bounds of the delay between proactive refresh attempts after a failure.
+const (
+	minRefreshBackoff = 5 * time.Second
+	maxRefreshBackoff = 5 * time.Minute
+)
+
+// refreshBackoff tracks, per token key, when a proactive refresh that failed
+// may be retried. The delay doubles with each consecutive failure.
+var refreshBackoff = &refreshSchedule{}
+
+type refreshSchedule struct {
+	mu    sync.Mutex
+	next  map[string]time.Time
+	delay map[string]time.Duration
+}
+
+// due reports whether a proactive refresh of key may be attempted at now.
+func (s *refreshSchedule) due(key string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !now.Before(s.next[key])
+}
+
+// failed records a failed refresh of key and returns the delay until the
+// next attempt.
+func (s *refreshSchedule) failed(key string, now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.next == nil {
+		s.next = make(map[string]time.Time)
+		s.delay = make(map[string]time.Duration)
+	}
+	d := min(max(2*s.delay[key], minRefreshBackoff), maxRefreshBackoff)
+	s.delay[key] = d
+	s.next[key] = now.Add(d)
+	return d
+}
+
+// succeeded clears the backoff of key.
+func (s *refreshSchedule) succeeded(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.next, key)
+	delete(s.delay, key)
+}
+
+// mintAudienceToken uses the client's base refresh token to obtain a token for
+// the configured audience/resource. If the server rotates the refresh token,
+// the base entry and its other audience entries are updated too so they are
+// not left holding a revoked one.
+func mintAudienceToken(ctx context.Context, key string) (*tui.TokenStorage, error) {
+	if cfg.ReadOnly {
+		return nil, errReadOnly
+	}
+	base, err := cfg.TokenStore.Load(cfg.ClientID)
+	if err != nil || base.RefreshToken == "" {
+		return nil, errors.New(
+			"no refresh token available to mint an audience-specific token; " +
+				"run oauth-cli to log in first")
+	}
+
+	storage, err := refreshAccessTokenScope(ctx, cfg.ClientID, base.RefreshToken, "")
+	if err != nil {
+		if errors.Is(err, tui.ErrRefreshTokenExpired) {
+			return nil, errors.New("refresh token expired; run oauth-cli to log in again")
+		}
+		return nil, fmt.Errorf("failed to mint token for audience: %w", err)
+	}
+
+	if err := cfg.TokenStore.Save(key, *storage); err != nil {
+		return nil, fmt.Errorf("failed to save token: %w", err)
+	}
+	if err := shareRotatedRefreshToken(base.RefreshToken, storage.RefreshToken, key); err != nil {
+		return nil, err
+	}
+	return storage, nil
+}
+
+// shareRotatedRefreshToken replaces oldRT with newRT in every stored entry of
+// the client that still holds it, except skip (already saved by the caller).
+// Audience and resource entries keep a copy of the base refresh token they
+// were minted from, so when refreshing any one of them makes the server
+// rotate it, the others would otherwise be left with a revoked token.
+func shareRotatedRefreshToken(oldRT, newRT, skip string) error {
+	if newRT == "" || newRT == oldRT {
+		return nil
+	}
+	for _, key := range clientTokenKeys(cfg.ClientID) {
+		if key == skip {
+			continue
+		}
+		tok, err := cfg.TokenStore.Load(key)
+		if err != nil || tok.RefreshToken != oldRT {
+			continue
+		}
+		tok.RefreshToken = newRT
+		if err := cfg.TokenStore.Save(key, tok); err != nil {
+			return fmt.Errorf("failed to save rotated refresh token: %w", err)
+		}
+	}
+	return nil
+}
+
+// errRefreshNotSaved wraps a token store failure after a successful refresh.
+// refreshAndSave still returns the new token alongside it.
+var errRefreshNotSaved = errors.New("failed to save refreshed token")
+
+// refreshAndSave refreshes the access token and persists the result under key
+// before returning it. Every refresh that replaces a stored token goes through
+// here: a server that rotates refresh tokens invalidates the old one as soon
+// as it answers, so the new pair is saved before the caller can be cancelled
+// or fail, and the other entries of the client holding the old refresh token
+// get the new one. The saves do not depend on ctx.
+func refreshAndSave(ctx context.Context, key, refreshToken string) (*tui.TokenStorage, error) {
+	if cfg.ReadOnly {
+		return nil, errReadOnly
+	}
+	storage, err := refreshAccessTokenScope(ctx, key, refreshToken, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.TokenStore.Save(key, *storage); err != nil {
+		return storage, fmt.Errorf("%w: %w", errRefreshNotSaved, err)
+	}
+	if err := shareRotatedRefreshToken(refreshToken, storage.RefreshToken, key); err != nil {
+		return storage, fmt.Errorf("%w: %w", errRefreshNotSaved, err)
+	}
+	return storage, nil
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	retry "github.com/appleboy/go-httpretry"
+	"github.com/go-authgate/oauth-cli/tui"
+	"github.com/go-authgate/sdk-go/credstore"
+)
+
+func TestAudienceTokenKey(t *testing.T) {
+	tests := []struct {
+		aud, res string
+		want     string
+	}{
+		{"", "", "cid"},
+		{"api://orders", "", "cid#aud=api://orders"},
+		{"", "https://api.example.com", "cid#res=https://api.example.com"},
+		{"a", "r", "cid#aud=a#res=r"},
+	}
+	for _, tc := range tests {
+		if got := audienceTokenKey("cid", tc.aud, tc.res); got != tc.want {
+			t.Errorf("audienceTokenKey(%q, %q) = %q, want %q", tc.aud, tc.res, got, tc.want)
+		}
+	}
+}
+
+// setTokenTestConfig installs a file token store and audience for the test.
+func setTokenTestConfig(t *testing.T, aud string) {
+	t.Helper()
+	origStore, origClientID, origAudience := cfg.TokenStore, cfg.ClientID, cfg.Audience
+	origResource, origSecret, origCache := cfg.Resource, cfg.ClientSecret, memTokens
+	t.Cleanup(func() {
+		cfg.TokenStore, cfg.ClientID, cfg.Audience = origStore, origClientID, origAudience
+		cfg.Resource, cfg.ClientSecret, memTokens = origResource, origSecret, origCache
+	})
+	memTokens = newTokenCache()
+	cfg.TokenStore = credstore.NewTokenFileStore(filepath.Join(t.TempDir(), "tokens.json"))
+	cfg.ClientID = "test-client"
+	cfg.Audience = aud
+	cfg.Resource = ""
+	cfg.ClientSecret = ""
+}
+
+func TestTokenForAudience_MintsFromBaseRefreshToken(t *testing.T) {
+	var gotAudience, gotRefresh string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		gotAudience = r.PostForm.Get("audience")
+		gotRefresh = r.PostForm.Get("refresh_token")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"audience-access-token","refresh_token":"rotated-refresh",` +
+			`"token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer srv.Close()
+	setTestServer(t, srv)
+	setTokenTestConfig(t, "api://orders")
+
+	if err := cfg.TokenStore.Save("test-client", credstore.Token{
+		AccessToken:  "base-access-token",
+		RefreshToken: "base-refresh",
+		TokenType:    "Bearer",
+		ExpiresAt:    time.Now().Add(time.Hour),
+		ClientID:     "test-client",
+	}); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	storage, err := tokenForAudience(context.Background())
+	if err != nil {
+		t.Fatalf("tokenForAudience() error: %v", err)
+	}
+	if storage.AccessToken != "audience-access-token" {
+		t.Errorf("AccessToken = %q", storage.AccessToken)
+	}
+	if gotAudience != "api://orders" || gotRefresh != "base-refresh" {
+		t.Errorf("refresh request audience=%q refresh_token=%q", gotAudience, gotRefresh)
+	}
+
+	cached, err := cfg.TokenStore.Load("test-client#aud=api://orders")
+	if err != nil || cached.AccessToken != "audience-access-token" {
+		t.Errorf("audience token not cached: %+v, %v", cached, err)
+	}
+	base, _ := cfg.TokenStore.Load("test-client")
+	if base.RefreshToken != "rotated-refresh" {
+		t.Errorf("base refresh token = %q, want rotated-refresh", base.RefreshToken)
+	}
+}
+
+func TestTokenForAudience_RefreshSharesRotatedToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if got := r.PostForm.Get("refresh_token"); got != "shared-refresh" {
+			t.Errorf("refresh_token = %q, want shared-refresh", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"new-orders-token","refresh_token":"rotated-refresh",` +
+			`"token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer srv.Close()
+	setTestServer(t, srv)
+	setTokenTestConfig(t, "api://orders")
+	origFile := cfg.TokenFile
+	t.Cleanup(func() { cfg.TokenFile = origFile })
+	cfg.TokenFile = filepath.Join(t.TempDir(), "tokens.json")
+	cfg.TokenStore = credstore.NewTokenFileStore(cfg.TokenFile)
+
+	entries := map[string]credstore.Token{
+		"test-client": {
+			AccessToken: "base-access", RefreshToken: "shared-refresh",
+			ExpiresAt: time.Now().Add(time.Hour),
+		},
+		"test-client#aud=api://orders": {
+			AccessToken: "expired-orders-token", RefreshToken: "shared-refresh",
+			ExpiresAt: time.Now().Add(-time.Minute),
+		},
+		"test-client#aud=api://billing": {
+			AccessToken: "billing-access", RefreshToken: "shared-refresh",
+			ExpiresAt: time.Now().Add(time.Hour),
+		},
+	}
+	for key, tok := range entries {
+		if err := cfg.TokenStore.Save(key, tok); err != nil {
+			t.Fatalf("Save(%q) error: %v", key, err)
+		}
+	}
+
+	storage, err := loadTokenForAudience(context.Background(), "test-client#aud=api://orders")
+	if err != nil || storage.AccessToken != "new-orders-token" {
+		t.Fatalf("loadTokenForAudience() = %+v, %v", storage, err)
+	}
+	for key := range entries {
+		tok, err := cfg.TokenStore.Load(key)
+		if err != nil || tok.RefreshToken != "rotated-refresh" {
+			t.Errorf("%s refresh token = %q, %v; want rotated-refresh", key, tok.RefreshToken, err)
+		}
+	}
+}
+
+func TestTokenForAudience_UsesCachedToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		t.Error("no HTTP request expected for a valid cached token")
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	setTestServer(t, srv)
+	setTokenTestConfig(t, "api://orders")
+
+	if err := cfg.TokenStore.Save("test-client#aud=api://orders", credstore.Token{
+		AccessToken: "cached-audience-token",
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	storage, err := tokenForAudience(context.Background())
+	if err != nil {
+		t.Fatalf("tokenForAudience() error: %v", err)
+	}
+	if storage.AccessToken != "cached-audience-token" {
+		t.Errorf("AccessToken = %q", storage.AccessToken)
+	}
+}
+
+func TestTokenForAudience_NoBaseToken(t *testing.T) {
+	setTokenTestConfig(t, "api://orders")
+
+	if _, err := tokenForAudience(context.Background()); err == nil {
+		t.Error("expected error when no base token exists")
+	}
+}
+
+// TestMakeAPICallWithAutoRefresh_PersistsRotatedToken verifies that a refresh
+// triggered by a 401 saves the rotated refresh token before the API call is
+// retried.
+func TestMakeAPICallWithAutoRefresh_PersistsRotatedToken(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/tokeninfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer refreshed-access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"active":true}`))
+	})
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"refreshed-access-token",` +
+			`"refresh_token":"rotated-refresh","token_type":"Bearer","expires_in":3600}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	setTestServer(t, srv)
+	setTokenTestConfig(t, "")
+
+	storage := &credstore.Token{
+		AccessToken:  "stale-access-token",
+		RefreshToken: "old-refresh",
+		ExpiresAt:    time.Now().Add(time.Hour),
+	}
+	if err := makeAPICallWithAutoRefresh(context.Background(), storage); err != nil {
+		t.Fatalf("makeAPICallWithAutoRefresh() error: %v", err)
+	}
+	if storage.RefreshToken != "rotated-refresh" {
+		t.Errorf("in-memory RefreshToken = %q, want rotated-refresh", storage.RefreshToken)
+	}
+	saved, err := cfg.TokenStore.Load("test-client")
+	if err != nil || saved.RefreshToken != "rotated-refresh" {
+		t.Errorf("rotated refresh token not persisted: %+v, %v", saved, err)
+	}
+}
+
+func TestTokenForAudience_ReadOnly(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		t.Error("no refresh request expected in read-only mode")
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	setTestServer(t, srv)
+	setTokenTestConfig(t, "")
+
+	if err := cfg.TokenStore.Save("test-client", credstore.Token{
+		AccessToken:  "expired-access-token",
+		RefreshToken: "refresh",
+		ExpiresAt:    time.Now().Add(-time.Minute),
+	}); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	origReadOnly := cfg.ReadOnly
+	t.Cleanup(func() { cfg.ReadOnly = origReadOnly })
+	cfg.ReadOnly = true
+	cfg.TokenStore = readOnlyStore{Store: cfg.TokenStore}
+
+	if _, err := tokenForAudience(context.Background()); !errors.Is(err, errReadOnly) {
+		t.Errorf("tokenForAudience() error = %v, want errReadOnly", err)
+	}
+	if err := cfg.TokenStore.Save("test-client", credstore.Token{}); !errors.Is(err, errReadOnly) {
+		t.Errorf("Save() error = %v, want errReadOnly", err)
+	}
+}
+
+func TestTokenForAudience_EarlyRefreshFailureKeepsValidToken(t *testing.T) {
+	var refreshes int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		refreshes++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	setTestServer(t, srv)
+	setTokenTestConfig(t, "")
+	origBefore, origBackoff := cfg.RefreshBefore, refreshBackoff
+	t.Cleanup(func() { cfg.RefreshBefore, refreshBackoff = origBefore, origBackoff })
+	cfg.RefreshBefore, refreshBackoff = 5*time.Minute, &refreshSchedule{}
+
+	if err := cfg.TokenStore.Save("test-client", credstore.Token{
+		AccessToken:  "expiring-access-token",
+		RefreshToken: "refresh",
+		ExpiresAt:    time.Now().Add(time.Minute),
+	}); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	for range 2 {
+		tok, err := loadTokenForAudience(context.Background(), "test-client")
+		if err != nil || tok.AccessToken != "expiring-access-token" {
+			t.Fatalf("loadTokenForAudience() = %+v, %v; want the still-valid token", tok, err)
+		}
+	}
+	// The second call falls within the backoff and must not refresh again.
+	if refreshes != 1 {
+		t.Errorf("refresh requests = %d, want 1", refreshes)
+	}
+}
+
+func TestServerUnreachableErrors(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	setTestServer(t, srv)
+	setTokenTestConfig(t, "")
+	srv.Close()
+
+	ctx := context.Background()
+	if _, err := verifyToken(ctx, "some-access-token"); !errors.Is(err, tui.ErrServerUnreachable) {
+		t.Errorf("verifyToken() error = %v, want ErrServerUnreachable", err)
+	}
+	if _, err := refreshAccessToken(ctx, "some-refresh"); !errors.Is(err, tui.ErrServerUnreachable) {
+		t.Errorf("refreshAccessToken() error = %v, want ErrServerUnreachable", err)
+	}
+
+	// A server that answers, even with an error, is reachable.
+	live := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_request"}`))
+	}))
+	defer live.Close()
+	setTestServer(t, live)
+	if _, err := verifyToken(ctx, "other-access-token"); err == nil ||
+		errors.Is(err, tui.ErrServerUnreachable) {
+		t.Errorf("verifyToken() against a live server error = %v", err)
+	}
+}
+
+func TestServerUnreachable_OnlyTransportErrors(t *testing.T) {
+	refused := &url.Error{Op: "Post", URL: "http://x", Err: syscall.ECONNREFUSED}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"connection refused", refused, true},
+		{"retries exhausted", &retry.RetryError{Attempts: 3, LastStatus: 503}, true},
+		{"failover", errors.Join(fmt.Errorf("http://x: %w", refused)), true},
+		{"request not built", fmt.Errorf("failed to create request: %w", errors.New("bad")), false},
+		{"breaker open", fmt.Errorf("%w: paused", errTokenEndpointDegraded), false},
+	}
+	for _, tt := range tests {
+		if got := errors.Is(serverUnreachable(tt.err), tui.ErrServerUnreachable); got != tt.want {
+			t.Errorf("%s: serverUnreachable() unreachable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMissingTokenInfoEndpoint(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	setTestServer(t, srv)
+	setTokenTestConfig(t, "")
+	orig := cfg.StrictChecks
+	t.Cleanup(func() { cfg.StrictChecks = orig })
+
+	ctx := context.Background()
+	storage := &credstore.Token{AccessToken: "some-access-token", ExpiresAt: time.Now().Add(time.Hour)}
+	cfg.StrictChecks = false
+	if _, err := verifyToken(ctx, storage.AccessToken); !errors.Is(err, tui.ErrNotSupported) {
+		t.Errorf("verifyToken() error = %v, want ErrNotSupported", err)
+	}
+	if err := makeAPICallWithAutoRefresh(ctx, storage); !errors.Is(err, tui.ErrNotSupported) {
+		t.Errorf("makeAPICallWithAutoRefresh() error = %v, want ErrNotSupported", err)
+	}
+
+	cfg.StrictChecks = true
+	if _, err := verifyToken(ctx, "other-access-token"); err == nil || errors.Is(err, tui.ErrNotSupported) {
+		t.Errorf("strict verifyToken() error = %v, want a failure", err)
+	}
+	if err := makeAPICallWithAutoRefresh(ctx, storage); err == nil || errors.Is(err, tui.ErrNotSupported) {
+		t.Errorf("strict makeAPICallWithAutoRefresh() error = %v, want a failure", err)
+	}
+}
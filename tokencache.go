@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-authgate/oauth-cli/tui"
+	"golang.org/x/sync/singleflight"
+)
+
+// tokenCache is an in-process cache in front of cfg.TokenStore for code that
+// requests tokens concurrently (parallel API calls, embedders of this
+// package). Valid tokens are served from memory without reading the store,
+// and concurrent loads or refreshes of the same key are collapsed with
+// singleflight, so hundreds of callers cause at most one refresh and one
+// store write.
+//
+// A collapsed call runs with the context of the caller that started it; if
+// that caller is cancelled, the callers waiting on it see the same error.
+type tokenCache struct {
+	mu     sync.Mutex
+	tokens map[string]tui.TokenStorage
+	group  singleflight.Group
+}
+
+// memTokens is the process-wide token cache.
+var memTokens = newTokenCache()
+
+func newTokenCache() *tokenCache {
+	return &tokenCache{tokens: make(map[string]tui.TokenStorage)}
+}
+
+// get returns the cached token for key if it is still valid.
+func (c *tokenCache) get(key string) (*tui.TokenStorage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tok, ok := c.tokens[key]
+	if !ok || !tui.TokenValid(&tok, clock.Now().Add(cfg.RefreshBefore)) {
+		return nil, false
+	}
+	return &tok, true
+}
+
+func (c *tokenCache) put(key string, tok *tui.TokenStorage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens[key] = *tok
+}
+
+// Token returns a valid token for key, calling load (which may read the
+// store, refresh and save) only when the cache has none.
+func (c *tokenCache) Token(
+	ctx context.Context,
+	key string,
+	load func(context.Context) (*tui.TokenStorage, error),
+) (*tui.TokenStorage, error) {
+	if tok, ok := c.get(key); ok {
+		return tok, nil
+	}
+	v, err, _ := c.group.Do("load\x00"+key, func() (any, error) {
+		if tok, ok := c.get(key); ok {
+			return tok, nil
+		}
+		tok, err := load(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.put(key, tok)
+		return tok, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	tok := *v.(*tui.TokenStorage)
+	return &tok, nil
+}
+
+// Refresh replaces the token for key using refreshToken and persists it via
+// refreshAndSave. If another caller has already rotated refreshToken, the
+// token it obtained is returned instead of refreshing with the stale one,
+// which a rotating server would reject.
+func (c *tokenCache) Refresh(
+	ctx context.Context,
+	key, refreshToken string,
+) (*tui.TokenStorage, error) {
+	v, err, _ := c.group.Do("refresh\x00"+key, func() (any, error) {
+		if tok, ok := c.get(key); ok && tok.RefreshToken != refreshToken {
+			return tok, nil
+		}
+		tok, err := refreshAndSave(ctx, key, refreshToken)
+		if tok == nil {
+			return nil, err
+		}
+		c.put(key, tok)
+		return tok, err
+	})
+	if v == nil {
+		return nil, err
+	}
+	tok := *v.(*tui.TokenStorage)
+	return &tok, err
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-authgate/oauth-cli/tui"
+)
+
+func TestTokenCache_ConcurrentRefreshCollapses(t *testing.T) {
+	var refreshes atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.PostForm.Get("refresh_token") != "old-refresh" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		refreshes.Add(1)
+		time.Sleep(50 * time.Millisecond) // keep the flight open for all callers
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"refreshed-access-token",` +
+			`"refresh_token":"rotated-refresh","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer srv.Close()
+	setTestServer(t, srv)
+	setTokenTestConfig(t, "")
+
+	const callers = 100
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for range callers {
+		wg.Go(func() {
+			tok, err := memTokens.Refresh(context.Background(), "test-client", "old-refresh")
+			if err == nil && tok.AccessToken != "refreshed-access-token" {
+				t.Errorf("AccessToken = %q", tok.AccessToken)
+			}
+			errs <- err
+		})
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Refresh() error: %v", err)
+		}
+	}
+
+	// A late caller still holding the rotated-away refresh token gets the
+	// cached result instead of a rejected refresh.
+	if _, err := memTokens.Refresh(context.Background(), "test-client", "old-refresh"); err != nil {
+		t.Errorf("late Refresh() error: %v", err)
+	}
+	if n := refreshes.Load(); n != 1 {
+		t.Errorf("refresh requests = %d, want 1", n)
+	}
+}
+
+func TestTokenCache_TokenServesFromMemory(t *testing.T) {
+	cache := newTokenCache()
+	var loads atomic.Int32
+	load := func(context.Context) (*tui.TokenStorage, error) {
+		loads.Add(1)
+		return &tui.TokenStorage{AccessToken: "a", ExpiresAt: time.Now().Add(time.Hour)}, nil
+	}
+	for range 10 {
+		if _, err := cache.Token(context.Background(), "k", load); err != nil {
+			t.Fatalf("Token() error: %v", err)
+		}
+	}
+	if n := loads.Load(); n != 1 {
+		t.Errorf("loads = %d, want 1", n)
+	}
+}
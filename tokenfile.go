@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-authgate/sdk-go/credstore"
+)
+
+// canonicalTokenPath returns path as an absolute path with symlinks resolved,
+// so processes that name the same token file differently (relative to other
+// working directories, or through a symlink) lock and back up the same file.
+// When the file does not exist yet its directory is resolved instead; when
+// neither exists the absolute path is used as is.
+func canonicalTokenPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved, nil
+	}
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(abs)); err == nil {
+		return filepath.Join(dir, filepath.Base(abs)), nil
+	}
+	return abs, nil
+}
+
+// backupFileStore wraps the file-backed token store with crash safety: the
+// token file is fsynced after every write, the previous version is kept as
+// <file>.bak, and a token file that is no longer valid JSON (e.g. truncated by
+// a power loss) is restored from the backup before it is read. Without a
+// usable backup the corrupt file is quarantined, so the run continues with an
+// empty store (a fresh login) instead of failing on every access.
+//
+// Loads take a fast path: entries are decoded from the file one at a time,
+// stopping at the requested key, and kept in memory until the file's size,
+// mtime or inode changes. The inode catches another process replacing the
+// file by rename within the mtime granularity. Only when that fails is the
+// wrapped store asked.
+type backupFileStore struct {
+	credstore.Store[credstore.Token]
+	path string
+
+	mu      sync.Mutex
+	stamp   os.FileInfo // token file version the entries were read from
+	entries map[string]credstore.Token
+}
+
+// withFileBackup wraps store when it persists tokens to path. Keyring-backed
+// stores are returned unchanged.
+func withFileBackup(
+	store credstore.Store[credstore.Token],
+	path string,
+) credstore.Store[credstore.Token] {
+	switch s := store.(type) {
+	case *credstore.FileStore[credstore.Token]:
+	case *credstore.SecureStore[credstore.Token]:
+		if s.UseKeyring() {
+			return store
+		}
+	default:
+		return store
+	}
+	return &backupFileStore{Store: store, path: path}
+}
+
+func (s *backupFileStore) Load(id string) (credstore.Token, error) {
+	if tok, ok := s.loadFast(id); ok {
+		return tok, nil
+	}
+	s.recover()
+	return s.Store.Load(id)
+}
+
+// sameVersion reports whether a and b describe the same version of a file:
+// the same file (device and inode, or volume and file index on Windows),
+// size and mtime.
+func sameVersion(a, b os.FileInfo) bool {
+	return a != nil && b != nil && os.SameFile(a, b) &&
+		a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
+
+// loadFast returns the entry for id from the load cache or by streaming the
+// token file up to that entry.
+func (s *backupFileStore) loadFast(id string) (credstore.Token, bool) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return credstore.Token{}, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !sameVersion(info, s.stamp) {
+		s.stamp = info
+		s.entries = make(map[string]credstore.Token)
+	}
+	if tok, ok := s.entries[id]; ok {
+		return tok, true
+	}
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		return credstore.Token{}, false
+	}
+	defer f.Close()
+	var found *credstore.Token
+	_ = walkTokenEntries(bufio.NewReader(f), func(key string, tok credstore.Token) bool {
+		if key != id {
+			return true
+		}
+		found = &tok
+		return false
+	})
+	if found == nil {
+		return credstore.Token{}, false
+	}
+	s.entries[id] = *found
+	return *found, true
+}
+
+// invalidate drops the load cache after a write through this store.
+func (s *backupFileStore) invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stamp = nil
+	s.entries = nil
+}
+
+func (s *backupFileStore) Save(id string, tok credstore.Token) error {
+	defer s.invalidate()
+	s.recover()
+	if err := s.backup(); err != nil {
+		return fmt.Errorf("failed to back up token file: %w", err)
+	}
+	if err := s.Store.Save(id, tok); err != nil {
+		return err
+	}
+	return syncFile(s.path)
+}
+
+func (s *backupFileStore) Delete(id string) error {
+	defer s.invalidate()
+	s.recover()
+	if err := s.backup(); err != nil {
+		return fmt.Errorf("failed to back up token file: %w", err)
+	}
+	if err := s.Store.Delete(id); err != nil {
+		return err
+	}
+	return syncFile(s.path)
+}
+
+// backupPath returns the location of the previous token file version.
+func (s *backupFileStore) backupPath() string {
+	return s.path + ".bak"
+}
+
+// backup copies the current token file to backupPath, unless it is missing or
+// corrupt (a corrupt file must never replace a good backup).
+func (s *backupFileStore) backup() error {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !json.Valid(data) {
+		return nil
+	}
+	return writeFileSync(s.backupPath(), data)
+}
+
+// recover handles a token file that exists but is not valid JSON: it is
+// restored from the backup when that is valid, and quarantined otherwise.
+func (s *backupFileStore) recover() {
+	data, err := os.ReadFile(s.path)
+	if err != nil || json.Valid(data) {
+		return
+	}
+	if backup, err := os.ReadFile(s.backupPath()); err == nil && json.Valid(backup) {
+		if err := writeFileSync(s.path, backup); err == nil {
+			fmt.Fprintf(os.Stderr, "Warning: token file %s was corrupt; restored from %s\n",
+				s.path, s.backupPath())
+			return
+		}
+	}
+	dest, err := quarantineTokenFile(s.path, clock.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: token file %s is corrupt and could not be moved aside: %v\n",
+			s.path, err)
+		return
+	}
+	fmt.Fprintf(os.Stderr,
+		"Warning: token file %s was corrupt; moved to %s. "+
+			"Run 'oauth-cli tokens repair' to recover intact entries.\n",
+		s.path, dest)
+}
+
+// quarantineSuffix separates a quarantined token file's name from its timestamp.
+const quarantineSuffix = ".corrupt-"
+
+// quarantineTokenFile renames a corrupt token file to
+// <file>.corrupt-<UTC timestamp> and returns the new path.
+func quarantineTokenFile(path string, now time.Time) (string, error) {
+	dest := path + quarantineSuffix + now.UTC().Format("20060102T150405Z")
+	if err := os.Rename(path, dest); err != nil {
+		return "", err
+	}
+	return dest, syncDir(filepath.Dir(path))
+}
+
+// writeFileSync atomically replaces path with data: the data is written to a
+// temp file in the same directory and fsynced, renamed over path, and the
+// directory is fsynced so the rename survives a power loss.
+func writeFileSync(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // no-op after a successful rename
+
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncFile flushes path and its directory to stable storage.
+func syncFile(path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir fsyncs a directory so renames inside it are durable. Platforms that
+// cannot sync directories (Windows) report an error that is ignored.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	_ = d.Sync()
+	return nil
+}
+
+// errMalformedTokenFile is returned by walkTokenEntries for input that is not
+// the {"tokens": {<key>: {...}}} token file layout.
+var errMalformedTokenFile = errors.New("malformed token file")
+
+// walkTokenEntries decodes the {"tokens": {<key>: {...}}} token file layout
+// one entry at a time, calling fn for each entry that has a token, and stops
+// early when fn returns false. It returns an error at the first malformed or
+// truncated entry; entries before it have already been passed to fn.
+func walkTokenEntries(r io.Reader, fn func(id string, tok credstore.Token) bool) error {
+	dec := json.NewDecoder(r)
+	if !expectDelim(dec, '{') {
+		return errMalformedTokenFile
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if key != "tokens" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return err
+			}
+			continue
+		}
+		if !expectDelim(dec, '{') {
+			return errMalformedTokenFile
+		}
+		for dec.More() {
+			id, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			var tok credstore.Token
+			if err := dec.Decode(&tok); err != nil {
+				return err
+			}
+			name, ok := id.(string)
+			if !ok || (tok.AccessToken == "" && tok.RefreshToken == "") {
+				continue
+			}
+			if !fn(name, tok) {
+				return nil
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+// expectDelim reads the next JSON token and reports whether it is delim.
+func expectDelim(dec *json.Decoder, delim json.Delim) bool {
+	tok, err := dec.Token()
+	return err == nil && tok == delim
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-authgate/sdk-go/credstore"
+)
+
+func TestBackupFileStore_RestoresCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	store := withFileBackup(credstore.NewTokenFileStore(path), path)
+
+	first := credstore.Token{
+		AccessToken: "first-access-token",
+		ExpiresAt:   time.Now().Add(time.Hour),
+		ClientID:    "client-a",
+	}
+	if err := store.Save("client-a", first); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	if _, err := os.Stat(path + ".bak"); !os.IsNotExist(err) {
+		t.Errorf("no backup expected before the first overwrite, stat err = %v", err)
+	}
+
+	second := first
+	second.AccessToken = "second-access-token"
+	if err := store.Save("client-a", second); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	// Simulate a write torn by a power loss.
+	if err := os.WriteFile(path, []byte(`{"tokens":{"client-a":{"acc`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.Load("client-a")
+	if err != nil {
+		t.Fatalf("Load() error after corruption: %v", err)
+	}
+	if got.AccessToken != "first-access-token" {
+		t.Errorf("AccessToken = %q, want the backed-up first-access-token", got.AccessToken)
+	}
+}
+
+func TestWithFileBackup_SkipsKeyring(t *testing.T) {
+	store := credstore.NewTokenKeyringStore("test-service")
+	if got := withFileBackup(store, "tokens.json"); got != credstore.Store[credstore.Token](store) {
+		t.Errorf("keyring store should be returned unchanged, got %T", got)
+	}
+}
+
+func TestBackupFileStore_QuarantinesCorruptFileWithoutBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	if err := os.WriteFile(path, []byte(`{"tokens":{"client-a":`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	store := withFileBackup(credstore.NewTokenFileStore(path), path)
+
+	if _, err := store.Load("client-a"); err == nil {
+		t.Error("expected no token after quarantining the corrupt file")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("corrupt token file should have been moved aside, stat err = %v", err)
+	}
+	matches, _ := filepath.Glob(path + quarantineSuffix + "*")
+	if len(matches) != 1 {
+		t.Errorf("expected one quarantined file, got %v", matches)
+	}
+}
+
+func TestBackupFileStore_LoadSeesExternalChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	store := withFileBackup(credstore.NewTokenFileStore(path), path)
+	if err := store.Save("client-a", credstore.Token{AccessToken: "first"}); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	if tok, err := store.Load("client-a"); err != nil || tok.AccessToken != "first" {
+		t.Fatalf("Load() = %+v, %v", tok, err)
+	}
+
+	// Another process rewrites the file without changing its mtime; the next
+	// load must still see the new entry.
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte(`{"tokens":{"client-a":{"access_token":"second"}}}`)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if tok, err := store.Load("client-a"); err != nil || tok.AccessToken != "second" {
+		t.Errorf("Load() after external write = %+v, %v; want second", tok, err)
+	}
+}
+
+func TestBackupFileStore_LoadSeesReplacedFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tokens.json")
+	first := []byte(`{"tokens":{"client-a":{"access_token":"first-"}}}`)
+	second := []byte(`{"tokens":{"client-a":{"access_token":"second"}}}`)
+	if err := os.WriteFile(path, first, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := withFileBackup(credstore.NewTokenFileStore(path), path)
+	if tok, err := store.Load("client-a"); err != nil || tok.AccessToken != "first-" {
+		t.Fatalf("Load() = %+v, %v", tok, err)
+	}
+
+	// Another process replaces the file by rename with one of the same size
+	// and mtime; only the inode tells the versions apart.
+	tmp := filepath.Join(dir, "tokens.json.tmp")
+	if err := os.WriteFile(tmp, second, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(tmp, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	if tok, err := store.Load("client-a"); err != nil || tok.AccessToken != "second" {
+		t.Errorf("Load() after replace = %+v, %v; want second", tok, err)
+	}
+}
+
+// BenchmarkBackupFileStore_Load measures repeated loads from a token file
+// with many clients, the per-call overhead of the token subcommand and API
+// helpers.
+func BenchmarkBackupFileStore_Load(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "tokens.json")
+	var buf bytes.Buffer
+	buf.WriteString(`{"tokens":{`)
+	for i := range 500 {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(&buf, `"client-%d":{"access_token":"access-%d","refresh_token":"refresh-%d",`+
+			`"token_type":"Bearer","expires_at":"2030-01-01T00:00:00Z","client_id":"client-%d"}`,
+			i, i, i, i)
+	}
+	buf.WriteString(`}}`)
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		b.Fatal(err)
+	}
+	store := withFileBackup(credstore.NewTokenFileStore(path), path)
+
+	b.ResetTimer()
+	for b.Loop() {
+		if _, err := store.Load("client-250"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCanonicalTokenPath(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	realDir := filepath.Join(dir, "real")
+	if err := os.Mkdir(realDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(realDir, "tokens.json"), []byte("{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(realDir, link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	t.Chdir(dir)
+
+	want := filepath.Join(realDir, "tokens.json")
+	for _, path := range []string{
+		"real/tokens.json",
+		"./link/../real/tokens.json",
+		filepath.Join(link, "tokens.json"),
+	} {
+		if got, err := canonicalTokenPath(path); err != nil || got != want {
+			t.Errorf("canonicalTokenPath(%q) = %q, %v; want %q", path, got, err, want)
+		}
+	}
+
+	// A file that does not exist yet resolves through its directory.
+	if got, _ := canonicalTokenPath("link/new.json"); got != filepath.Join(realDir, "new.json") {
+		t.Errorf("canonicalTokenPath(link/new.json) = %q", got)
+	}
+	if got, _ := canonicalTokenPath("missing/new.json"); got != filepath.Join(dir, "missing", "new.json") {
+		t.Errorf("canonicalTokenPath(missing/new.json) = %q", got)
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-authgate/oauth-cli/tui"
+)
+
+// defaultTokenInfoCacheTTL is how long a positive token info response is
+// reused for the same token.
+const defaultTokenInfoCacheTTL = 30 * time.Second
+
+// tokenInfoCache holds positive token info responses, keyed by a hash of the
+// endpoint and token, so repeated checks of one token within a run do not
+// each reach the server. It is never written to disk, and tokens themselves
+// are never kept.
+var tokenInfoCache struct {
+	sync.Mutex
+	entries map[string]tokenInfoEntry
+}
+
+type tokenInfoEntry struct {
+	body    string
+	expires time.Time
+}
+
+func tokenInfoCacheKey(endpoint, accessToken string) string {
+	sum := sha256.Sum256([]byte(endpoint + "\x00" + accessToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// cachedTokenInfo returns the cached response for accessToken at endpoint,
+// if one is still fresh at now.
+func cachedTokenInfo(endpoint, accessToken string, now time.Time) (string, bool) {
+	tokenInfoCache.Lock()
+	defer tokenInfoCache.Unlock()
+	key := tokenInfoCacheKey(endpoint, accessToken)
+	entry, ok := tokenInfoCache.entries[key]
+	if !ok {
+		return "", false
+	}
+	if !now.Before(entry.expires) {
+		delete(tokenInfoCache.entries, key)
+		return "", false
+	}
+	return entry.body, true
+}
+
+// cacheTokenInfo remembers body for cfg.TokenInfoCacheTTL unless the response
+// reports the token inactive ("active": false), so a revoked token is
+// always rechecked.
+func cacheTokenInfo(endpoint, accessToken, body string, now time.Time) {
+	if cfg.TokenInfoCacheTTL <= 0 {
+		return
+	}
+	var claims struct {
+		Active *bool `json:"active"`
+	}
+	if json.Unmarshal([]byte(body), &claims) == nil && claims.Active != nil && !*claims.Active {
+		return
+	}
+	tokenInfoCache.Lock()
+	defer tokenInfoCache.Unlock()
+	if tokenInfoCache.entries == nil {
+		tokenInfoCache.entries = make(map[string]tokenInfoEntry)
+	}
+	tokenInfoCache.entries[tokenInfoCacheKey(endpoint, accessToken)] = tokenInfoEntry{
+		body:    body,
+		expires: now.Add(cfg.TokenInfoCacheTTL),
+	}
+}
+
+// noTokenInfoReason explains why there is no token info endpoint to call.
+func noTokenInfoReason() string {
+	if cfg.Discovery && activeProvider.tokenInfoPath == "" {
+		return "the server metadata advertises no introspection endpoint"
+	}
+	return "the server has no token info endpoint"
+}
+
+// defaultPager pages output that does not fit the screen: -F exits at once
+// when it does, -R keeps colours and -X leaves the text on screen.
+var defaultPager = []string{"less", "-FRX"}
+
+// runTokenInfo implements `oauth-cli tokeninfo`: it sends the stored access
+// token (refreshed when expired) to the token info endpoint and prints the
+// response. JSON is indented and, on a terminal, shown through $PAGER; with
+// -raw the body is printed exactly as the server sent it. `tokeninfo -` and
+// `tokeninfo @file` check a token read from stdin or a file instead, which
+// needs no client ID and leaves the token store alone; `tokeninfo sha256:...`
+// checks the stored token with that fingerprint.
+func runTokenInfo(ctx context.Context) int {
+	flagArgs, positional := splitPositional(os.Args[1:])
+	os.Args = append(os.Args[:1:1], flagArgs...)
+	if len(positional) > 1 {
+		fmt.Fprintln(os.Stderr, "Usage: oauth-cli tokeninfo [flags] [- | @file]")
+		return 2
+	}
+	cfg.ClientIDOptional = len(positional) == 1
+	initConfig()
+	discoverCapabilities(ctx)
+
+	var accessToken string
+	if len(positional) == 1 {
+		token, _, err := readTokenArg(positional[0], os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		accessToken = token
+	} else {
+		storage, err := tokenForAudience(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		accessToken = storage.AccessToken
+	}
+	info, err := verifyToken(ctx, accessToken)
+	if errors.Is(err, tui.ErrNotSupported) {
+		fmt.Fprintf(os.Stderr, "Error: %s; set -tokeninfo-path if it serves one elsewhere\n",
+			noTokenInfoReason())
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if cfg.RawOutput {
+		_, _ = io.WriteString(os.Stdout, info)
+		return 0
+	}
+	if err := writePaged(os.Stdout, formatJSON(info)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// readTokenArg returns the token named by a tokeninfo or revoke argument: "-"
+// reads it from stdin, "@path" from a file, and a fingerprint as shown by
+// status ("sha256:" and 12 base32 characters) selects a stored token of the client, whose
+// token_type_hint is then returned too. Surrounding whitespace and a
+// "Bearer " prefix are removed, so a copied Authorization header value works.
+func readTokenArg(arg string, stdin io.Reader) (token, hint string, err error) {
+	var data []byte
+	switch {
+	case strings.HasPrefix(strings.ToLower(arg), fingerprintPrefix):
+		return storedTokenByFingerprint(arg)
+	case arg == "-":
+		data, err = io.ReadAll(stdin)
+	case strings.HasPrefix(arg, "@"):
+		data, err = os.ReadFile(arg[1:])
+	default:
+		return "", "", errors.New("pass the token as - (stdin), @file or its fingerprint, " +
+			"not as an argument visible in the process list")
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read token: %w", err)
+	}
+	token = strings.TrimSpace(string(data))
+	if len(token) > len("Bearer ") && strings.EqualFold(token[:len("Bearer ")], "Bearer ") {
+		token = strings.TrimSpace(token[len("Bearer "):])
+	}
+	if token == "" {
+		return "", "", errors.New("no token given")
+	}
+	return token, "", nil
+}
+
+// fingerprintPrefix starts every tui.TokenFingerprint.
+const fingerprintPrefix = "sha256:"
+
+// storedTokenByFingerprint finds the stored token of the client whose
+// fingerprint is fp, among the entries clientTokenKeys lists.
+func storedTokenByFingerprint(fp string) (token, hint string, err error) {
+	if cfg.ClientID == "" {
+		return "", "", errors.New("a token fingerprint needs -client-id to search the stored tokens")
+	}
+	fp = strings.ToLower(fp)
+	if !validFingerprint(fp) {
+		return "", "", fmt.Errorf("malformed token fingerprint %s: want %s and %d base32 characters",
+			fp, fingerprintPrefix, tui.FingerprintLen)
+	}
+	for _, key := range clientTokenKeys(cfg.ClientID) {
+		tok, err := cfg.TokenStore.Load(key)
+		if err != nil {
+			continue
+		}
+		switch fp {
+		case tui.TokenFingerprint(tok.AccessToken):
+			return tok.AccessToken, hintAccessToken, nil
+		case tui.TokenFingerprint(tok.RefreshToken):
+			if tok.RefreshToken != "" {
+				return tok.RefreshToken, hintRefreshToken, nil
+			}
+		}
+	}
+	return "", "", fmt.Errorf("no stored token of client %s has fingerprint %s", cfg.ClientID, fp)
+}
+
+// validFingerprint reports whether fp, lowercased, has the form of a
+// tui.TokenFingerprint.
+func validFingerprint(fp string) bool {
+	digest, ok := strings.CutPrefix(fp, fingerprintPrefix)
+	if !ok || len(digest) != tui.FingerprintLen {
+		return false
+	}
+	for _, r := range digest {
+		if (r < 'a' || r > 'z') && (r < '2' || r > '7') {
+			return false
+		}
+	}
+	return true
+}
+
+// formatJSON indents a JSON body for reading. Anything that is not valid
+// JSON is returned unchanged. The result ends with a newline.
+func formatJSON(body string) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(body), "", "  "); err != nil {
+		buf.Reset()
+		buf.WriteString(body)
+	}
+	if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+// pagerArgs returns the pager command from $PAGER, defaultPager when PAGER is
+// unset, or nil when paging is disabled (PAGER empty or "cat").
+func pagerArgs() []string {
+	value, ok := os.LookupEnv("PAGER")
+	if !ok {
+		return defaultPager
+	}
+	args := strings.Fields(value)
+	if len(args) == 0 || args[0] == "cat" {
+		return nil
+	}
+	return args
+}
+
+// isTerminal reports whether f is connected to a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// writePaged writes text to out, through the pager when out is a terminal.
+// If the pager cannot be started the text is written directly.
+func writePaged(out *os.File, text string) error {
+	args := pagerArgs()
+	if args == nil || !isTerminal(out) {
+		_, err := io.WriteString(out, text)
+		return err
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if err == nil || errors.As(err, &exitErr) {
+		// A non-zero exit means the pager ran (e.g. it was quit early).
+		return nil
+	}
+	debugf("pager %q failed, writing directly: %v", args[0], err)
+	_, err = io.WriteString(out, text)
+	return err
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-authgate/oauth-cli/tui"
+)
+
+func TestFormatJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"object", `{"sub":"u1","scope":"read write"}`, "{\n  \"sub\": \"u1\",\n  \"scope\": \"read write\"\n}\n"},
+		{"trailing newline", "{\"active\":true}\n", "{\n  \"active\": true\n}\n"},
+		{"not json", "active", "active\n"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := formatJSON(tc.body); got != tc.want {
+				t.Errorf("formatJSON(%q) = %q, want %q", tc.body, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPagerArgs(t *testing.T) {
+	t.Setenv("PAGER", "more -s")
+	if got := pagerArgs(); !slices.Equal(got, []string{"more", "-s"}) {
+		t.Errorf("pagerArgs() = %v, want [more -s]", got)
+	}
+	for _, off := range []string{"", "cat"} {
+		t.Setenv("PAGER", off)
+		if got := pagerArgs(); got != nil {
+			t.Errorf("PAGER=%q: pagerArgs() = %v, want nil", off, got)
+		}
+	}
+}
+
+func TestVerifyToken_CachesPositiveResponses(t *testing.T) {
+	calls := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		calls[auth]++
+		if auth == "Bearer revoked-token-value" {
+			_, _ = w.Write([]byte(`{"active":false}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"active":true,"sub":"u1"}`))
+	}))
+	defer srv.Close()
+	setTestServer(t, srv)
+
+	for range 3 {
+		for _, tok := range []string{"valid-token-value", "revoked-token-value"} {
+			if _, err := verifyToken(context.Background(), tok); err != nil {
+				t.Fatalf("verifyToken(%s) error: %v", tok, err)
+			}
+		}
+	}
+	if n := calls["Bearer valid-token-value"]; n != 1 {
+		t.Errorf("active token checked %d times, want 1", n)
+	}
+	if n := calls["Bearer revoked-token-value"]; n != 3 {
+		t.Errorf("inactive token checked %d times, want 3", n)
+	}
+
+	orig := cfg.TokenInfoCacheTTL
+	t.Cleanup(func() { cfg.TokenInfoCacheTTL = orig })
+	cfg.TokenInfoCacheTTL = 0
+	for range 2 {
+		if _, err := verifyToken(context.Background(), "uncached-token-value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := calls["Bearer uncached-token-value"]; n != 2 {
+		t.Errorf("with the cache disabled the token was checked %d times, want 2", n)
+	}
+}
+
+func TestReadTokenArg(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("file-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		arg, stdin, want string
+		wantErr          bool
+	}{
+		{arg: "-", stdin: "  stdin-token\n", want: "stdin-token"},
+		{arg: "-", stdin: "Bearer header-token", want: "header-token"},
+		{arg: "@" + path, want: "file-token"},
+		{arg: "-", stdin: "\n", wantErr: true},
+		{arg: "plain-token", wantErr: true},
+		{arg: "@" + path + ".missing", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, _, err := readTokenArg(tt.arg, strings.NewReader(tt.stdin))
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("readTokenArg(%q, %q) = %q, %v", tt.arg, tt.stdin, got, err)
+		}
+	}
+}
+
+func TestReadTokenArg_Fingerprint(t *testing.T) {
+	setTokenTestConfig(t, "")
+	if err := cfg.TokenStore.Save("test-client", tui.TokenStorage{
+		AccessToken:  "stored-access",
+		RefreshToken: "stored-refresh",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct{ token, hint string }{
+		{"stored-access", hintAccessToken},
+		{"stored-refresh", hintRefreshToken},
+	} {
+		fp := tui.TokenFingerprint(tt.token)
+		token, hint, err := readTokenArg(strings.ToUpper(fp), nil)
+		if err != nil || token != tt.token || hint != tt.hint {
+			t.Errorf("readTokenArg(%q) = %q, %q, %v; want %q, %q",
+				fp, token, hint, err, tt.token, tt.hint)
+		}
+	}
+	if _, _, err := readTokenArg("sha256:aaaaaaaaaaaa", nil); err == nil {
+		t.Error("readTokenArg() of an unknown fingerprint succeeded")
+	}
+	for _, fp := range []string{
+		"sha256:8d14e6a0c5b2", // the old hex form
+		"sha256:zklyce",
+		"sha256:" + strings.Repeat("a", 13),
+	} {
+		_, _, err := readTokenArg(fp, nil)
+		if err == nil || !strings.Contains(err.Error(), "malformed") {
+			t.Errorf("readTokenArg(%q) error = %v, want malformed fingerprint", fp, err)
+		}
+	}
+}
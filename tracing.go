@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OTLP span kinds and status codes (opentelemetry-proto trace.proto).
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+
+	spanStatusError = 2
+)
+
+// OTLP/HTTP protocols (OTEL_EXPORTER_OTLP_PROTOCOL); protobuf is the
+// default, as in the OpenTelemetry SDKs.
+const (
+	otlpProtocolProtobuf = "http/protobuf"
+	otlpProtocolJSON     = "http/json"
+)
+
+// traceExportTimeout bounds sending the spans when the command exits.
+const traceExportTimeout = 5 * time.Second
+
+// otlpTracer records OpenTelemetry spans for the flow stages and their HTTP
+// requests and exports them once, at exit, to an OTLP/HTTP collector in the
+// protobuf or JSON encoding. It is configured with the standard OTEL_*
+// environment variables. Attributes carry endpoints, status codes, OAuth error codes and
+// retry counts, never tokens, codes or secrets.
+type otlpTracer struct {
+	endpoint string
+	protocol string // otlpProtocolProtobuf or otlpProtocolJSON
+	headers  map[string]string
+	resource []otlpKeyValue
+
+	traceID  [16]byte
+	parentID [8]byte // from TRACEPARENT; zero when this process starts the trace
+	root     *span
+
+	mu    sync.Mutex
+	spans []otlpSpan
+}
+
+// tracer is the configured tracer; nil unless an OTLP endpoint is set.
+var tracer *otlpTracer
+
+// span is a span in progress. A nil *span is valid and records nothing.
+type span struct {
+	t      *otlpTracer
+	id     [8]byte
+	parent [8]byte
+	name   string
+	kind   int
+	start  time.Time
+
+	mu       sync.Mutex
+	attrs    []otlpKeyValue
+	attempts int
+}
+
+type spanContextKey struct{}
+
+// newTracerFromEnv returns a tracer when OTEL_EXPORTER_OTLP_TRACES_ENDPOINT
+// or OTEL_EXPORTER_OTLP_ENDPOINT is set, or nil when tracing is off (no
+// endpoint, OTEL_SDK_DISABLED=true or OTEL_TRACES_EXPORTER=none). grpc, the
+// one protocol not supported, is an error.
+func newTracerFromEnv() (*otlpTracer, error) {
+	if disabled, _ := strconv.ParseBool(os.Getenv("OTEL_SDK_DISABLED")); disabled {
+		return nil, nil
+	}
+	if exporter := os.Getenv("OTEL_TRACES_EXPORTER"); exporter != "" && exporter != "otlp" {
+		return nil, nil
+	}
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if base == "" {
+			return nil, nil
+		}
+		endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+	protocol := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL")
+	if protocol == "" {
+		protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+	switch protocol {
+	case "":
+		protocol = otlpProtocolProtobuf
+	case otlpProtocolProtobuf, otlpProtocolJSON:
+	default:
+		return nil, fmt.Errorf("unsupported OTEL_EXPORTER_OTLP_PROTOCOL: %s "+
+			"(use %s or %s)", protocol, otlpProtocolProtobuf, otlpProtocolJSON)
+	}
+
+	t := &otlpTracer{endpoint: endpoint, protocol: protocol, headers: make(map[string]string)}
+	for _, name := range []string{"OTEL_EXPORTER_OTLP_HEADERS", "OTEL_EXPORTER_OTLP_TRACES_HEADERS"} {
+		for k, v := range parseOTELList(os.Getenv(name)) {
+			t.headers[k] = v
+		}
+	}
+
+	resource := parseOTELList(os.Getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		resource["service.name"] = name
+	}
+	if resource["service.name"] == "" {
+		resource["service.name"] = "oauth-cli"
+	}
+	for k, v := range resource {
+		t.resource = append(t.resource, stringAttr(k, v))
+	}
+
+	if traceID, parentID, ok := parseTraceparent(os.Getenv("TRACEPARENT")); ok {
+		t.traceID, t.parentID = traceID, parentID
+	} else {
+		_, _ = rand.Read(t.traceID[:])
+	}
+	return t, nil
+}
+
+// parseOTELList parses the "key1=value1,key2=value2" format of
+// OTEL_EXPORTER_OTLP_HEADERS and OTEL_RESOURCE_ATTRIBUTES; values are
+// URL-encoded.
+func parseOTELList(value string) map[string]string {
+	m := make(map[string]string)
+	for item := range strings.SplitSeq(value, ",") {
+		k, v, ok := strings.Cut(item, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			continue
+		}
+		if decoded, err := url.QueryUnescape(strings.TrimSpace(v)); err == nil {
+			v = decoded
+		}
+		m[k] = v
+	}
+	return m
+}
+
+// parseTraceparent parses a W3C traceparent header value
+// ("00-<trace id>-<parent id>-<flags>"), so a CI job or wrapper script can
+// put the CLI's spans into its own trace.
+func parseTraceparent(value string) (traceID [16]byte, parentID [8]byte, ok bool) {
+	parts := strings.Split(value, "-")
+	if len(parts) != 4 || parts[0] != "00" {
+		return traceID, parentID, false
+	}
+	if n, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil || n != 16 {
+		return traceID, parentID, false
+	}
+	if n, err := hex.Decode(parentID[:], []byte(parts[2])); err != nil || n != 8 {
+		return traceID, parentID, false
+	}
+	return traceID, parentID, traceID != [16]byte{} && parentID != [8]byte{}
+}
+
+// startRoot starts the span covering the whole command; spans started from a
+// context without a span become its children.
+func (t *otlpTracer) startRoot(name string) *span {
+	if t == nil {
+		return nil
+	}
+	t.root = t.newSpan(name, spanKindInternal, t.parentID)
+	return t.root
+}
+
+func (t *otlpTracer) newSpan(name string, kind int, parent [8]byte) *span {
+	s := &span{t: t, name: name, kind: kind, parent: parent, start: time.Now()}
+	_, _ = rand.Read(s.id[:])
+	return s
+}
+
+// startSpan starts a span named name as a child of the span in ctx (or of
+// the root span) and returns a context carrying it.
+func startSpan(ctx context.Context, name string, kind int) (context.Context, *span) {
+	if tracer == nil {
+		return ctx, nil
+	}
+	parent := spanFromContext(ctx)
+	if parent == nil {
+		parent = tracer.root
+	}
+	var parentID [8]byte
+	if parent != nil {
+		parentID = parent.id
+	}
+	s := tracer.newSpan(name, kind, parentID)
+	return context.WithValue(ctx, spanContextKey{}, s), s
+}
+
+func spanFromContext(ctx context.Context) *span {
+	s, _ := ctx.Value(spanContextKey{}).(*span)
+	return s
+}
+
+// set adds an attribute; value is a string, int or bool.
+func (s *span) set(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch v := value.(type) {
+	case int:
+		s.attrs = append(s.attrs, otlpKeyValue{Key: key, Value: otlpAnyValue{
+			IntValue: strconv.Itoa(v),
+		}})
+	case bool:
+		s.attrs = append(s.attrs, otlpKeyValue{Key: key, Value: otlpAnyValue{BoolValue: &v}})
+	default:
+		s.attrs = append(s.attrs, stringAttr(key, fmt.Sprint(v)))
+	}
+}
+
+// addAttempt counts an HTTP attempt (including retries) made for the span.
+func (s *span) addAttempt() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attempts++
+	s.mu.Unlock()
+}
+
+// traceparent returns the W3C traceparent header value for s.
+func (s *span) traceparent() string {
+	return "00-" + hex.EncodeToString(s.t.traceID[:]) + "-" + hex.EncodeToString(s.id[:]) + "-01"
+}
+
+// end finishes the span, marking it failed when err is non-nil.
+func (s *span) end(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	rec := otlpSpan{
+		TraceID:    hex.EncodeToString(s.t.traceID[:]),
+		SpanID:     hex.EncodeToString(s.id[:]),
+		Name:       s.name,
+		Kind:       s.kind,
+		StartTime:  strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTime:    strconv.FormatInt(time.Now().UnixNano(), 10),
+		Attributes: s.attrs,
+	}
+	if s.attempts > 0 {
+		rec.Attributes = append(rec.Attributes, otlpKeyValue{Key: "http.attempts", Value: otlpAnyValue{
+			IntValue: strconv.Itoa(s.attempts),
+		}})
+	}
+	s.mu.Unlock()
+	if s.parent != [8]byte{} {
+		rec.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+	if err != nil {
+		rec.Status = &otlpStatus{Code: spanStatusError, Message: err.Error()}
+	}
+
+	s.t.mu.Lock()
+	s.t.spans = append(s.t.spans, rec)
+	s.t.mu.Unlock()
+}
+
+// flush sends the finished spans to the collector. Export failures are
+// returned for the caller to report; they never change the exit code.
+func (t *otlpTracer) flush() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	spans := t.spans
+	t.spans = nil
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return nil
+	}
+
+	export := otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: t.resource},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "github.com/go-authgate/oauth-cli"},
+			Spans: spans,
+		}},
+	}}}
+	body, contentType := marshalOTLPProto(export), "application/x-protobuf"
+	if t.protocol == otlpProtocolJSON {
+		var err error
+		if body, err = json.Marshal(export); err != nil {
+			return err
+		}
+		contentType = "application/json"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), traceExportTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	// The default client, not cfg.HTTPClient: exporting must not be traced, and
+	// the collector is not the authorization server.
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// tracingTransport records a client span for every HTTP attempt, counts the
+// attempts on the enclosing stage span, and propagates the trace to the
+// server with a traceparent header so its logs can be correlated.
+type tracingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	spanFromContext(req.Context()).addAttempt()
+	ctx, s := startSpan(req.Context(), "HTTP "+req.Method, spanKindClient)
+	s.set("http.request.method", req.Method)
+	s.set("server.address", req.URL.Hostname())
+	s.set("url.path", req.URL.Path)
+
+	req = req.Clone(ctx)
+	if s != nil {
+		req.Header.Set("Traceparent", s.traceparent())
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		s.set("error.type", "transport")
+		s.end(err)
+		return nil, err
+	}
+	s.set("http.response.status_code", resp.StatusCode)
+	if resp.StatusCode >= 500 {
+		s.end(fmt.Errorf("HTTP %d", resp.StatusCode))
+	} else {
+		s.end(nil)
+	}
+	return resp, nil
+}
+
+// OTLP trace export request (opentelemetry-proto, JSON encoding); spans are
+// recorded in this form and marshalOTLPProto re-encodes it for protobuf.
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID      string         `json:"traceId"`
+	SpanID       string         `json:"spanId"`
+	ParentSpanID string         `json:"parentSpanId,omitempty"`
+	Name         string         `json:"name"`
+	Kind         int            `json:"kind"`
+	StartTime    string         `json:"startTimeUnixNano"`
+	EndTime      string         `json:"endTimeUnixNano"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+	Status       *otlpStatus    `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    string  `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+func stringAttr(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{StringValue: &value}}
+}
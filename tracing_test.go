@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		value  string
+		wantOK bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"", false},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-xyz-01", false},
+	}
+	for _, tc := range tests {
+		if _, _, ok := parseTraceparent(tc.value); ok != tc.wantOK {
+			t.Errorf("parseTraceparent(%q) ok = %v, want %v", tc.value, ok, tc.wantOK)
+		}
+	}
+}
+
+func TestNewTracerFromEnv(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318/")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "x-api-key=abc%3D,tenant=ops")
+	t.Setenv("OTEL_RESOURCE_ATTRIBUTES", "deployment.environment=ci")
+	t.Setenv("TRACEPARENT", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	tr, err := newTracerFromEnv()
+	if err != nil || tr == nil {
+		t.Fatalf("newTracerFromEnv() = %v, %v", tr, err)
+	}
+	if tr.endpoint != "http://collector:4318/v1/traces" {
+		t.Errorf("endpoint = %q", tr.endpoint)
+	}
+	if tr.headers["x-api-key"] != "abc=" || tr.headers["tenant"] != "ops" {
+		t.Errorf("headers = %v", tr.headers)
+	}
+	if tr.parentID == [8]byte{} {
+		t.Error("TRACEPARENT parent not used")
+	}
+	if tr.protocol != otlpProtocolProtobuf {
+		t.Errorf("default protocol = %q, want %s", tr.protocol, otlpProtocolProtobuf)
+	}
+
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc")
+	if _, err := newTracerFromEnv(); err == nil {
+		t.Error("grpc protocol expected error")
+	}
+	t.Setenv("OTEL_SDK_DISABLED", "true")
+	if tr, err := newTracerFromEnv(); tr != nil || err != nil {
+		t.Errorf("OTEL_SDK_DISABLED: newTracerFromEnv() = %v, %v; want nil, nil", tr, err)
+	}
+}
+
+func TestTracingTransport_ExportsSpans(t *testing.T) {
+	var gotTraceparent string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTraceparent = r.Header.Get("Traceparent")
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer api.Close()
+
+	var exported otlpTraces
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "secret-access-token") {
+			t.Errorf("exported spans contain the access token: %s", body)
+		}
+		_ = json.Unmarshal(body, &exported)
+	}))
+	defer collector.Close()
+
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", collector.URL)
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", otlpProtocolJSON)
+	origTracer := tracer
+	t.Cleanup(func() { tracer = origTracer })
+	var err error
+	if tracer, err = newTracerFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	root := tracer.startRoot("oauth-cli test")
+
+	ctx, stage := startSpan(context.Background(), "oauth.refresh", spanKindInternal)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, api.URL+"/oauth/token", nil)
+	req.Header.Set("Authorization", "Bearer secret-access-token")
+	resp, err := (&http.Client{Transport: &tracingTransport{base: http.DefaultTransport}}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	stage.end(nil)
+	root.end(nil)
+	if err := tracer.flush(); err != nil {
+		t.Fatalf("flush() error = %v", err)
+	}
+
+	spans := map[string]otlpSpan{}
+	for _, s := range exported.ResourceSpans[0].ScopeSpans[0].Spans {
+		spans[s.Name] = s
+	}
+	httpSpan, refresh := spans["HTTP POST"], spans["oauth.refresh"]
+	if httpSpan.ParentSpanID != refresh.SpanID ||
+		refresh.ParentSpanID != spans["oauth-cli test"].SpanID {
+		t.Errorf("span hierarchy wrong: %+v", spans)
+	}
+	if httpSpan.Status == nil || httpSpan.Status.Code != spanStatusError {
+		t.Errorf("HTTP 502 span status = %+v, want error", httpSpan.Status)
+	}
+	if !strings.Contains(gotTraceparent, httpSpan.TraceID) {
+		t.Errorf("traceparent %q does not carry trace %s", gotTraceparent, httpSpan.TraceID)
+	}
+	var attempts string
+	for _, kv := range refresh.Attributes {
+		if kv.Key == "http.attempts" {
+			attempts = kv.Value.IntValue
+		}
+	}
+	if attempts != "1" {
+		t.Errorf("http.attempts = %q, want 1", attempts)
+	}
+}
+
+// protoFields splits a protobuf message into its fields: varints and fixed64
+// as numbers, length-delimited fields as bytes.
+func protoFields(t *testing.T, b []byte) map[int][]any {
+	t.Helper()
+	fields := map[int][]any{}
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		b = b[n:]
+		field := int(tag >> 3)
+		switch tag & 7 {
+		case pbVarint:
+			v, n := binary.Uvarint(b)
+			fields[field] = append(fields[field], v)
+			b = b[n:]
+		case pbFixed64:
+			fields[field] = append(fields[field], binary.LittleEndian.Uint64(b))
+			b = b[8:]
+		case pbBytes:
+			l, n := binary.Uvarint(b)
+			fields[field] = append(fields[field], b[n:n+int(l)])
+			b = b[n+int(l):]
+		default:
+			t.Fatalf("unexpected wire type in tag %d", tag)
+		}
+	}
+	return fields
+}
+
+func TestFlush_Protobuf(t *testing.T) {
+	var body []byte
+	var contentType string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer collector.Close()
+
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", collector.URL)
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", otlpProtocolProtobuf)
+	tr, err := newTracerFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := tr.startRoot("oauth-cli token")
+	root.set("process.exit.code", 1)
+	root.set("oauth.offline", true)
+	root.end(errors.New("failed"))
+	if err := tr.flush(); err != nil {
+		t.Fatalf("flush() error = %v", err)
+	}
+	if contentType != "application/x-protobuf" {
+		t.Errorf("Content-Type = %q, want application/x-protobuf", contentType)
+	}
+
+	resourceSpans := protoFields(t, body)[pbExportResourceSpans][0].([]byte)
+	scopeSpans := protoFields(t, resourceSpans)[pbResourceSpansScopeSpans][0].([]byte)
+	span := protoFields(t, protoFields(t, scopeSpans)[pbScopeSpansSpans][0].([]byte))
+
+	if got := span[pbSpanTraceID][0].([]byte); !bytes.Equal(got, tr.traceID[:]) {
+		t.Errorf("trace_id = %x, want %x", got, tr.traceID)
+	}
+	if got := string(span[pbSpanName][0].([]byte)); got != "oauth-cli token" {
+		t.Errorf("name = %q", got)
+	}
+	if got := span[pbSpanKind][0].(uint64); got != spanKindInternal {
+		t.Errorf("kind = %d, want %d", got, spanKindInternal)
+	}
+	start, end := span[pbSpanStartTime][0].(uint64), span[pbSpanEndTime][0].(uint64)
+	if start == 0 || end < start {
+		t.Errorf("start/end = %d/%d", start, end)
+	}
+	status := protoFields(t, span[pbSpanStatus][0].([]byte))
+	if status[pbStatusCode][0].(uint64) != spanStatusError ||
+		string(status[pbStatusMessage][0].([]byte)) != "failed" {
+		t.Errorf("status = %v, want error \"failed\"", status)
+	}
+
+	attrs := map[string]map[int][]any{}
+	for _, raw := range span[pbSpanAttributes] {
+		kv := protoFields(t, raw.([]byte))
+		attrs[string(kv[pbKeyValueKey][0].([]byte))] = protoFields(t, kv[pbKeyValueValue][0].([]byte))
+	}
+	if v := attrs["process.exit.code"][pbAnyValueInt]; len(v) != 1 || v[0].(uint64) != 1 {
+		t.Errorf("process.exit.code = %v, want int 1", v)
+	}
+	if v := attrs["oauth.offline"][pbAnyValueBool]; len(v) != 1 || v[0].(uint64) != 1 {
+		t.Errorf("oauth.offline = %v, want bool true", v)
+	}
+}
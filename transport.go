@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// transportOptions are the connection knobs exposed as flags, for networks
+// (corporate proxies, middleboxes) that mishandle the defaults.
+type transportOptions struct {
+	// http1 pins HTTP/1.1, so HTTP/2 is never offered in the TLS handshake.
+	// The transport does not enable HTTP/2 today (a custom TLSClientConfig
+	// turns off net/http's automatic upgrade); this keeps the escape hatch
+	// working if that default changes.
+	http1 bool
+
+	// disableKeepAlives uses a new connection for every request.
+	disableKeepAlives bool
+
+	// maxIdleConnsPerHost caps idle connections kept per host; 0 keeps
+	// net/http's default of 2.
+	maxIdleConnsPerHost int
+
+	// dialTimeout bounds establishing the TCP connection; 0 leaves it to
+	// the operating system.
+	dialTimeout time.Duration
+
+	// unixSocket, when set, carries all requests to unixSocketHost over this
+	// Unix domain socket (SERVER_URL=unix:///path).
+	unixSocket string
+
+	// preferIP is "4" or "6" to dial that IP family first and fall back to
+	// the other only if it fails; "" races both (Happy Eyeballs).
+	preferIP string
+
+	// resolver is the host:port of a DNS server used instead of the system
+	// resolver, for split-horizon VPNs; "" uses the system resolver.
+	resolver string
+
+	// pins are SHA-256 hashes of acceptable SubjectPublicKeyInfos. When set,
+	// a TLS connection is refused unless a certificate in its verified chain
+	// has one of them, even if the chain is otherwise trusted.
+	pins [][]byte
+
+	// clientCert is presented when the server asks for a client certificate
+	// (-token-auth-method=tls_client_auth).
+	clientCert *tls.Certificate
+}
+
+// pinList collects repeated -pin-sha256 flags.
+type pinList []string
+
+func (p *pinList) String() string { return strings.Join(*p, ",") }
+
+func (p *pinList) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
+
+// parsePins decodes -pin-sha256 values: base64 SHA-256 hashes of a
+// certificate's SubjectPublicKeyInfo, optionally prefixed with "sha256//"
+// as curl's --pinnedpubkey accepts.
+func parsePins(values []string) ([][]byte, error) {
+	var pins [][]byte
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		pin, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(v, "sha256//"))
+		if err != nil || len(pin) != sha256.Size {
+			return nil, fmt.Errorf(
+				"invalid pin-sha256 value: %s (must be a base64 SHA-256 hash of a public key)", v)
+		}
+		pins = append(pins, pin)
+	}
+	return pins, nil
+}
+
+// spkiPin returns the base64 SHA-256 hash of cert's SubjectPublicKeyInfo.
+func spkiPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// verifyPins fails the handshake unless a certificate in a verified chain
+// matches one of pins. It runs after normal chain verification. Certificates
+// the server sent but that are not part of a verified chain are ignored, so
+// a server cannot pass by presenting the pinned certificate as an extra.
+func verifyPins(pins [][]byte) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		for _, chain := range cs.VerifiedChains {
+			for _, cert := range chain {
+				sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+				if slices.ContainsFunc(pins, func(pin []byte) bool { return bytes.Equal(pin, sum[:]) }) {
+					return nil
+				}
+			}
+		}
+		if len(cs.PeerCertificates) == 0 {
+			return fmt.Errorf("certificate pin mismatch for %s: no certificate", cs.ServerName)
+		}
+		return fmt.Errorf("certificate pin mismatch for %s: server key is sha256//%s",
+			cs.ServerName, spkiPin(cs.PeerCertificates[0]))
+	}
+}
+
+// unixSocketHost is the host cfg.ServerURL is rewritten to for a unix://
+// server; requests to it are dialed over the socket instead of TCP. The
+// .invalid TLD (RFC 6761) never resolves, so no real host is routed into the
+// socket.
+const unixSocketHost = "unix.invalid"
+
+// parseUnixServerURL returns the socket path of a unix:///path server URL.
+// ok is false for any other scheme.
+func parseUnixServerURL(raw string) (socket string, ok bool, err error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "unix" {
+		return "", false, nil
+	}
+	if u.Host != "" || !filepath.IsAbs(u.Path) {
+		return "", true, fmt.Errorf(
+			"invalid unix server URL: %s (must be unix:// followed by an absolute socket path)", raw)
+	}
+	return u.Path, true, nil
+}
+
+// parseResolver validates a -resolver value, adding the default DNS port
+// when it is missing ("10.0.0.53" -> "10.0.0.53:53").
+func parseResolver(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	host, port, err := net.SplitHostPort(value)
+	if err != nil {
+		host, port = strings.Trim(value, "[]"), "53"
+	}
+	if net.ParseIP(host) == nil {
+		return "", fmt.Errorf(
+			"invalid resolver value: %s (must be an IP address, optionally with :port)", value)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("invalid resolver port: %s", value)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// newHTTPTransport builds the transport shared by all server requests.
+func newHTTPTransport(opts transportOptions) *http.Transport {
+	t := &http.Transport{
+		TLSClientConfig:     &tls.Config{MinVersion: tls.VersionTLS12},
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: opts.maxIdleConnsPerHost,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+		DisableKeepAlives:   opts.disableKeepAlives,
+	}
+	if len(opts.pins) > 0 {
+		t.TLSClientConfig.VerifyConnection = verifyPins(opts.pins)
+	}
+	if opts.clientCert != nil {
+		t.TLSClientConfig.Certificates = []tls.Certificate{*opts.clientCert}
+	}
+	if opts.http1 {
+		t.Protocols = new(http.Protocols)
+		t.Protocols.SetHTTP1(true)
+	}
+	if opts.dialTimeout > 0 || opts.resolver != "" || opts.preferIP != "" || opts.unixSocket != "" {
+		t.DialContext = newDialFunc(opts)
+	}
+	return t
+}
+
+// dialFunc is the signature of http.Transport.DialContext.
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// newDialFunc builds the transport's DialContext from the dial options.
+func newDialFunc(opts transportOptions) dialFunc {
+	dialer := &net.Dialer{Timeout: opts.dialTimeout}
+	if opts.resolver != "" {
+		dialer.Resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, opts.resolver)
+			},
+		}
+	}
+	var dial dialFunc = dialer.DialContext
+
+	if opts.preferIP != "" {
+		// Dial only the preferred family first; the other family is tried
+		// when that fails (no such addresses, or unreachable), instead of
+		// racing both as Happy Eyeballs does.
+		first, second := "tcp4", "tcp6"
+		if opts.preferIP == "6" {
+			first, second = second, first
+		}
+		base := dial
+		dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if network != "tcp" {
+				return base(ctx, network, addr)
+			}
+			conn, err := base(ctx, first, addr)
+			if err == nil || ctx.Err() != nil {
+				return conn, err
+			}
+			if conn, err2 := base(ctx, second, addr); err2 == nil {
+				return conn, nil
+			}
+			return nil, err
+		}
+	}
+
+	if opts.unixSocket != "" {
+		base := dial
+		dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if addr == net.JoinHostPort(unixSocketHost, "80") {
+				return base(ctx, "unix", opts.unixSocket)
+			}
+			return base(ctx, network, addr)
+		}
+	}
+	return dial
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewHTTPTransport(t *testing.T) {
+	tr := newHTTPTransport(transportOptions{
+		disableKeepAlives:   true,
+		maxIdleConnsPerHost: 4,
+		dialTimeout:         3 * time.Second,
+	})
+	if !tr.DisableKeepAlives || tr.MaxIdleConnsPerHost != 4 || tr.DialContext == nil {
+		t.Errorf("options not applied: %+v", tr)
+	}
+
+	if tr := newHTTPTransport(transportOptions{}); tr.DialContext != nil || tr.Protocols != nil {
+		t.Errorf("zero options should keep net/http defaults: %+v", tr)
+	}
+}
+
+func TestNewHTTPTransport_HTTP1(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	for _, http1 := range []bool{false, true} {
+		tr := newHTTPTransport(transportOptions{http1: http1})
+		tr.TLSClientConfig.RootCAs = srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+		resp, err := (&http.Client{Transport: tr}).Get(srv.URL)
+		if err != nil {
+			t.Fatalf("http1=%v: GET error = %v", http1, err)
+		}
+		resp.Body.Close()
+		// HTTP/2 is not negotiated by default either; -http1 pins that.
+		if resp.ProtoMajor != 1 {
+			t.Errorf("http1=%v: negotiated %s, want HTTP/1.1", http1, resp.Proto)
+		}
+		tr.CloseIdleConnections()
+	}
+}
+
+func TestParseResolver(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"10.0.0.53", "10.0.0.53:53", false},
+		{"10.0.0.53:5353", "10.0.0.53:5353", false},
+		{"fd00::53", "[fd00::53]:53", false},
+		{"[fd00::53]:5353", "[fd00::53]:5353", false},
+		{"dns.example.com", "", true},
+		{"10.0.0.53:0", "", true},
+	}
+	for _, tc := range tests {
+		got, err := parseResolver(tc.value)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("parseResolver(%q) = %q, %v; want %q, wantErr %v",
+				tc.value, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
+
+func TestNewHTTPTransport_Resolver(t *testing.T) {
+	// A DNS server that answers nothing: resolution must go to it (and fail)
+	// instead of the system resolver.
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	queried := make(chan struct{}, 1)
+	go func() {
+		buf := make([]byte, 512)
+		if _, _, err := pc.ReadFrom(buf); err == nil {
+			queried <- struct{}{}
+		}
+	}()
+
+	tr := newHTTPTransport(transportOptions{resolver: pc.LocalAddr().String()})
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	conn, err := tr.DialContext(ctx, "tcp", "idp.corp.example:443")
+	if err == nil {
+		conn.Close()
+		t.Fatal("dial succeeded without an answer from the resolver")
+	}
+	select {
+	case <-queried:
+	case <-time.After(2 * time.Second):
+		t.Error("configured resolver was not queried")
+	}
+}
+
+func TestParseUnixServerURL(t *testing.T) {
+	tests := []struct {
+		raw        string
+		wantSocket string
+		wantOK     bool
+		wantErr    bool
+	}{
+		{"unix:///var/run/authgate.sock", "/var/run/authgate.sock", true, false},
+		{"https://auth.example.com", "", false, false},
+		{"unix://var/run/authgate.sock", "", true, true},
+		{"unix:relative.sock", "", true, true},
+	}
+	for _, tc := range tests {
+		socket, ok, err := parseUnixServerURL(tc.raw)
+		if socket != tc.wantSocket || ok != tc.wantOK || (err != nil) != tc.wantErr {
+			t.Errorf("parseUnixServerURL(%q) = %q, %v, %v; want %q, %v, err %v",
+				tc.raw, socket, ok, err, tc.wantSocket, tc.wantOK, tc.wantErr)
+		}
+	}
+}
+
+func TestNewHTTPTransport_UnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "authgate.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path))
+	}))
+	srv.Listener = ln
+	srv.Start()
+	defer srv.Close()
+
+	client := &http.Client{Transport: newHTTPTransport(transportOptions{unixSocket: socket})}
+	resp, err := client.Get("http://" + unixSocketHost + "/oauth/tokeninfo")
+	if err != nil {
+		t.Fatalf("GET over unix socket: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "/oauth/tokeninfo" {
+		t.Errorf("body = %q, want /oauth/tokeninfo", body)
+	}
+}
+
+func TestCredentialTargetPrefix_UnixSocket(t *testing.T) {
+	old := cfg.ServerSocket
+	t.Cleanup(func() { cfg.ServerSocket = old })
+
+	cfg.ServerSocket = "/run/a.sock"
+	a := credentialTargetPrefix("http://" + unixSocketHost)
+	cfg.ServerSocket = "/run/b.sock"
+	b := credentialTargetPrefix("http://" + unixSocketHost)
+	local := credentialTargetPrefix("http://localhost")
+
+	if a != "authgate:unix/run/a.sock/" {
+		t.Errorf("prefix = %q, want authgate:unix/run/a.sock/", a)
+	}
+	if a == b || a == local || b == local {
+		t.Errorf("prefixes collide: %q, %q, %q", a, b, local)
+	}
+}
+
+func TestNewDialFunc_PreferIPFallsBack(t *testing.T) {
+	// Listen on IPv4 only: preferring IPv6 must still connect via IPv4.
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	for _, prefer := range []string{"4", "6"} {
+		dial := newDialFunc(transportOptions{preferIP: prefer, dialTimeout: time.Second})
+		conn, err := dial(context.Background(), "tcp", net.JoinHostPort("127.0.0.1", port))
+		if err != nil {
+			t.Errorf("preferIP=%s: dial error = %v", prefer, err)
+			continue
+		}
+		conn.Close()
+	}
+}
+
+// selfSignedCert returns a certificate for 127.0.0.1 that is its own CA.
+func selfSignedCert(t *testing.T) (*x509.Certificate, tls.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "spoof"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestParsePins(t *testing.T) {
+	good := "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+	pins, err := parsePins([]string{good, "sha256//" + good, " "})
+	if err != nil || len(pins) != 2 {
+		t.Errorf("parsePins() = %d pins, %v; want 2, nil", len(pins), err)
+	}
+	for _, bad := range []string{"not-base64!", "c2hvcnQ="} {
+		if _, err := parsePins([]string{bad}); err == nil {
+			t.Errorf("parsePins(%q) expected error", bad)
+		}
+	}
+}
+
+func TestNewHTTPTransport_PinSHA256(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	roots := srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+	other := "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+	tests := []struct {
+		name    string
+		pins    []string
+		wantErr bool
+	}{
+		{"matching pin", []string{other, spkiPin(srv.Certificate())}, false},
+		{"mismatch", []string{other}, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pins, err := parsePins(tc.pins)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tr := newHTTPTransport(transportOptions{pins: pins})
+			tr.TLSClientConfig.RootCAs = roots
+			defer tr.CloseIdleConnections()
+			resp, err := (&http.Client{Transport: tr}).Get(srv.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tc.wantErr {
+				t.Errorf("GET error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// TestNewHTTPTransport_PinIgnoresExtraCertificates covers a server whose own
+// chain verifies and that also sends the pinned certificate, unverified, as
+// an extra certificate: the pin must not match.
+func TestNewHTTPTransport_PinIgnoresExtraCertificates(t *testing.T) {
+	genuine := httptest.NewTLSServer(http.NotFoundHandler())
+	defer genuine.Close()
+
+	spoofCert, spoofKeyPair := selfSignedCert(t)
+	spoofKeyPair.Certificate = append(spoofKeyPair.Certificate, genuine.Certificate().Raw)
+	spoof := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	spoof.TLS = &tls.Config{Certificates: []tls.Certificate{spoofKeyPair}}
+	spoof.StartTLS()
+	defer spoof.Close()
+
+	pins, err := parsePins([]string{spkiPin(genuine.Certificate())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := newHTTPTransport(transportOptions{pins: pins})
+	tr.TLSClientConfig.RootCAs = x509.NewCertPool()
+	tr.TLSClientConfig.RootCAs.AddCert(spoofCert)
+	defer tr.CloseIdleConnections()
+
+	resp, err := (&http.Client{Transport: tr}).Get(spoof.URL)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("GET succeeded; want the handshake rejected by the pin check")
+	}
+	if !strings.Contains(err.Error(), "certificate pin mismatch") {
+		t.Errorf("GET error = %v, want certificate pin mismatch", err)
+	}
+}
@@ -3,6 +3,7 @@ package tui
 import (
 	"context"
 	"fmt"
+	"time"
 
 	tea "charm.land/bubbletea/v2"
 )
@@ -14,9 +15,13 @@ func cmdLoadTokens(deps Deps) tea.Cmd {
 	}
 }
 
+// cmdRefreshToken runs the refresh detached from ctx's cancellation: the
+// server may already have rotated the refresh token when the user interrupts,
+// so the refresh finishes and the new pair is saved before the model quits.
+// Deps.RefreshToken bounds the request with its own timeout.
 func cmdRefreshToken(ctx context.Context, deps Deps, refreshToken string) tea.Cmd {
 	return func() tea.Msg {
-		storage, saveWarning, err := deps.RefreshToken(ctx, refreshToken)
+		storage, saveWarning, err := deps.RefreshToken(context.WithoutCancel(ctx), refreshToken)
 		return msgTokenRefreshed{storage: storage, saveWarning: saveWarning, err: err}
 	}
 }
@@ -45,6 +50,18 @@ func cmdOpenBrowser(ctx context.Context, deps Deps, u string) tea.Cmd {
 	}
 }
 
+func cmdReopenBrowser(ctx context.Context, deps Deps, u string) tea.Cmd {
+	return func() tea.Msg {
+		return msgBrowserReopened{err: deps.OpenBrowser(ctx, u)}
+	}
+}
+
+func cmdReopenAfter(d time.Duration, authURL string) tea.Cmd {
+	return tea.Tick(d, func(time.Time) tea.Msg {
+		return msgReopenDue{authURL: authURL}
+	})
+}
+
 func cmdWaitCallback(ctx context.Context, deps Deps, state, verifier string) tea.Cmd {
 	return func() tea.Msg {
 		storage, err := deps.StartCallback(ctx, deps.CallbackPort, state,
@@ -55,12 +72,26 @@ func cmdWaitCallback(ctx context.Context, deps Deps, state, verifier string) tea
 		if err != nil {
 			return msgCallbackReceived{err: err}
 		}
-		saveWarning := ""
-		if saveErr := deps.SaveTokens(storage); saveErr != nil {
-			saveWarning = fmt.Sprintf("Warning: Failed to save tokens: %v", saveErr)
+		if deps.Identity != nil {
+			return msgIdentityPending{storage: storage, subject: deps.Identity(storage)}
 		}
-		return msgCallbackReceived{storage: storage, saveWarning: saveWarning}
+		return saveCallbackTokens(deps, storage)
+	}
+}
+
+// cmdSaveConfirmed saves tokens whose identity the user has confirmed.
+func cmdSaveConfirmed(deps Deps, storage *TokenStorage) tea.Cmd {
+	return func() tea.Msg {
+		return saveCallbackTokens(deps, storage)
+	}
+}
+
+func saveCallbackTokens(deps Deps, storage *TokenStorage) msgCallbackReceived {
+	saveWarning := ""
+	if saveErr := deps.SaveTokens(storage); saveErr != nil {
+		saveWarning = fmt.Sprintf("Warning: Failed to save tokens: %v", saveErr)
 	}
+	return msgCallbackReceived{storage: storage, saveWarning: saveWarning}
 }
 
 func cmdVerifyToken(ctx context.Context, deps Deps, token string) tea.Cmd {
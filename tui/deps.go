@@ -1,6 +1,9 @@
 package tui
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // Deps holds all OAuth operation callbacks the TUI delegates to the caller.
 // Populate this struct in main.go and pass it to NewOAuthModel.
@@ -19,4 +22,37 @@ type Deps struct {
 	VerifyToken  func(ctx context.Context, token string) (string, error)
 	MakeAPICall  func(ctx context.Context, storage *TokenStorage) error
 	CallbackPort int
+
+	// CallbackWait is how long StartCallback waits for the browser; the TUI
+	// shows the time remaining.
+	CallbackWait time.Duration
+
+	// ReopenAfter, when positive, re-opens the browser once if the callback
+	// has not arrived after this long (popup blockers often eat the first try).
+	ReopenAfter time.Duration
+
+	// RefreshBefore refreshes a loaded token this long before it expires. If
+	// that refresh fails while the token is still valid, the token is used.
+	RefreshBefore time.Duration
+
+	// Identity, when non-nil, describes the account a new login was issued
+	// to. The tokens are then saved only after the user confirms it.
+	Identity func(storage *TokenStorage) string
+
+	// Strict makes a failed API check exit non-zero. Otherwise the run
+	// succeeds once the token is obtained and saved, and the check is only
+	// reported.
+	Strict bool
+
+	// ShowToken prints the full access token in the final summary instead of
+	// its fingerprint.
+	ShowToken bool
+
+	// Timings, when non-nil, returns per-request HTTP timings to show in the
+	// final summary.
+	Timings func() []HTTPTiming
+
+	// Now, when non-nil, replaces time.Now for expiry checks and countdowns,
+	// so the TUI follows the caller's clock.
+	Now func() time.Time
 }
@@ -0,0 +1,129 @@
+package tui
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultLanguage is the catalog used when no other language matches, and
+// for messages a catalog does not translate.
+const DefaultLanguage = "en"
+
+// The message catalogs, one flat JSON object of message ID to fmt format per
+// language tag. Add a language by adding locales/<tag>.json.
+//
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// languageAliases maps tags without a catalog of their own to the closest one.
+var languageAliases = map[string]string{
+	"zh":      "zh-CN",
+	"zh-hans": "zh-CN",
+	"zh-sg":   "zh-CN",
+	"zh-hant": "zh-TW",
+	"zh-hk":   "zh-TW",
+	"zh-mo":   "zh-TW",
+}
+
+var catalogs = sync.OnceValue(func() map[string]map[string]string {
+	files, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	all := make(map[string]map[string]string, len(files))
+	for _, f := range files {
+		data, err := localeFiles.ReadFile("locales/" + f.Name())
+		if err != nil {
+			panic(err)
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			panic(fmt.Sprintf("locales/%s: %v", f.Name(), err))
+		}
+		all[strings.TrimSuffix(f.Name(), path.Ext(f.Name()))] = messages
+	}
+	return all
+})
+
+var (
+	languageMu sync.RWMutex
+	language   = DefaultLanguage
+)
+
+// Languages returns the tags of the available catalogs, sorted.
+func Languages() []string {
+	tags := make([]string, 0, len(catalogs()))
+	for tag := range catalogs() {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// MatchLanguage returns the catalog for a -lang value or POSIX locale such as
+// "zh_TW.UTF-8", trying the full tag, then aliases, then the base language.
+// ok is false when nothing matches and DefaultLanguage is returned.
+func MatchLanguage(tag string) (lang string, ok bool) {
+	tag, _, _ = strings.Cut(tag, ".") // encoding, e.g. .UTF-8
+	tag, _, _ = strings.Cut(tag, "@") // modifier, e.g. @euro
+	tag = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+	switch tag {
+	case "":
+		return DefaultLanguage, false
+	case "c", "posix":
+		return DefaultLanguage, true
+	}
+
+	for _, available := range Languages() {
+		if strings.ToLower(available) == tag {
+			return available, true
+		}
+	}
+	if alias, found := languageAliases[tag]; found {
+		return alias, true
+	}
+	base, _, _ := strings.Cut(tag, "-")
+	if alias, found := languageAliases[base]; found {
+		return alias, true
+	}
+	for _, available := range Languages() {
+		if strings.ToLower(available) == base {
+			return available, true
+		}
+	}
+	return DefaultLanguage, false
+}
+
+// SetLanguage selects the catalog T uses; lang must come from MatchLanguage.
+func SetLanguage(lang string) {
+	languageMu.Lock()
+	defer languageMu.Unlock()
+	language = lang
+}
+
+// Language returns the selected catalog's tag.
+func Language() string {
+	languageMu.RLock()
+	defer languageMu.RUnlock()
+	return language
+}
+
+// T returns message id in the selected language, formatted with args. A
+// message missing from the catalog falls back to English, then to id itself.
+func T(id string, args ...any) string {
+	format, ok := catalogs()[Language()][id]
+	if !ok {
+		if format, ok = catalogs()[DefaultLanguage][id]; !ok {
+			format = id
+		}
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
@@ -75,12 +75,28 @@ type msgBrowserOpened struct {
 	browserErr error
 }
 
+// msgReopenDue fires ReopenAfter into the wait for the callback of authURL.
+type msgReopenDue struct {
+	authURL string
+}
+
+type msgBrowserReopened struct {
+	err error
+}
+
 type msgCallbackReceived struct {
 	storage     *TokenStorage
 	saveWarning string
 	err         error
 }
 
+// msgIdentityPending carries tokens from the callback that wait for the user
+// to confirm subject (Deps.Identity) before they are saved.
+type msgIdentityPending struct {
+	storage *TokenStorage
+	subject string
+}
+
 type msgTokenVerified struct {
 	info string
 	err  error
@@ -90,6 +106,11 @@ type msgAPICallDone struct {
 	err error
 }
 
+// InterruptMsg asks the model to stop as if the user pressed Ctrl+C.
+// main.go sends it when the process receives SIGINT or SIGTERM, since the
+// TUI's own signal handler is disabled.
+type InterruptMsg struct{}
+
 // -----------------------------------------------------------------------
 // OAuthModel
 // -----------------------------------------------------------------------
@@ -98,18 +119,24 @@ type msgAPICallDone struct {
 // It is exported so main.go can type-assert the value returned by p.Run().
 type OAuthModel struct {
 	ctx           context.Context
+	cancel        context.CancelFunc
 	deps          Deps
 	currentStep   step
 	stepStatuses  [numMainSteps]stepStatus
 	stepMessages  [numMainSteps]string
 	storage       *TokenStorage
+	obtained      *TokenStorage
 	authURL       string
 	pkceVerifier  string
 	expectedState string
+	waitDeadline  time.Time
+	unconfirmed   *TokenStorage
+	subject       string
 	spinner       spinner.Model
 	warnings      []string
 	ExitCode      int
 	interrupted   bool
+	interrupting  bool
 	termWidth     int
 	clientMode    string
 	serverURL     string
@@ -126,8 +153,10 @@ func NewOAuthModel(
 	s := spinner.New()
 	s.Spinner = spinner.Dot
 	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("86"))
+	ctx, cancel := context.WithCancel(ctx)
 	m := OAuthModel{
 		ctx:        ctx,
+		cancel:     cancel,
 		deps:       deps,
 		clientMode: clientMode,
 		serverURL:  srv,
@@ -161,12 +190,54 @@ func (m OAuthModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case tea.KeyPressMsg:
-		if msg.String() == "ctrl+c" {
-			m.ExitCode = 130
-			m.interrupted = true
-			return m, tea.Quit
+		switch msg.String() {
+		case "ctrl+c":
+			return m.interrupt()
+		case "y", "Y":
+			if m.unconfirmed != nil {
+				storage := m.unconfirmed
+				m.unconfirmed = nil
+				return m, cmdSaveConfirmed(m.deps, storage)
+			}
+		case "n", "N", "enter", "esc":
+			if m.unconfirmed != nil {
+				m.unconfirmed = nil
+				m.stepStatuses[stepWaitCallback] = statusFailed
+				m.stepMessages[stepWaitCallback] = T("tui.not_confirmed", m.subject)
+				m.ExitCode = 1
+				return m, tea.Quit
+			}
+		case "r":
+			if m.waitingForCallback() {
+				m.stepMessages[stepOpenBrowser] = "Re-opening browser..."
+				return m, cmdReopenBrowser(m.ctx, m.deps, m.authURL)
+			}
+		case "p":
+			if m.waitingForCallback() {
+				// Printed above the TUI, unwrapped, so it can be copied.
+				return m, tea.Println(m.authURL)
+			}
 		}
 
+	case msgReopenDue:
+		// Ignore a timer left over from an earlier authorization attempt.
+		if !m.waitingForCallback() || msg.authURL != m.authURL {
+			return m, nil
+		}
+		m.stepMessages[stepOpenBrowser] = "Re-opening browser..."
+		return m, cmdReopenBrowser(m.ctx, m.deps, m.authURL)
+
+	case msgBrowserReopened:
+		if msg.err != nil {
+			m.stepMessages[stepOpenBrowser] = "Could not open browser — use the URL below"
+		} else {
+			m.stepMessages[stepOpenBrowser] = "Browser re-opened"
+		}
+		return m, nil
+
+	case InterruptMsg:
+		return m.interrupt()
+
 	case spinner.TickMsg:
 		var cmd tea.Cmd
 		m.spinner, cmd = m.spinner.Update(msg)
@@ -178,7 +249,7 @@ func (m OAuthModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.stepMessages[stepLoadTokens] = "No existing tokens"
 			return m.startStep(stepAuthFlow, cmdSetupAuthFlow(m.deps))
 		}
-		if time.Now().Before(msg.storage.ExpiresAt) {
+		if TokenValid(msg.storage, m.now().Add(m.deps.RefreshBefore)) {
 			m.stepMessages[stepLoadTokens] = "Found valid token"
 			m.storage = msg.storage
 			return m.startStep(
@@ -187,6 +258,9 @@ func (m OAuthModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			)
 		}
 		m.stepMessages[stepLoadTokens] = "Token expired"
+		if TokenValid(msg.storage, m.now()) {
+			m.stepMessages[stepLoadTokens] = "Token expires soon"
+		}
 		m.storage = msg.storage
 		return m.startStep(
 			stepRefreshToken,
@@ -194,12 +268,37 @@ func (m OAuthModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		)
 
 	case msgTokenRefreshed:
+		if m.interrupting {
+			// The refresh was allowed to finish after an interrupt; a rotated
+			// token is already persisted, so just record it and stop.
+			if msg.err == nil {
+				m.storage = msg.storage
+				m.obtained = msg.storage
+				m.stepStatuses[stepRefreshToken] = statusDone
+				m.stepMessages[stepRefreshToken] = "Token refreshed, tokens saved"
+			}
+			return m.quitInterrupted()
+		}
 		if msg.err != nil {
 			if isContextCanceled(msg.err) {
 				return m.quitInterrupted()
 			}
 			m.stepStatuses[stepRefreshToken] = statusFailed
 			m.stepMessages[stepRefreshToken] = msg.err.Error()
+			if TokenValid(m.storage, m.now()) {
+				// An early refresh failed; the current token still works.
+				m.stepMessages[stepRefreshToken] = msg.err.Error() + "; using the current token"
+				return m.startStep(
+					stepVerifyToken,
+					cmdVerifyToken(m.ctx, m.deps, m.storage.AccessToken),
+				)
+			}
+			if errors.Is(msg.err, ErrServerUnreachable) {
+				// A login needs the server too; fail now instead of opening
+				// a browser on a flow that cannot complete.
+				m.ExitCode = 1
+				return m, tea.Quit
+			}
 			return m.startStep(stepAuthFlow, cmdSetupAuthFlow(m.deps))
 		}
 		m.stepStatuses[stepRefreshToken] = statusDone
@@ -209,6 +308,7 @@ func (m OAuthModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.stepMessages[stepRefreshToken] = "Token refreshed"
 		}
 		m.storage = msg.storage
+		m.obtained = msg.storage
 		return m.startStep(stepVerifyToken, cmdVerifyToken(m.ctx, m.deps, msg.storage.AccessToken))
 
 	case msgAuthFlowReady:
@@ -234,12 +334,30 @@ func (m OAuthModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		} else {
 			m.stepMessages[stepOpenBrowser] = "Browser opened"
 		}
-		return m.startStep(
-			stepWaitCallback,
-			cmdWaitCallback(m.ctx, m.deps, m.expectedState, m.pkceVerifier),
-		)
+		if m.deps.CallbackWait > 0 {
+			m.waitDeadline = m.now().Add(m.deps.CallbackWait)
+		}
+		wait := cmdWaitCallback(m.ctx, m.deps, m.expectedState, m.pkceVerifier)
+		if m.deps.ReopenAfter > 0 {
+			wait = tea.Batch(wait, cmdReopenAfter(m.deps.ReopenAfter, m.authURL))
+		}
+		return m.startStep(stepWaitCallback, wait)
 
 	case msgCallbackReceived:
+		if m.interrupting {
+			// The exchange was allowed to finish after an interrupt; record the
+			// outcome (tokens are already persisted) and stop here.
+			if msg.err == nil {
+				m.storage = msg.storage
+				m.obtained = msg.storage
+				m.stepStatuses[stepWaitCallback] = statusDone
+				m.stepMessages[stepWaitCallback] = "Authorization complete, tokens saved"
+				if msg.saveWarning != "" {
+					m.stepMessages[stepWaitCallback] = msg.saveWarning
+				}
+			}
+			return m.quitInterrupted()
+		}
 		if msg.err != nil {
 			if isContextCanceled(msg.err) {
 				return m.quitInterrupted()
@@ -250,6 +368,7 @@ func (m OAuthModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, tea.Quit
 		}
 		m.storage = msg.storage
+		m.obtained = msg.storage
 		m.stepStatuses[stepWaitCallback] = statusDone
 		if msg.saveWarning != "" {
 			m.stepMessages[stepWaitCallback] = msg.saveWarning
@@ -258,6 +377,18 @@ func (m OAuthModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		return m.startStep(stepVerifyToken, cmdVerifyToken(m.ctx, m.deps, msg.storage.AccessToken))
 
+	case msgIdentityPending:
+		m.obtained = msg.storage
+		if m.interrupting {
+			// Nothing was saved; -revoke-on-abort can still revoke the grant.
+			return m.quitInterrupted()
+		}
+		m.unconfirmed = msg.storage
+		m.subject = msg.subject
+		m.waitDeadline = time.Time{}
+		m.stepMessages[stepWaitCallback] = "Signed in as " + msg.subject
+		return m, nil
+
 	case msgTokenVerified:
 		if msg.err != nil {
 			if isContextCanceled(msg.err) {
@@ -265,7 +396,19 @@ func (m OAuthModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			// Verification failure is non-fatal — still proceed to API call.
 			m.stepStatuses[stepVerifyToken] = statusFailed
+			if errors.Is(msg.err, ErrNotSupported) {
+				m.stepStatuses[stepVerifyToken] = statusSkipped
+			}
 			m.stepMessages[stepVerifyToken] = msg.err.Error()
+			if errors.Is(msg.err, ErrServerUnreachable) && TokenValid(m.storage, m.now()) {
+				// The server is down but the stored token is still valid:
+				// keep it and skip the API call, which would fail the same way.
+				m.stepMessages[stepVerifyToken] = msg.err.Error() + "; using the stored token"
+				m.stepStatuses[stepAPICall] = statusSkipped
+				m.currentStep = stepDone
+				m.ExitCode = 0
+				return m, tea.Quit
+			}
 		} else {
 			m.stepStatuses[stepVerifyToken] = statusDone
 			m.stepMessages[stepVerifyToken] = "Token valid"
@@ -273,6 +416,10 @@ func (m OAuthModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m.startStep(stepAPICall, cmdAPICall(m.ctx, m.deps, m.storage))
 
 	case msgAPICallDone:
+		if m.interrupting {
+			// Any refresh during the call has been saved; stop here.
+			return m.quitInterrupted()
+		}
 		if msg.err != nil {
 			if isContextCanceled(msg.err) {
 				return m.quitInterrupted()
@@ -287,9 +434,26 @@ func (m OAuthModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.stepStatuses[stepVerifyToken] = statusPending
 				return m.startStep(stepAuthFlow, cmdSetupAuthFlow(m.deps))
 			}
+			if errors.Is(msg.err, ErrNotSupported) {
+				m.stepStatuses[stepAPICall] = statusSkipped
+				m.currentStep = stepDone
+				m.ExitCode = 0
+				return m, tea.Quit
+			}
 			m.stepStatuses[stepAPICall] = statusFailed
 			m.stepMessages[stepAPICall] = msg.err.Error()
+			if errors.Is(msg.err, ErrServerUnreachable) && TokenValid(m.storage, m.now()) {
+				m.stepMessages[stepAPICall] = msg.err.Error() + "; using the stored token"
+				m.currentStep = stepDone
+				m.ExitCode = 0
+				return m, tea.Quit
+			}
 			m.ExitCode = 1
+			if !m.deps.Strict {
+				// The token is obtained and saved; the check is informational.
+				m.currentStep = stepDone
+				m.ExitCode = 0
+			}
 			return m, tea.Quit
 		}
 		m.stepStatuses[stepAPICall] = statusDone
@@ -302,6 +466,33 @@ func (m OAuthModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// Token returns the token in use when the flow finished, or nil if no token
+// was obtained.
+func (m OAuthModel) Token() *TokenStorage {
+	return m.storage
+}
+
+// ObtainedToken returns the token issued by the server during this run (via
+// the authorization flow or a refresh), or nil if only a stored token was used.
+func (m OAuthModel) ObtainedToken() *TokenStorage {
+	return m.obtained
+}
+
+// now returns the current time from deps.Now, or time.Now without one.
+func (m OAuthModel) now() time.Time {
+	if m.deps.Now != nil {
+		return m.deps.Now()
+	}
+	return time.Now()
+}
+
+// waitingForCallback reports whether the flow is waiting for the browser and
+// the user can still act on the authorization URL.
+func (m OAuthModel) waitingForCallback() bool {
+	return m.currentStep == stepWaitCallback && m.authURL != "" && !m.interrupting &&
+		m.unconfirmed == nil
+}
+
 // startStep transitions to the given step and fires cmd.
 func (m OAuthModel) startStep(s step, cmd tea.Cmd) (tea.Model, tea.Cmd) {
 	m.currentStep = s
@@ -317,7 +508,30 @@ func isContextCanceled(err error) bool {
 
 // quitInterrupted marks the model as interrupted (exit code 130) and returns tea.Quit.
 func (m OAuthModel) quitInterrupted() (tea.Model, tea.Cmd) {
+	m.cancel()
 	m.ExitCode = 130
 	m.interrupted = true
 	return m, tea.Quit
 }
+
+// interrupt handles Ctrl+C / SIGINT. While waiting for the browser callback
+// or while a refresh may be in flight (refresh step, API call), the first
+// interrupt cancels the flow but lets the step finish so newly issued tokens
+// are persisted; a second interrupt force-quits.
+func (m OAuthModel) interrupt() (tea.Model, tea.Cmd) {
+	switch m.currentStep {
+	case stepWaitCallback, stepRefreshToken, stepAPICall:
+	default:
+		return m.quitInterrupted()
+	}
+	if m.unconfirmed != nil {
+		// Waiting for the identity confirmation; nothing is in flight.
+		return m.quitInterrupted()
+	}
+	if m.interrupting {
+		return m.quitInterrupted()
+	}
+	m.interrupting = true
+	m.cancel()
+	return m, nil
+}
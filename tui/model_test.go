@@ -0,0 +1,79 @@
+package tui
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestInterruptDuringRefreshSavesRotatedToken(t *testing.T) {
+	release := make(chan struct{})
+	var saved *TokenStorage
+	deps := Deps{
+		RefreshToken: func(ctx context.Context, _ string) (*TokenStorage, string, error) {
+			<-release
+			if err := ctx.Err(); err != nil {
+				return nil, "", err
+			}
+			saved = &TokenStorage{AccessToken: "new-access", RefreshToken: "rotated-refresh"}
+			return saved, "", nil
+		},
+	}
+	m := NewOAuthModel(context.Background(), deps, "public", "https://auth.example.com", "cid", nil)
+
+	expired := &TokenStorage{
+		AccessToken:  "old-access",
+		RefreshToken: "old-refresh",
+		ExpiresAt:    time.Now().Add(-time.Minute),
+	}
+	model, refresh := m.Update(msgTokensLoaded{storage: expired})
+	m = model.(OAuthModel)
+	if m.currentStep != stepRefreshToken || refresh == nil {
+		t.Fatalf("step = %v, want stepRefreshToken with a command", m.currentStep)
+	}
+
+	model, cmd := m.Update(InterruptMsg{})
+	m = model.(OAuthModel)
+	if cmd != nil || !m.interrupting {
+		t.Fatal("first interrupt during the refresh should wait for it")
+	}
+
+	// The server answers after the interrupt; the refresh must still succeed.
+	close(release)
+	msg := refresh()
+	if r, ok := msg.(msgTokenRefreshed); !ok || r.err != nil {
+		t.Fatalf("refresh after interrupt = %#v, want success", msg)
+	}
+	model, cmd = m.Update(msg)
+	m = model.(OAuthModel)
+	if cmd == nil || m.ExitCode != 130 {
+		t.Errorf("after the refresh: cmd = %v, ExitCode = %d; want quit with 130", cmd, m.ExitCode)
+	}
+	if saved == nil || m.ObtainedToken() != saved {
+		t.Errorf("ObtainedToken() = %+v, want the rotated token", m.ObtainedToken())
+	}
+}
+
+func TestTokensLoadedUsesDepsClock(t *testing.T) {
+	expiresAt := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	stored := &TokenStorage{AccessToken: "access", RefreshToken: "refresh", ExpiresAt: expiresAt}
+
+	for _, tt := range []struct {
+		name string
+		now  time.Time
+		want step
+	}{
+		{"before expiry", expiresAt.Add(-time.Hour), stepVerifyToken},
+		{"after expiry", expiresAt.Add(time.Minute), stepRefreshToken},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			deps := Deps{Now: func() time.Time { return tt.now }}
+			m := NewOAuthModel(context.Background(), deps, "public", "https://auth.example.com",
+				"cid", nil)
+			model, _ := m.Update(msgTokensLoaded{storage: stored})
+			if got := model.(OAuthModel).currentStep; got != tt.want {
+				t.Errorf("step = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package tui
 
 import (
+	"crypto/sha256"
+	"encoding/base32"
 	"errors"
+	"time"
 
 	"github.com/go-authgate/sdk-go/credstore"
 )
@@ -9,12 +12,58 @@ import (
 // ErrRefreshTokenExpired indicates the refresh token has expired or is invalid.
 var ErrRefreshTokenExpired = errors.New("refresh token expired or invalid")
 
+// ErrServerUnreachable indicates a request got no usable response from the
+// server. A still-valid stored token is then used as-is, and no login is
+// started that the server could not complete.
+var ErrServerUnreachable = errors.New("server unreachable")
+
+// ErrNotSupported indicates the server has no endpoint for an operation; the
+// TUI marks the corresponding step as skipped rather than failed.
+var ErrNotSupported = errors.New("not supported by this server")
+
 // TokenStorage holds persisted OAuth tokens for one client.
 type TokenStorage = credstore.Token
 
+// TokenValid reports whether tok's access token is still valid at now. A zero
+// ExpiresAt marks a token issued without expires_in (GitHub OAuth apps), which
+// does not expire.
+func TokenValid(tok *TokenStorage, now time.Time) bool {
+	return tok.ExpiresAt.IsZero() || now.Before(tok.ExpiresAt)
+}
+
+// FingerprintLen is the number of base32 characters after the "sha256:"
+// prefix of a TokenFingerprint (60 bits of the digest).
+const FingerprintLen = 12
+
+// fingerprintEncoding is lowercase RFC 4648 base32 without padding, so a
+// fingerprint is easy to read aloud and has no 0 or 1 to confuse with o or l.
+var fingerprintEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").
+	WithPadding(base32.NoPadding)
+
+// TokenFingerprint returns a short, non-reversible identifier for token (the
+// first FingerprintLen base32 characters of its SHA-256), safe to show where
+// the token itself must not appear but the same token has to be recognisable.
+func TokenFingerprint(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "sha256:" + fingerprintEncoding.EncodeToString(sum[:])[:FingerprintLen]
+}
+
 // PKCEParams holds the code verifier and challenge for PKCE (RFC 7636).
 type PKCEParams struct {
 	Verifier  string
 	Challenge string
 	Method    string
 }
+
+// HTTPTiming is the breakdown of a single HTTP request, collected when the
+// -timing flag is set. DNS, Connect and TLS are zero on a reused connection.
+type HTTPTiming struct {
+	Label   string
+	Status  int
+	Reused  bool
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+	TTFB    time.Duration
+	Total   time.Duration
+}
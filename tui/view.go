@@ -2,6 +2,7 @@ package tui
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -21,7 +22,7 @@ func (m OAuthModel) View() tea.View {
 
 	// Warnings
 	for _, w := range m.warnings {
-		b.WriteString("  " + styleWarning.Render("WARNING: "+w) + "\n")
+		b.WriteString("  " + styleWarning.Render(T("tui.warning", w)) + "\n")
 	}
 	if len(m.warnings) > 0 {
 		b.WriteString("\n")
@@ -52,12 +53,25 @@ func (m OAuthModel) View() tea.View {
 			line = styleStepSkipped.Render("  - " + label)
 		case statusInProgress:
 			line = "  " + m.spinner.View() + " " + label
+			if step(i) == stepWaitCallback && !m.waitDeadline.IsZero() {
+				left := max(m.waitDeadline.Sub(m.now()), 0).Round(time.Second)
+				line += "  " + styleDim.Render(left.String()+" left")
+			}
 		}
 		b.WriteString(line + "\n")
 	}
 
+	if m.interrupting && !m.interrupted {
+		b.WriteString("\n  " + styleWarning.Render(T("tui.interrupting")) + "\n")
+	}
+
+	// Identity confirmation — shown until the user answers
+	if m.unconfirmed != nil {
+		b.WriteString("\n  " + styleWarning.Render(T("tui.confirm_prompt", m.subject)) + "\n")
+	}
+
 	// Auth URL box — shown while waiting for browser callback
-	if m.currentStep == stepWaitCallback && m.authURL != "" {
+	if m.waitingForCallback() {
 		b.WriteString("\n")
 		// Reserve space for box border (2) + padding (2) + indent (2).
 		avail := m.termWidth - 6
@@ -65,33 +79,74 @@ func (m OAuthModel) View() tea.View {
 			avail = 74 // sensible fallback before first WindowSizeMsg
 		}
 		b.WriteString(styleURLBox.Render(
-			"  If browser did not open, visit:\n  " + styleAuthURL.Render(
+			"  " + T("tui.url_hint") + "\n  " + styleAuthURL.Render(
 				wrapURL(m.authURL, avail),
 			),
 		))
-		b.WriteString("\n")
+		b.WriteString("\n  " + styleDim.Render(T("tui.key_hints")) + "\n")
 	}
 
 	// Token info box — shown on successful completion
 	if m.currentStep == stepDone && m.storage != nil {
 		b.WriteString("\n")
-		preview := m.storage.AccessToken
-		if len(preview) > 20 {
-			preview = preview[:20] + "..."
+		preview := TokenFingerprint(m.storage.AccessToken) + styleDim.Render("  (-show-token to reveal)")
+		if m.deps.ShowToken {
+			preview = m.storage.AccessToken
+		}
+		expiresIn := m.storage.ExpiresAt.Sub(m.now()).Round(time.Second).String()
+		if m.storage.ExpiresAt.IsZero() {
+			expiresIn = "never"
 		}
-		expiresIn := time.Until(m.storage.ExpiresAt).Round(time.Second)
 		tokenContent := styleTokenLabel.Render("Access Token:") + "  " + preview + "\n" +
 			styleTokenLabel.Render("Token Type:") + "  " + m.storage.TokenType + "\n" +
-			styleTokenLabel.Render("Expires In:") + "  " + expiresIn.String()
+			styleTokenLabel.Render("Expires In:") + "  " + expiresIn
 		b.WriteString(styleTokenBox.Render(
 			styleTokenTitle.Render("  Token Info") + "\n\n" + tokenContent,
 		))
 		b.WriteString("\n")
 	}
 
+	// HTTP timing table — shown once the flow has finished
+	if m.deps.Timings != nil && (m.currentStep == stepDone || m.ExitCode != 0) {
+		if timings := m.deps.Timings(); len(timings) > 0 {
+			b.WriteString("\n")
+			b.WriteString(renderTimings(timings))
+			b.WriteString("\n")
+		}
+	}
+
 	return tea.NewView(b.String())
 }
 
+// renderTimings formats HTTP timings as a fixed-width table.
+func renderTimings(timings []HTTPTiming) string {
+	var sb strings.Builder
+	sb.WriteString(styleTokenTitle.Render("  HTTP Timing") + "\n")
+	sb.WriteString(styleDim.Render(fmt.Sprintf("  %-28s %6s %9s %9s %9s %9s %9s",
+		"Request", "Status", "DNS", "Connect", "TLS", "TTFB", "Total")) + "\n")
+	for _, t := range timings {
+		status := "error"
+		if t.Status != 0 {
+			status = strconv.Itoa(t.Status)
+		}
+		dns, connect, tlsDur := fmtTiming(t.DNS), fmtTiming(t.Connect), fmtTiming(t.TLS)
+		if t.Reused {
+			dns, connect, tlsDur = "reused", "reused", "reused"
+		}
+		sb.WriteString(fmt.Sprintf("  %-28s %6s %9s %9s %9s %9s %9s\n",
+			t.Label, status, dns, connect, tlsDur, fmtTiming(t.TTFB), fmtTiming(t.Total)))
+	}
+	return sb.String()
+}
+
+// fmtTiming renders a duration with millisecond precision, or "-" when unset.
+func fmtTiming(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	return d.Round(time.Millisecond).String()
+}
+
 // wrapURL breaks a URL across multiple lines for terminal display.
 // It prefers to break just after '?' or '&' so each query parameter starts
 // on its own line; otherwise it hard-breaks at maxWidth characters.
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-authgate/oauth-cli/tui"
+)
+
+// identity is the consolidated account summary printed by whoami.
+type identity struct {
+	Subject    string     `json:"subject,omitempty"`
+	Email      string     `json:"email,omitempty"`
+	Username   string     `json:"username,omitempty"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	ClientID   string     `json:"client_id"`
+	ClientMode string     `json:"client_mode"`
+	Server     string     `json:"server"`
+	Sources    []string   `json:"sources"`
+	Warnings   []string   `json:"warnings,omitempty"`
+}
+
+// claimSource is one set of claims about the token holder.
+type claimSource struct {
+	name   string
+	claims map[string]any
+}
+
+// runWhoami implements `oauth-cli whoami`: it combines the claims of the ID
+// token (when the stored token was just refreshed), the userinfo endpoint
+// (advertised through -discovery) and the token info endpoint into one
+// summary of who the stored token belongs to. Sources that are unavailable
+// are skipped; it exits 1 only when there is no valid token.
+func runWhoami(ctx context.Context) int {
+	initConfig()
+	discoverCapabilities(ctx)
+
+	storage, err := tokenForAudience(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	var (
+		sources  []claimSource
+		warnings []string
+	)
+	if idToken := grantIDToken(storage); idToken != "" {
+		if claims, err := decodeJWTClaims(idToken); err == nil {
+			sources = append(sources, claimSource{"id_token", claims})
+		} else {
+			warnings = append(warnings, "id_token: "+err.Error())
+		}
+	}
+	if endpoint := activeProvider.userinfoPath; endpoint != "" {
+		claims, err := fetchUserinfo(ctx, endpointURL(endpoint), storage.AccessToken)
+		if err == nil {
+			sources = append(sources, claimSource{"userinfo", claims})
+		} else {
+			warnings = append(warnings, "userinfo: "+err.Error())
+		}
+	} else if cfg.Discovery {
+		warnings = append(warnings, "userinfo: the server metadata advertises no userinfo endpoint")
+	}
+	if info, err := verifyToken(ctx, storage.AccessToken); err == nil {
+		var claims map[string]any
+		if err := json.Unmarshal([]byte(info), &claims); err == nil {
+			sources = append(sources, claimSource{"tokeninfo", claims})
+		} else {
+			warnings = append(warnings, "tokeninfo: response is not a JSON object")
+		}
+	} else if !errors.Is(err, tui.ErrNotSupported) {
+		warnings = append(warnings, "tokeninfo: "+err.Error())
+	} else if cfg.Discovery {
+		warnings = append(warnings, "tokeninfo: "+noTokenInfoReason())
+	}
+
+	id := buildIdentity(storage, sources)
+	id.Warnings = warnings
+	if cfg.FormatTemplate != nil {
+		if err := writeFormat(os.Stdout, cfg.FormatTemplate, id); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	if cfg.OutputFormat == outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(id); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	writeIdentity(os.Stdout, id, clock.Now())
+	return 0
+}
+
+// grantIDToken returns the ID token issued with storage during this run, or
+// "" when storage was loaded from the store (ID tokens are not persisted).
+func grantIDToken(storage *tui.TokenStorage) string {
+	lastGrant.Lock()
+	defer lastGrant.Unlock()
+	if lastGrant.accessToken != storage.AccessToken {
+		return ""
+	}
+	return lastGrant.idToken
+}
+
+// fetchUserinfo calls the OpenID Connect userinfo endpoint with accessToken.
+func fetchUserinfo(ctx context.Context, endpoint, accessToken string) (map[string]any, error) {
+	ctx, cancel := context.WithTimeout(ctx, apiCallTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := cfg.RetryClient.DoWithContext(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := readResponseBody(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, parseOAuthError(resp.StatusCode, body, "userinfo")
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(body, &claims); err != nil {
+		return nil, fmt.Errorf("invalid userinfo response: %w", err)
+	}
+	return claims, nil
+}
+
+// buildIdentity merges sources into an identity. For each field the first
+// source that has it wins, so the ID token (signed at issue time) takes
+// precedence over userinfo and introspection.
+func buildIdentity(storage *tui.TokenStorage, sources []claimSource) identity {
+	id := identity{
+		ClientID:   cfg.ClientID,
+		ClientMode: "confidential",
+		Server:     cfg.ServerURL,
+		Sources:    []string{},
+	}
+	if isPublicClient() {
+		id.ClientMode = "public"
+	}
+	if !storage.ExpiresAt.IsZero() {
+		expiresAt := storage.ExpiresAt.UTC()
+		id.ExpiresAt = &expiresAt
+	}
+
+	claim := func(names ...string) string {
+		for _, src := range sources {
+			for _, name := range names {
+				if v, ok := src.claims[name].(string); ok && v != "" {
+					return v
+				}
+			}
+		}
+		return ""
+	}
+	id.Subject = claim("sub", "user_id")
+	id.Email = claim("email")
+	id.Username = claim("preferred_username", "username", "name")
+	for _, src := range sources {
+		id.Sources = append(id.Sources, src.name)
+	}
+
+	// Scopes: what the server reports for the token, else what the last grant
+	// returned, else what was requested.
+	id.Scopes = splitScopes(cfg.Scope)
+	if granted := claim("scope"); granted != "" {
+		id.Scopes = splitScopes(granted)
+	} else {
+		lastGrant.Lock()
+		grantScope := lastGrant.scope
+		issuedNow := lastGrant.accessToken == storage.AccessToken
+		lastGrant.Unlock()
+		if issuedNow && grantScope != "" {
+			id.Scopes = splitScopes(grantScope)
+		}
+	}
+	return id
+}
+
+// writeIdentity prints id in the same layout as `status`.
+func writeIdentity(w io.Writer, id identity, now time.Time) {
+	orNone := func(s string) string {
+		if s == "" {
+			return "(unknown)"
+		}
+		return s
+	}
+	fmt.Fprintf(w, "Subject:       %s\n", orNone(id.Subject))
+	fmt.Fprintf(w, "Email:         %s\n", orNone(id.Email))
+	fmt.Fprintf(w, "Username:      %s\n", orNone(id.Username))
+	fmt.Fprintf(w, "Scopes:        %s\n", orNone(strings.Join(id.Scopes, " ")))
+	if id.ExpiresAt == nil {
+		fmt.Fprintln(w, "Expires:       never")
+	} else {
+		fmt.Fprintf(w, "Expires:       %s (in %s)\n", id.ExpiresAt.Local().Format(time.RFC3339),
+			id.ExpiresAt.Sub(now).Round(time.Second))
+	}
+	fmt.Fprintf(w, "Client:        %s (%s)\n", id.ClientID, id.ClientMode)
+	fmt.Fprintf(w, "Server:        %s\n", id.Server)
+	if len(id.Sources) == 0 {
+		fmt.Fprintln(w, "Sources:       none (enable -discovery or request the openid scope)")
+	} else {
+		fmt.Fprintf(w, "Sources:       %s\n", strings.Join(id.Sources, ", "))
+	}
+	for _, warning := range id.Warnings {
+		fmt.Fprintf(w, "Warning:       %s\n", warning)
+	}
+}
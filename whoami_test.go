@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-authgate/oauth-cli/tui"
+)
+
+func TestBuildIdentity(t *testing.T) {
+	origScope, origSecret := cfg.Scope, cfg.ClientSecret
+	t.Cleanup(func() { cfg.Scope, cfg.ClientSecret = origScope, origSecret })
+	cfg.Scope, cfg.ClientSecret = "openid profile", ""
+
+	storage := &tui.TokenStorage{
+		AccessToken: "stored-access-token",
+		ExpiresAt:   time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	id := buildIdentity(storage, []claimSource{
+		{"id_token", map[string]any{"sub": "user-1", "email": "alice@example.com"}},
+		{"tokeninfo", map[string]any{"user_id": "other", "scope": "read write", "username": "alice"}},
+	})
+
+	if id.Subject != "user-1" || id.Email != "alice@example.com" || id.Username != "alice" {
+		t.Errorf("claims not merged in source order: %+v", id)
+	}
+	if !slices.Equal(id.Scopes, []string{"read", "write"}) {
+		t.Errorf("Scopes = %v, want the introspected scopes", id.Scopes)
+	}
+	if id.ClientMode != "public" || id.ExpiresAt == nil {
+		t.Errorf("ClientMode = %q, ExpiresAt = %v", id.ClientMode, id.ExpiresAt)
+	}
+	if !slices.Equal(id.Sources, []string{"id_token", "tokeninfo"}) {
+		t.Errorf("Sources = %v", id.Sources)
+	}
+
+	if id := buildIdentity(storage, nil); !slices.Equal(id.Scopes, []string{"openid", "profile"}) {
+		t.Errorf("without sources Scopes = %v, want the configured scopes", id.Scopes)
+	}
+}
+
+func TestWriteIdentity_NoSources(t *testing.T) {
+	var buf bytes.Buffer
+	id := identity{ClientID: "cid", ClientMode: "public", Sources: []string{}}
+	writeIdentity(&buf, id, time.Now())
+	out := buf.String()
+	for _, want := range []string{
+		"Subject:       (unknown)",
+		"Expires:       never",
+		"Sources:       none",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestFetchUserinfo(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer stored-access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"invalid_token"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"sub":"user-1","email":"alice@example.com"}`))
+	}))
+	defer srv.Close()
+	setTestServer(t, srv)
+
+	claims, err := fetchUserinfo(context.Background(), srv.URL+"/userinfo", "stored-access-token")
+	if err != nil || claims["email"] != "alice@example.com" {
+		t.Errorf("fetchUserinfo() = %v, %v", claims, err)
+	}
+	if _, err := fetchUserinfo(context.Background(), srv.URL+"/userinfo", "wrong"); err == nil {
+		t.Error("fetchUserinfo() with a rejected token expected error")
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/danieljoos/wincred"
+	"github.com/go-authgate/sdk-go/credstore"
+)
+
+// wincredMaxBlobSize is the largest credential blob Windows Credential
+// Manager accepts (CRED_MAX_CREDENTIAL_BLOB_SIZE, 5*512 bytes).
+const wincredMaxBlobSize = 5 * 512
+
+// wincredStore stores each token as a generic credential in Windows Credential
+// Manager, named authgate:<server host>/<token key>. Unlike the keyring
+// backend it talks to the Credential Manager API directly, so the persistence
+// can be set to enterprise (roaming with the user's domain profile).
+type wincredStore struct {
+	prefix  string
+	persist wincred.CredentialPersistence
+}
+
+// newWincredStore returns a Credential Manager store for tokens issued by
+// serverURL. With roaming, credentials use CRED_PERSIST_ENTERPRISE.
+func newWincredStore(serverURL string, roaming bool) *wincredStore {
+	persist := wincred.PersistLocalMachine
+	if roaming {
+		persist = wincred.PersistEnterprise
+	}
+	return &wincredStore{prefix: credentialTargetPrefix(serverURL), persist: persist}
+}
+
+// target returns the Credential Manager target name for a token key.
+func (s *wincredStore) target(id string) string {
+	return s.prefix + id
+}
+
+func (s *wincredStore) Load(id string) (credstore.Token, error) {
+	var tok credstore.Token
+	cred, err := wincred.GetGenericCredential(s.target(id))
+	if errors.Is(err, wincred.ErrElementNotFound) {
+		return tok, fmt.Errorf("no token stored for %s", s.target(id))
+	}
+	if err != nil {
+		return tok, fmt.Errorf("wincred: %w", err)
+	}
+	if err := json.Unmarshal(cred.CredentialBlob, &tok); err != nil {
+		return tok, fmt.Errorf("wincred: invalid token data for %s: %w", s.target(id), err)
+	}
+	return tok, nil
+}
+
+func (s *wincredStore) Save(id string, tok credstore.Token) error {
+	data, err := json.Marshal(tok)
+	if err != nil {
+		return err
+	}
+	if len(data) > wincredMaxBlobSize {
+		return fmt.Errorf(
+			"wincred: token data is %d bytes, Credential Manager allows at most %d",
+			len(data), wincredMaxBlobSize)
+	}
+	cred := wincred.NewGenericCredential(s.target(id))
+	cred.CredentialBlob = data
+	cred.UserName = tok.ClientID
+	cred.Comment = "OAuth tokens saved by oauth-cli"
+	cred.Persist = s.persist
+	if err := cred.Write(); err != nil {
+		return fmt.Errorf("wincred: %w", err)
+	}
+	return nil
+}
+
+func (s *wincredStore) Delete(id string) error {
+	cred, err := wincred.GetGenericCredential(s.target(id))
+	if errors.Is(err, wincred.ErrElementNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("wincred: %w", err)
+	}
+	if err := cred.Delete(); err != nil {
+		return fmt.Errorf("wincred: %w", err)
+	}
+	return nil
+}
+
+func (s *wincredStore) String() string {
+	return "wincred: " + s.target("*")
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/danieljoos/wincred"
+	"github.com/go-authgate/sdk-go/credstore"
+)
+
+func TestWincredStore_Target(t *testing.T) {
+	s := newWincredStore("https://auth.example.com:8443/base", false)
+	if got, want := s.target("cid#aud=api://orders"), "authgate:auth.example.com:8443/cid#aud=api://orders"; got != want {
+		t.Errorf("target = %q, want %q", got, want)
+	}
+	if s.persist != wincred.PersistLocalMachine {
+		t.Errorf("persist = %v, want local machine", s.persist)
+	}
+	if roaming := newWincredStore("https://auth.example.com", true); roaming.persist != wincred.PersistEnterprise {
+		t.Errorf("roaming persist = %v, want enterprise", roaming.persist)
+	}
+}
+
+func TestWincredStore_SaveRejectsOversizedToken(t *testing.T) {
+	s := newWincredStore("https://auth.example.com", false)
+	err := s.Save("cid", credstore.Token{AccessToken: strings.Repeat("a", wincredMaxBlobSize)})
+	if err == nil || !strings.Contains(err.Error(), "at most") {
+		t.Errorf("Save() error = %v, want size limit error", err)
+	}
+}